@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/storage"
+)
+
+// Build a new app on the next request. Every app built is appended to the returned slice
+func resetApi(t *testing.T) *[]*application.App {
+	t.Setenv("REPOSITORY", "memory")
+	t.Setenv("JWT_SECRET", "api-handler-secret")
+	t.Setenv("MEDIA_ROOT", t.TempDir())
+	var (
+		mu    sync.Mutex
+		built []*application.App
+	)
+	initialize, handler, app = sync.Once{}, nil, nil
+	newApp = func(cfg *config.Config) (*application.App, error) {
+		builtApp, err := application.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		built = append(built, builtApp)
+		mu.Unlock()
+		// Empty lists are answered with a 404
+		_, err = builtApp.Repo.CreateCoffeeShop(context.Background(), &models.CoffeeShop{Name: "Café", Address: "Av. Chapultepec 100", City: "Guadalajara", Rating: 4.5})
+		return builtApp, err
+	}
+	t.Cleanup(func() { newApp = application.New })
+	return &built
+}
+
+func request(path string, remoteAddr string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	Api(w, r)
+	return w
+}
+
+func TestApiBuildsTheAppOnce(t *testing.T) {
+	built := resetApi(t)
+	// A single client makes every request, without tripping the rate limiter
+	t.Setenv("RATE_LIMIT_BURST", "1000")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := request("/api/v1/coffee-shops", "192.0.2.1:1234")
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if len(*built) != 1 {
+		t.Fatalf("expected the app to be built once, it was built %d times", len(*built))
+	}
+	first := (*built)[0]
+	request("/api/v1/coffee-shops", "192.0.2.1:1234")
+	// The same repository, and with it the same database pool, serves every request
+	if len(*built) != 1 || app != first || app.Repo != first.Repo {
+		t.Fatal("the app and its repository must be reused by the next requests")
+	}
+}
+
+func TestApiKeepsTheRateLimiter(t *testing.T) {
+	resetApi(t)
+	limited := 0
+	for i := 0; i < 20; i++ {
+		if w := request("/api/v1/healthcheck", "192.0.2.1:1234"); w.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited == 0 {
+		t.Fatal("expected the rate limiter to reject some of the requests of a single client")
+	}
+	// Other clients have their own limit
+	if w := request("/api/v1/healthcheck", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for another client, got %d", w.Code)
+	}
+}
+
+// Vercel's filesystem is read-only, the api works without uploads
+func TestApiWithoutMediaDirectory(t *testing.T) {
+	resetApi(t)
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o444); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MEDIA_ROOT", filepath.Join(file, "media"))
+	if w := request("/api/v1/healthcheck", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := app.Storage.(storage.DisabledStorage); !ok {
+		t.Fatalf("expected the uploads to be disabled, got %T", app.Storage)
+	}
+}
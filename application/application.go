@@ -1,25 +1,53 @@
 package application
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"os"
 
+	"github.com/EduardoZepeda/go-coffee-api/config"
 	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/metrics"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/storage"
+	"github.com/EduardoZepeda/go-coffee-api/tracing"
+	"github.com/EduardoZepeda/go-coffee-api/types"
 	"github.com/EduardoZepeda/go-coffee-api/ws"
 	"github.com/gorilla/mux"
 )
 
+// Every repository implements the whole interface. The check lives here so the database package doesn't depend
+// on the repository package
+var (
+	_ repository.Repository = (*database.PostgresRepository)(nil)
+	_ repository.Repository = (*database.MemoryRepository)(nil)
+)
+
+// Header with the id of the request, set by the RequestId middleware on every response
+const REQUEST_ID_HEADER = "X-Request-ID"
+
 type App struct {
-	Repo   *database.PostgresRepository
-	Router *mux.Router
-	Logger *log.Logger
-	Hub    *ws.Hub
+	Config  *config.Config
+	Repo    repository.Repository
+	Router  *mux.Router
+	Logger  *logging.Logger
+	Hub     *ws.Hub
+	Storage storage.Storage
+	Metrics *metrics.Metrics
 }
 
 func (app *App) Respond(w http.ResponseWriter, data interface{}, statusCode int) error {
+	// Encoding can be the slowest part of a large list, so it has its own span in the trace of the handler
+	if ctx, ok := tracing.WriterContext(w); ok {
+		_, span := tracing.Start(ctx, "application.Respond", "http.status_code", statusCode)
+		defer span.End()
+	}
+	if apiError, ok := data.(types.ApiError); ok && apiError.RequestId == "" {
+		apiError.RequestId = w.Header().Get(REQUEST_ID_HEADER)
+		data = apiError
+	}
 	res, err := json.Marshal(data)
 	if err != nil {
 		return err
@@ -34,37 +62,85 @@ func (app *App) Respond(w http.ResponseWriter, data interface{}, statusCode int)
 }
 
 func (app *App) SetPostgresRepository() error {
-	repo, err := database.NewPostgresRepository()
+	repo, err := database.NewPostgresRepository(app.Config.Database)
 	if err != nil {
-		log.Fatal(err)
+		app.Logger.Fatal("database connection failed", "error", err)
 		return err
 	}
-	app.Logger.Println("Initialized database")
+	app.Logger.Info("initialized database")
+	if app.Config.MigrateOnStartup {
+		migrator, err := repo.Migrator(app.Logger)
+		if err != nil {
+			return err
+		}
+		// Instances starting at the same time wait for the first one to migrate
+		if err = migrator.Up(context.Background()); err != nil {
+			return err
+		}
+	}
+	app.Metrics.RegisterDBStats(repo.Stats)
 	app.Repo = repo
 	return nil
 }
 
+// REPOSITORY=memory keeps all the data in memory, useful to run the API locally without PostGIS.
+// The data is lost when the server stops
+func (app *App) SetRepository() error {
+	if app.Config.Repository == config.REPOSITORY_MEMORY {
+		app.Repo = database.NewMemoryRepository()
+		app.Logger.Info("initialized in-memory repository")
+		return nil
+	}
+	return app.SetPostgresRepository()
+}
+
+// Keep the catalog reads in memory, CACHE_TTL=0 disables the cache
+func (app *App) SetRepositoryCache() error {
+	size, ttl := app.Config.Cache.Size, app.Config.Cache.TTL
+	if ttl == 0 {
+		app.Logger.Info("repository cache disabled")
+		return nil
+	}
+	app.Repo = repository.NewCachedRepository(app.Repo, size, ttl)
+	app.Logger.Info("caching repository reads", "size", size, "ttl", ttl.String())
+	return nil
+}
+
+func (app *App) SetStorage() error {
+	// Uploaded files are kept in the local filesystem for now, any storage.Storage can replace it
+	localStorage, err := storage.NewLocalStorage(app.Config.Media.Root, app.Config.Media.URL)
+	if err != nil {
+		// Read-only filesystems, like vercel's, can still serve everything else
+		app.Logger.Warn("uploads disabled, the media directory can't be created", "root", app.Config.Media.Root, "error", err)
+		app.Storage = storage.DisabledStorage{BaseURL: app.Config.Media.URL}
+		return nil
+	}
+	app.Storage = localStorage
+	return nil
+}
+
 func (app *App) SetRouter(router *mux.Router) error {
 	app.Router = router
 	return nil
 }
 
-func (app *App) CheckEnv() error {
-	var env = []string{"DB_USER", "DB_PASSWORD", "DB_HOST", "DB_PATH"}
-	for _, value := range env {
-		_, ok := os.LookupEnv(value)
-		if !ok {
-			return fmt.Errorf("%s environmental variable is not set", value)
-		}
+// Json lines in stderr, the requests add their own fields to it, see middleware.LogRequests
+func (app *App) SetLogger() error {
+	level, err := logging.ParseLevel(app.Config.LogLevel)
+	if err != nil {
+		return err
 	}
+	app.Logger = logging.New(os.Stderr, level)
+	logging.SetDefault(app.Logger)
 	return nil
 }
 
-func (app *App) SetLogger() error {
-	// Default logger for now
-	app.Logger = log.Default()
-	app.Logger.SetFlags(log.Ltime | log.Ldate | log.Lshortfile)
-	app.Logger.Println("Logging events in application")
+// TRACE_EXPORTER=stdout writes the spans of the requests as json lines, next to the logs
+func (app *App) SetTracing() error {
+	if app.Config.TraceExporter == config.TRACE_EXPORTER_STDOUT {
+		tracing.SetExporter(tracing.NewWriterExporter(os.Stdout))
+		app.Logger.Info("exporting traces to stdout")
+	}
 	return nil
 }
 
@@ -73,24 +149,38 @@ func (app *App) Initialize() error {
 	if err != nil {
 		return err
 	}
-	err = app.CheckEnv()
+	err = app.SetTracing()
+	if err != nil {
+		return err
+	}
+	// Secrets are redacted when the configuration is printed
+	app.Logger.Info("configuration loaded", "config", app.Config)
+	app.Metrics = metrics.New()
+	err = app.SetRepository()
+	if err != nil {
+		app.Logger.Fatal("repository setup failed", "error", err)
+		return err
+	}
+	err = app.SetRepositoryCache()
 	if err != nil {
-		app.Logger.Fatal(err)
+		app.Logger.Fatal("repository cache setup failed", "error", err)
 		return err
 	}
-	err = app.SetPostgresRepository()
+	err = app.SetStorage()
 	if err != nil {
-		app.Logger.Fatal(err)
+		app.Logger.Fatal("storage setup failed", "error", err)
 		return err
 	}
 	app.Hub = ws.NewHub()
+	app.Metrics.RegisterWebSocketClients(app.Hub.Clients)
 	go app.Hub.Run()
-	app.Logger.Println("App Initialized")
+	app.Logger.Info("app initialized")
 	return nil
 }
 
-func New() (*App, error) {
-	newApp := App{}
+// Build the app from a configuration loaded with config.Load
+func New(config *config.Config) (*App, error) {
+	newApp := App{Config: config}
 	err := newApp.Initialize()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/importer"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
+)
+
+// Page size used to read the whole catalog
+const EXPORT_PAGE_SIZE = 100
+
+// Import formats by file extension, unknown extensions need -format
+var FORMAT_EXTENSIONS = map[string]string{
+	"csv":     importer.FORMAT_CSV,
+	"geojson": importer.FORMAT_GEOJSON,
+	"json":    importer.FORMAT_JSON,
+}
+
+type exportResult struct {
+	Exported int    `json:"exported"`
+	File     string `json:"file"`
+}
+
+func exportCoffeeShops(ctx context.Context, c *cli, args []string) error {
+	return export(c, "shops export", args, "coffee shops", func(page uint64) ([]*models.CoffeeShop, error) {
+		return c.repo.GetCoffeeShops(ctx, page, EXPORT_PAGE_SIZE, nil)
+	})
+}
+
+func exportCoffeeBags(ctx context.Context, c *cli, args []string) error {
+	return export(c, "bags export", args, "coffee bags", func(page uint64) ([]*models.CoffeeBag, error) {
+		coffeeBags, err := c.repo.GetCoffeeBags(ctx, models.CoffeeBagsList{Pagination: models.Pagination{Page: page, Size: EXPORT_PAGE_SIZE}})
+		// The codes are exported instead of the display names, so the file can be imported again
+		for _, coffeeBag := range coffeeBags {
+			coffeeBag.Species = database.ChoiceCode(database.COFFEE_SPECIES, coffeeBag.Species)
+			coffeeBag.Origin = database.ChoiceCode(database.STATE_CHOICES, coffeeBag.Origin)
+			coffeeBag.Roast = database.ChoiceCode(database.ROAST_LEVELS, coffeeBag.Roast)
+			coffeeBag.Process = database.ChoiceCode(database.COFFEE_PROCESSES, coffeeBag.Process)
+		}
+		return coffeeBags, err
+	})
+}
+
+// Write every page as a single json array to -o, or to stdout without printing anything else
+func export[T any](c *cli, command string, args []string, kind string, readPage func(page uint64) ([]T, error)) error {
+	flags := c.flags(command)
+	output := flags.String("o", "", "file the json array is written to, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(flags); err != nil {
+		return err
+	}
+	items := []T{}
+	for page := uint64(0); ; page++ {
+		itemsPage, err := readPage(page)
+		if err != nil {
+			return err
+		}
+		items = append(items, itemsPage...)
+		if len(itemsPage) < EXPORT_PAGE_SIZE {
+			break
+		}
+	}
+	writer := c.out
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(items); err != nil {
+		return err
+	}
+	if *output == "" {
+		return nil
+	}
+	return c.print(exportResult{Exported: len(items), File: *output}, fmt.Sprintf("Exported %d %s to %s", len(items), kind, *output))
+}
+
+// Import coffee shops from csv, GeoJSON or json, like the files written by shops export. Ids and dates are ignored
+func importCoffeeShops(ctx context.Context, c *cli, args []string) error {
+	var options importer.Options
+	flags := c.flags("shops import")
+	flags.Float64Var(&options.Radius, "radius", importer.DEFAULT_RADIUS, "meters within which a coffee shop with the same name is the same coffee shop, 0 only matches the same location")
+	return importFile(c, flags, &options, args, "coffee shops", func(reader io.Reader, format string, options importer.Options) (*models.ImportReport, error) {
+		return importer.ImportCoffeeShops(ctx, c.repo, reader, format, options)
+	})
+}
+
+// Import coffee bags from csv or json, like the files written by bags export. Ids are ignored
+func importCoffeeBags(ctx context.Context, c *cli, args []string) error {
+	return importFile(c, c.flags("bags import"), &importer.Options{}, args, "coffee bags", func(reader io.Reader, format string, options importer.Options) (*models.ImportReport, error) {
+		return importer.ImportCoffeeBags(ctx, c.repo, reader, format, options)
+	})
+}
+
+// Invalid rows are skipped and reported, the command fails when any row wasn't imported
+func importFile(c *cli, flags *flag.FlagSet, options *importer.Options, args []string, kind string, importRows func(reader io.Reader, format string, options importer.Options) (*models.ImportReport, error)) error {
+	input := flags.String("f", "", "file to import, stdin by default")
+	format := flags.String("format", "", "csv, geojson or json, taken from the extension of -f by default, json for stdin")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "validate and match the rows without saving them")
+	flags.IntVar(&options.BatchSize, "batch-size", 0, "rows saved per transaction, 0 saves every row in a single transaction")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(flags); err != nil {
+		return err
+	}
+	v := validator.New()
+	if options.Validate(v); !v.Valid() {
+		return validationError(v)
+	}
+	if *format == "" && *input == "" {
+		*format = importer.FORMAT_JSON
+	} else if *format == "" {
+		extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(*input), "."))
+		if *format = FORMAT_EXTENSIONS[extension]; *format == "" {
+			return fmt.Errorf("the format of %s is unknown, set it with -format", *input)
+		}
+	}
+	reader := c.in
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+	report, err := importRows(reader, *format, *options)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Created %d and updated %d %s, %d of %d rows failed", report.Created, report.Updated, kind, report.Failed, report.Rows)
+	if report.DryRun {
+		text = "Dry run, nothing was saved\n" + text
+	}
+	for _, rowError := range report.Errors {
+		text += fmt.Sprintf("\n  row %d: %v", rowError.Row, rowError.Errors)
+	}
+	if err = c.print(report, text); err != nil {
+		return err
+	}
+	if report.Aborted {
+		return fmt.Errorf("%s stopped, the file couldn't be read until the end", flags.Name())
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%s failed for %d rows", flags.Name(), report.Failed)
+	}
+	return nil
+}
+
+func printStats(ctx context.Context, c *cli, args []string) error {
+	flags := c.flags("stats")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(flags); err != nil {
+		return err
+	}
+	stats, err := c.repo.GetCatalogStats(ctx)
+	if err != nil {
+		return err
+	}
+	names := []string{"Coffee shops", "Cities", "Roasters", "Coffee bags", "Coffee bags in shops", "Photos", "Users", "Staff users", "Likes"}
+	return c.print(stats, table(names, map[string]interface{}{
+		"Coffee shops":         stats.CoffeeShops,
+		"Cities":               stats.Cities,
+		"Roasters":             stats.Roasters,
+		"Coffee bags":          stats.CoffeeBags,
+		"Coffee bags in shops": stats.Availability,
+		"Photos":               stats.Photos,
+		"Users":                stats.Users,
+		"Staff users":          stats.StaffUsers,
+		"Likes":                stats.Likes,
+	}))
+}
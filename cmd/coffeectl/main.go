@@ -0,0 +1,152 @@
+// coffeectl runs operational tasks, like creating staff users or importing coffee shops, through the repository
+// layer. It reads the same configuration as the server
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+)
+
+const USAGE = `usage: coffeectl [config flags] <command> [flags]
+
+commands:
+  users create -email <email> -username <username> [-password <password>] [-staff]
+  users promote -email <email>
+  users demote -email <email>
+  users reset-password -email <email> [-password <password>]
+  tokens revoke -email <email> [-scope <scope>]
+  shops export [-o <file>]
+  shops import [-f <file>] [-format csv|geojson|json] [-dry-run] [-batch-size <n>] [-radius <meters>]
+  bags export [-o <file>]
+  bags import [-f <file>] [-format csv|json] [-dry-run] [-batch-size <n>]
+  stats
+
+Every command accepts -json to print its result as json. When -password is omitted a random password is generated
+and printed. Exports are written to stdout and imports are read from stdin unless a file is given. Imports update
+the coffee shops or coffee bags that match a row instead of creating them again.
+
+tokens revoke deletes the stored tokens, like the password reset ones. Login tokens are JWT that aren't stored, so
+they can't be revoked: they stay valid, with the staff status the user had when signing in, until they expire two
+days after the login. Rotating JWT_SECRET signs every user out.`
+
+// Command line state shared by the commands
+type cli struct {
+	repo repository.Repository
+	in   io.Reader
+	out  io.Writer
+	json bool
+}
+
+var commands = map[string]func(ctx context.Context, c *cli, args []string) error{
+	"users create":         createUser,
+	"users promote":        promoteUser,
+	"users demote":         demoteUser,
+	"users reset-password": resetPassword,
+	"tokens revoke":        revokeTokens,
+	"shops export":         exportCoffeeShops,
+	"shops import":         importCoffeeShops,
+	"bags export":          exportCoffeeBags,
+	"bags import":          importCoffeeBags,
+	"stats":                printStats,
+}
+
+func main() {
+	cfg, args, err := config.Parse(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = run(cfg, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg *config.Config, args []string) error {
+	command, args := commandName(args)
+	run, ok := commands[command]
+	if !ok {
+		return errors.New(USAGE)
+	}
+	if cfg.Repository != config.REPOSITORY_POSTGRES {
+		return fmt.Errorf("coffeectl needs REPOSITORY=%s, got %s", config.REPOSITORY_POSTGRES, cfg.Repository)
+	}
+	repo, err := database.NewPostgresRepository(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	return run(context.Background(), &cli{repo: repo, in: os.Stdin, out: os.Stdout}, args)
+}
+
+// Commands are a group and an action, like users create, except for stats
+func commandName(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	if _, ok := commands[args[0]]; ok || len(args) == 1 {
+		return args[0], args[1:]
+	}
+	return args[0] + " " + args[1], args[2:]
+}
+
+// Flags of a command, -json is available in all of them
+func (c *cli) flags(command string) *flag.FlagSet {
+	flags := flag.NewFlagSet("coffeectl "+command, flag.ContinueOnError)
+	flags.BoolVar(&c.json, "json", false, "print the result as json")
+	return flags
+}
+
+// Print the result as json with -json, otherwise print the text
+func (c *cli) print(result interface{}, text string) error {
+	if c.json {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	_, err := fmt.Fprintln(c.out, text)
+	return err
+}
+
+// Print name: value lines, aligned, in the order of names
+func table(names []string, values map[string]interface{}) string {
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(writer, "%s:\t%v\n", name, values[name])
+	}
+	writer.Flush()
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// Every flag in required must be set
+func requireFlags(flags *flag.FlagSet, required ...string) error {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var missing []string
+	for _, name := range required {
+		if !set[name] {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s requires %s", flags.Name(), strings.Join(missing, ", "))
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%s doesn't take the arguments %s", flags.Name(), strings.Join(flags.Args(), " "))
+	}
+	return nil
+}
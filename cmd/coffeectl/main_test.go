@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/utils"
+)
+
+// Run a command against repo like run does, with input as stdin, and return what it printed
+func runCommand(t *testing.T, repo repository.Repository, input string, args ...string) (string, error) {
+	t.Helper()
+	name, args := commandName(args)
+	command, ok := commands[name]
+	if !ok {
+		t.Fatalf("unknown command %q", name)
+	}
+	var out bytes.Buffer
+	err := command(context.Background(), &cli{repo: repo, in: strings.NewReader(input), out: &out}, args)
+	return out.String(), err
+}
+
+func TestCommandName(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+		rest    []string
+	}{
+		{nil, "", nil},
+		{[]string{"stats", "-json"}, "stats", []string{"-json"}},
+		{[]string{"users", "create", "-email", "a@example.com"}, "users create", []string{"-email", "a@example.com"}},
+		{[]string{"users"}, "users", []string{}},
+	}
+	for _, test := range tests {
+		command, rest := commandName(test.args)
+		if command != test.command || strings.Join(rest, " ") != strings.Join(test.rest, " ") {
+			t.Errorf("%v: expected %q %v, got %q %v", test.args, test.command, test.rest, command, rest)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	ctx := context.Background()
+	out, err := runCommand(t, repo, "", "users", "create", "-email", "barista@example.com", "-username", "barista", "-staff", "-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created userResult
+	if err = json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.GetUser(ctx, "barista@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id != user.Id || !created.IsStaff || !user.IsStaff {
+		t.Errorf("expected the staff user %s, got %+v and %+v", user.Id, created, user)
+	}
+	// The generated password is printed once and is the one stored
+	checkPassword(t, repo, "barista@example.com", created.Password)
+
+	if _, err = runCommand(t, repo, "", "users", "create", "-email", "barista@example.com", "-username", "other", "-password", "WakuWaku88"); err == nil {
+		t.Error("expected an error creating a user with a taken email")
+	}
+	_, err = runCommand(t, repo, "", "users", "create", "-email", "not an email", "-username", "other", "-password", "short")
+	if err == nil || !strings.Contains(err.Error(), "Email:") || !strings.Contains(err.Error(), "Password:") {
+		t.Errorf("expected the signup validation errors, got %v", err)
+	}
+	if _, err = runCommand(t, repo, "", "users", "create", "-staff"); err == nil || err.Error() != "coffeectl users create requires -email, -username" {
+		t.Errorf("expected the missing flags, got %v", err)
+	}
+
+	out, err = runCommand(t, repo, "", "users", "demote", "-email", "barista@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Demoting doesn't affect the logins already signed, the command says so
+	if !strings.Contains(out, "barista@example.com is no longer staff") || !strings.Contains(out, LOGIN_TOKENS_NOTE) {
+		t.Errorf("unexpected output %q", out)
+	}
+	if user, err = repo.GetUser(ctx, "barista@example.com"); err != nil || user.IsStaff {
+		t.Errorf("expected the user to be demoted, got %+v, %v", user, err)
+	}
+	if _, err = runCommand(t, repo, "", "users", "promote", "-email", "missing@example.com"); err == nil || err.Error() != "there isn't a user with the email missing@example.com" {
+		t.Errorf("expected the missing user, got %v", err)
+	}
+
+	if _, err = runCommand(t, repo, "", "users", "reset-password", "-email", "barista@example.com", "-password", "NewPassword88"); err != nil {
+		t.Fatal(err)
+	}
+	checkPassword(t, repo, "barista@example.com", "NewPassword88")
+
+	out, err = runCommand(t, repo, "", "tokens", "revoke", "-email", "barista@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Revoked 0 tokens of barista@example.com") || !strings.Contains(out, LOGIN_TOKENS_NOTE) {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func checkPassword(t *testing.T, repo repository.Repository, email string, password string) {
+	t.Helper()
+	user, err := repo.GetUser(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := utils.NewDjangoPassword(user.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password == "" || !hash.VerifyPassword(password) {
+		t.Errorf("expected the password of %s to be %q", email, password)
+	}
+}
+
+func TestImportAndExportCoffeeShops(t *testing.T) {
+	repo := database.NewMemoryRepository()
+	csv := "name,address,latitude,longitude,city\n" +
+		"Café Madrid,Av. Juárez 264,20.6747,-103.3490,Guadalajara\n" +
+		"Café Palermo,Av. Vallarta 1500,20.6740,-103.3700,Guadalajara\n" +
+		"Café Roto,Calle 1,north,-103.3700,Guadalajara\n"
+	out, err := runCommand(t, repo, csv, "shops", "import", "-format", "csv")
+	if err == nil || err.Error() != "coffeectl shops import failed for 1 rows" {
+		t.Errorf("expected the invalid row to fail the import, got %v", err)
+	}
+	if !strings.Contains(out, "Created 2 and updated 0 coffee shops, 1 of 3 rows failed") || !strings.Contains(out, "row 4:") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	// The export can be imported again, the coffee shops are updated instead of created twice
+	file := filepath.Join(t.TempDir(), "shops.json")
+	out, err = runCommand(t, repo, "", "shops", "export", "-o", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Exported 2 coffee shops to "+file+"\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	out, err = runCommand(t, repo, "", "shops", "import", "-f", file, "-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report models.ImportReport
+	if err = json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Rows != 2 || report.Updated != 2 || report.Created != 0 {
+		t.Errorf("expected both coffee shops to be updated, got %+v", report)
+	}
+
+	if _, err = runCommand(t, repo, "", "shops", "import", "-f", "shops.txt"); err == nil || err.Error() != "the format of shops.txt is unknown, set it with -format" {
+		t.Errorf("expected the unknown format, got %v", err)
+	}
+	if _, err = runCommand(t, repo, "", "shops", "import", "-radius", "5000"); err == nil || !strings.HasPrefix(err.Error(), "radius:") {
+		t.Errorf("expected the radius to be validated, got %v", err)
+	}
+	out, err = runCommand(t, repo, "", "stats", "-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats models.CatalogStats
+	if err = json.Unmarshal([]byte(out), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.CoffeeShops != 2 || stats.Cities != 1 {
+		t.Errorf("expected 2 coffee shops in 1 city, got %+v", stats)
+	}
+}
+
+func TestRun(t *testing.T) {
+	cfg := config.Default()
+	cfg.Repository = config.REPOSITORY_MEMORY
+	if err := run(cfg, []string{"users", "unknown"}); err == nil || err.Error() != USAGE {
+		t.Errorf("expected the usage, got %v", err)
+	}
+	// The memory repository would forget everything when the command ends
+	if err := run(cfg, []string{"stats"}); err == nil || !strings.HasPrefix(err.Error(), "coffeectl needs REPOSITORY=postgres") {
+		t.Errorf("expected Postgres to be required, got %v", err)
+	}
+}
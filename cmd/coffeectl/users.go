@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/utils"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
+)
+
+// Printed after revoking tokens and demoting users, the logins already signed aren't affected
+const LOGIN_TOKENS_NOTE = "Login tokens can't be revoked, they stay valid until they expire. Rotate JWT_SECRET to sign every user out"
+
+const (
+	GENERATED_PASSWORD_LENGTH = 16
+	PASSWORD_CHARS            = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+type userResult struct {
+	Id       string `json:"id,omitempty"`
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
+	IsStaff  bool   `json:"isStaff"`
+	// Only present when it was generated
+	Password string `json:"password,omitempty"`
+}
+
+func createUser(ctx context.Context, c *cli, args []string) error {
+	flags := c.flags("users create")
+	email := flags.String("email", "", "email of the user")
+	username := flags.String("username", "", "username of the user")
+	password := flags.String("password", "", "password of the user, generated when omitted")
+	staff := flags.Bool("staff", false, "make the user staff")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(flags, "email", "username"); err != nil {
+		return err
+	}
+	// Staff users are created in the same insert, a failure can't leave a user without the staff flag
+	signUp := models.SignUpRequest{Email: *email, Username: *username, Password: *password, IsStaff: *staff}
+	result := userResult{Email: *email, Username: *username, IsStaff: *staff}
+	if signUp.Password == "" {
+		generated, err := generatePassword(*email)
+		if err != nil {
+			return err
+		}
+		signUp.Password, result.Password = generated, generated
+	}
+	signUp.PasswordConfirmation = signUp.Password
+	// The same rules as signing up through the API
+	v := validator.New()
+	if validator.ValidateUserSignup(v, &signUp); !v.Valid() {
+		return validationError(v)
+	}
+	hashedPassword, err := utils.GenerateDjangoHashedPassword(signUp.Password)
+	if err != nil {
+		return err
+	}
+	signUp.HashedPassword = hashedPassword
+	if err = c.repo.RegisterUser(ctx, &signUp); err != nil {
+		return err
+	}
+	user, err := c.repo.GetUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	result.Id = user.Id
+	text := fmt.Sprintf("Created user %s with id %s", *email, user.Id)
+	if *staff {
+		text = fmt.Sprintf("Created staff user %s with id %s", *email, user.Id)
+	}
+	return c.print(result, withPassword(text, result.Password))
+}
+
+func promoteUser(ctx context.Context, c *cli, args []string) error {
+	return setStaff(ctx, c, "users promote", args, true)
+}
+
+func demoteUser(ctx context.Context, c *cli, args []string) error {
+	return setStaff(ctx, c, "users demote", args, false)
+}
+
+func setStaff(ctx context.Context, c *cli, command string, args []string, isStaff bool) error {
+	flags := c.flags(command)
+	email := flags.String("email", "", "email of the user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(flags, "email"); err != nil {
+		return err
+	}
+	if err := c.repo.SetUserStaff(ctx, *email, isStaff); err != nil {
+		return userError(err, *email)
+	}
+	text := fmt.Sprintf("%s is now staff", *email)
+	if !isStaff {
+		text = fmt.Sprintf("%s is no longer staff\n%s", *email, LOGIN_TOKENS_NOTE)
+	}
+	return c.print(userResult{Email: *email, IsStaff: isStaff}, text)
+}
+
+func resetPassword(ctx context.Context, c *cli, args []string) error {
+	flags := c.flags("users reset-password")
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "new password, generated when omitted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(flags, "email"); err != nil {
+		return err
+	}
+	user, err := c.repo.GetUser(ctx, *email)
+	if err != nil {
+		return userError(err, *email)
+	}
+	result := userResult{Id: user.Id, Email: *email, IsStaff: user.IsStaff}
+	newPassword := *password
+	if newPassword == "" {
+		if newPassword, err = generatePassword(*email); err != nil {
+			return err
+		}
+		result.Password = newPassword
+	}
+	v := validator.New()
+	if validator.ValidateUserSignup(v, &models.SignUpRequest{Email: *email, Password: newPassword, PasswordConfirmation: newPassword}); !v.Valid() {
+		return validationError(v)
+	}
+	hashedPassword, err := utils.GenerateDjangoHashedPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err = c.repo.UpdateUserPassword(ctx, *email, hashedPassword); err != nil {
+		return userError(err, *email)
+	}
+	return c.print(result, withPassword("Changed the password of "+*email, result.Password))
+}
+
+type revokeResult struct {
+	Email string `json:"email"`
+	Scope string `json:"scope,omitempty"`
+	// Number of tokens deleted
+	Revoked int64 `json:"revoked"`
+}
+
+// Stored tokens, like the password reset ones, are deleted. Login tokens are JWT that aren't stored, they can't be
+// revoked and expire on their own
+func revokeTokens(ctx context.Context, c *cli, args []string) error {
+	flags := c.flags("tokens revoke")
+	email := flags.String("email", "", "email of the user")
+	scope := flags.String("scope", "", "only revoke the tokens of this scope, like password-reset")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(flags, "email"); err != nil {
+		return err
+	}
+	user, err := c.repo.GetUser(ctx, *email)
+	if err != nil {
+		return userError(err, *email)
+	}
+	revoked, err := c.repo.DeleteUserTokens(ctx, user.Id, *scope)
+	if err != nil {
+		return err
+	}
+	return c.print(revokeResult{Email: *email, Scope: *scope, Revoked: revoked}, fmt.Sprintf("Revoked %d tokens of %s\n%s", revoked, *email, LOGIN_TOKENS_NOTE))
+}
+
+// Random passwords that pass the signup rules
+func generatePassword(email string) (string, error) {
+	for {
+		password, err := utils.GenerateRandomString(GENERATED_PASSWORD_LENGTH, PASSWORD_CHARS)
+		if err != nil {
+			return "", err
+		}
+		v := validator.New()
+		if validator.ValidateUserSignup(v, &models.SignUpRequest{Email: email, Password: password, PasswordConfirmation: password}); v.Valid() {
+			return password, nil
+		}
+		// A missing email is reported once the password is validated with it
+		if _, ok := v.Errors["Password"]; !ok {
+			return password, nil
+		}
+	}
+}
+
+func withPassword(text string, password string) string {
+	if password == "" {
+		return text
+	}
+	return text + "\nPassword: " + password
+}
+
+func userError(err error, email string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("there isn't a user with the email %s", email)
+	}
+	return err
+}
+
+func validationError(v *validator.Validator) error {
+	var problems []string
+	for field, message := range v.Errors {
+		problems = append(problems, field+": "+message)
+	}
+	sort.Strings(problems)
+	return errors.New(strings.Join(problems, "\n"))
+}
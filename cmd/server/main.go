@@ -0,0 +1,100 @@
+// Standalone server for the API, for self hosting and containers. It serves the same routes as the vercel handler.
+// The migrate subcommand applies the migrations embedded in the binary
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	_ "github.com/EduardoZepeda/go-coffee-api/docs"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/router"
+)
+
+// Time given to the requests in flight to finish after SIGTERM
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
+func main() {
+	cfg, args, err := config.Parse(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args) > 0 {
+		if args[0] != "migrate" {
+			log.Fatalf("unknown command %s, the only command is migrate", args[0])
+		}
+		if err = migrate(cfg, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	app, err := application.New(cfg)
+	if err != nil {
+		log.Fatal("Server couldn't start")
+	}
+	server := newServer(app)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		app.Logger.Fatal("server failed", "error", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err = serve(ctx, app, server, listener); err != nil {
+		app.Logger.Fatal("server failed", "error", err)
+	}
+}
+
+func newServer(app *application.App) *http.Server {
+	server := &http.Server{
+		Addr:              net.JoinHostPort("", strconv.Itoa(app.Config.Port)),
+		Handler:           router.New(app),
+		ReadHeaderTimeout: 5 * time.Second,
+		// Photos and profile pictures are uploaded in the body
+		ReadTimeout:  time.Minute,
+		WriteTimeout: time.Minute,
+		IdleTimeout:  2 * time.Minute,
+		ErrorLog:     app.Logger.StdLogger(logging.LEVEL_ERROR),
+	}
+	// WebSocket connections are hijacked, Shutdown doesn't wait for them
+	server.RegisterOnShutdown(app.Hub.Close)
+	return server
+}
+
+// Serve until ctx is done, then wait for the requests in flight and close the repository
+func serve(ctx context.Context, app *application.App, server *http.Server, listener net.Listener) error {
+	serverErrors := make(chan error, 1)
+	go func() {
+		app.Logger.Info("listening", "address", listener.Addr().String())
+		serverErrors <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serverErrors:
+		return err
+	case <-ctx.Done():
+	}
+	app.Logger.Info("shutting down, waiting for the requests in flight")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		app.Logger.Error("shutdown failed", "error", err)
+	}
+	if err := <-serverErrors; !errors.Is(err, http.ErrServerClosed) {
+		app.Logger.Error("server failed", "error", err)
+	}
+	if err := app.Repo.Close(); err != nil {
+		app.Logger.Error("closing the repository failed", "error", err)
+	}
+	app.Logger.Info("server stopped")
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	"github.com/gorilla/websocket"
+)
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	cfg := config.Default()
+	cfg.Repository = config.REPOSITORY_MEMORY
+	cfg.JWTSecret = "server-secret"
+	cfg.Media.Root = t.TempDir()
+	app, err := application.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(app)
+	// A request still running when the shutdown starts, and the websocket route that isn't mounted by the router
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := http.NewServeMux()
+	handler.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.Write([]byte("done"))
+	})
+	handler.HandleFunc("/ws", app.Hub.HandleWebSocket)
+	server.Handler = handler
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- serve(ctx, app, server, listener) }()
+	address := listener.Addr().String()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+address+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	slowResponse := make(chan string, 1)
+	go func() {
+		response, err := http.Get("http://" + address + "/slow")
+		if err != nil {
+			slowResponse <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		slowResponse <- string(body)
+	}()
+	<-started
+
+	cancel()
+	// The websocket clients are told the server is going away
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected the websocket to be closed with going away, got %v", err)
+	}
+	// The server waits for the request in flight
+	select {
+	case err = <-stopped:
+		t.Fatalf("the server stopped before the request in flight finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(finish)
+	if body := <-slowResponse; body != "done" {
+		t.Errorf("expected the request in flight to finish, got %q", body)
+	}
+	select {
+	case err = <-stopped:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't stop")
+	}
+	if _, err = http.Get("http://" + address + "/slow"); err == nil {
+		t.Error("expected new connections to be refused after the shutdown")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+)
+
+const MIGRATE_USAGE = "usage: server [flags] migrate up | down [steps] | status | goto <version> | force <version>"
+
+// Run the migrate subcommand with the embedded migrations
+func migrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(MIGRATE_USAGE)
+	}
+	if cfg.Repository != config.REPOSITORY_POSTGRES {
+		return fmt.Errorf("migrations need REPOSITORY=%s, got %s", config.REPOSITORY_POSTGRES, cfg.Repository)
+	}
+	repo, err := database.NewPostgresRepository(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	migrator, err := repo.Migrator(logging.Default())
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	command, args := args[0], args[1:]
+	switch {
+	case command == "up" && len(args) == 0:
+		return migrator.Up(ctx)
+	case command == "down" && len(args) <= 1:
+		steps := 1
+		if len(args) == 1 {
+			steps, err = strconv.Atoi(args[0])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("steps must be a positive integer, got %q", args[0])
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case command == "status" && len(args) == 0:
+		return printStatus(ctx, migrator)
+	case (command == "goto" || command == "force") && len(args) == 1:
+		version, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("version must be a migration number, got %q", args[0])
+		}
+		if command == "force" {
+			return migrator.Force(ctx, uint(version))
+		}
+		return migrator.Goto(ctx, uint(version))
+	}
+	return errors.New(MIGRATE_USAGE)
+}
+
+func printStatus(ctx context.Context, migrator *database.Migrator) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Version %d, latest %d\n", status.Version, status.Latest)
+	if status.Dirty {
+		fmt.Printf("Dirty: migration %d failed, fix it by hand and run migrate force <version>\n", status.Version)
+	}
+	for _, migration := range status.Applied {
+		fmt.Printf("  applied  %06d_%s\n", migration.Version, migration.Name)
+	}
+	for _, migration := range status.Pending {
+		fmt.Printf("  pending  %06d_%s\n", migration.Version, migration.Name)
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+// Package config loads the settings of the API. Every setting has a default value that can be overridden by a
+// config file, then by an environmental variable and finally by a command line flag.
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+)
+
+const (
+	MODE_DEV  = "dev"
+	MODE_PROD = "prod"
+
+	REPOSITORY_POSTGRES = "postgres"
+	REPOSITORY_MEMORY   = "memory"
+
+	TRACE_EXPORTER_NONE   = "none"
+	TRACE_EXPORTER_STDOUT = "stdout"
+)
+
+var SSL_MODES = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// A value that must never be logged, like passwords and signing keys
+type Secret string
+
+const REDACTED = "[REDACTED]"
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return REDACTED
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type DatabaseConfig struct {
+	User     string
+	Password Secret
+	// host:port
+	Host            string
+	Name            string
+	SSLMode         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Connection url for lib/pq, it contains the password and must not be logged
+func (db DatabaseConfig) URL() string {
+	q := make(url.Values)
+	q.Set("sslmode", db.SSLMode)
+	q.Set("timezone", "utc")
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(db.User, db.Password.Value()),
+		Host:     db.Host,
+		Path:     db.Name,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+type CacheConfig struct {
+	// Max number of cached reads
+	Size int
+	// 0 disables the cache
+	TTL time.Duration
+}
+
+// Requests allowed to each client ip, refilled at Requests per second up to Burst
+type RateLimitConfig struct {
+	Requests float64
+	Burst    int
+}
+
+type MediaConfig struct {
+	// Directory where the uploaded images are saved
+	Root string
+	// Url the images are served from
+	URL string
+}
+
+type Config struct {
+	Mode string
+	// Port of the standalone server
+	Port      int
+	JWTSecret Secret
+	// Bearer token of the scrapers of /api/v1/metrics, without it only staff users can read the metrics
+	MetricsToken Secret
+	Repository   string
+	// Lowest level of the logs that are written: debug, info, warn or error
+	LogLevel string
+	// Where the spans of the requests are sent: none or stdout
+	TraceExporter string
+	// Apply the pending migrations before serving requests
+	MigrateOnStartup bool
+	Database         DatabaseConfig
+	Cache            CacheConfig
+	Media            MediaConfig
+	RateLimit        RateLimitConfig
+}
+
+func Default() *Config {
+	return &Config{
+		Mode:          MODE_PROD,
+		Port:          8080,
+		Repository:    REPOSITORY_POSTGRES,
+		LogLevel:      "info",
+		TraceExporter: TRACE_EXPORTER_NONE,
+		Database: DatabaseConfig{
+			SSLMode:         "require",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: time.Minute,
+		},
+		Cache:     CacheConfig{Size: repository.DEFAULT_CACHE_SIZE, TTL: repository.DEFAULT_CACHE_TTL},
+		Media:     MediaConfig{Root: "media", URL: "/api/v1/media/"},
+		RateLimit: RateLimitConfig{Requests: 2, Burst: 4},
+	}
+}
+
+// A setting read from the environmental variable Name, the key Name of the config file and the flag Flag
+type setting struct {
+	Name  string
+	Flag  string
+	Usage string
+	set   func(config *Config, value string) error
+}
+
+func stringSetting(field func(config *Config) *string) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+func intSetting(field func(config *Config) *int) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be an integer, got %q", value)
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func floatSetting(field func(config *Config) *float64) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number, got %q", value)
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func durationSetting(field func(config *Config) *time.Duration) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration like 30s or 5m, got %q", value)
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func boolSetting(field func(config *Config) *bool) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func secretSetting(field func(config *Config) *Secret) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		*field(config) = Secret(value)
+		return nil
+	}
+}
+
+var settings = []setting{
+	{"MODE", "mode", "dev or prod", stringSetting(func(c *Config) *string { return &c.Mode })},
+	{"PORT", "port", "port of the standalone server", intSetting(func(c *Config) *int { return &c.Port })},
+	{"JWT_SECRET", "jwt-secret", "key used to sign the tokens", secretSetting(func(c *Config) *Secret { return &c.JWTSecret })},
+	{"METRICS_TOKEN", "metrics-token", "bearer token that can read /api/v1/metrics, besides the staff users", secretSetting(func(c *Config) *Secret { return &c.MetricsToken })},
+	{"REPOSITORY", "repository", "postgres or memory", stringSetting(func(c *Config) *string { return &c.Repository })},
+	{"LOG_LEVEL", "log-level", "debug, info, warn or error", stringSetting(func(c *Config) *string { return &c.LogLevel })},
+	{"TRACE_EXPORTER", "trace-exporter", "none or stdout", stringSetting(func(c *Config) *string { return &c.TraceExporter })},
+	{"MIGRATE_ON_STARTUP", "migrate-on-startup", "apply the pending migrations before serving requests", boolSetting(func(c *Config) *bool { return &c.MigrateOnStartup })},
+	{"DB_USER", "db-user", "database user", stringSetting(func(c *Config) *string { return &c.Database.User })},
+	{"DB_PASSWORD", "db-password", "database password", secretSetting(func(c *Config) *Secret { return &c.Database.Password })},
+	{"DB_HOST", "db-host", "database host:port", stringSetting(func(c *Config) *string { return &c.Database.Host })},
+	{"DB_PATH", "db-path", "database name", stringSetting(func(c *Config) *string { return &c.Database.Name })},
+	{"DB_SSLMODE", "db-sslmode", "sslmode of the database connection", stringSetting(func(c *Config) *string { return &c.Database.SSLMode })},
+	{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "max open database connections, 0 is unlimited", intSetting(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+	{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "max idle database connections", intSetting(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+	{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "max lifetime of a database connection, 0 reuses them forever", durationSetting(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+	{"CACHE_SIZE", "cache-size", "max number of cached repository reads", intSetting(func(c *Config) *int { return &c.Cache.Size })},
+	{"CACHE_TTL", "cache-ttl", "expiration of the cached repository reads, 0 disables the cache", durationSetting(func(c *Config) *time.Duration { return &c.Cache.TTL })},
+	{"MEDIA_ROOT", "media-root", "directory of the uploaded images", stringSetting(func(c *Config) *string { return &c.Media.Root })},
+	{"MEDIA_URL", "media-url", "base url of the uploaded images", stringSetting(func(c *Config) *string { return &c.Media.URL })},
+	{"RATE_LIMIT", "rate-limit", "requests per second allowed to each client ip", floatSetting(func(c *Config) *float64 { return &c.RateLimit.Requests })},
+	{"RATE_LIMIT_BURST", "rate-limit-burst", "requests a client ip can make at once", intSetting(func(c *Config) *int { return &c.RateLimit.Burst })},
+}
+
+// Every problem found in the configuration, so they can be fixed at once
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// Load the configuration from the file at -config or CONFIG_FILE, the environment and the command line arguments.
+// args doesn't include the program name, it's nil when there are no flags
+func Load(args []string) (*Config, error) {
+	config, rest, err := Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected arguments %s", strings.Join(rest, " "))
+	}
+	return config, nil
+}
+
+// Like Load, but the arguments after the flags are returned, for subcommands. Subcommands, like the migrations or
+// the commands of coffeectl, don't serve the API, so the settings only used to serve it aren't required for them
+func Parse(args []string) (*Config, []string, error) {
+	flags := flag.NewFlagSet("go-coffee-api", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "optional file with KEY=value lines, using the names of the environmental variables")
+	values := make(map[string]*string, len(settings))
+	for _, setting := range settings {
+		values[setting.Name] = flags.String(setting.Flag, "", setting.Usage+" ("+setting.Name+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	config := Default()
+	var problems ValidationError
+	apply := func(source string, name string, value string) {
+		for _, setting := range settings {
+			if setting.Name == name {
+				if err := setting.set(config, value); err != nil {
+					problems = append(problems, fmt.Sprintf("%s %s %v", source, name, err))
+				}
+				return
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s has an unknown setting %s", source, name))
+	}
+	if *configFile != "" {
+		fileValues, err := readFile(*configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, setting := range settings {
+			if value, ok := fileValues[setting.Name]; ok {
+				apply(*configFile, setting.Name, value)
+				delete(fileValues, setting.Name)
+			}
+		}
+		for name := range fileValues {
+			apply(*configFile, name, "")
+		}
+	}
+	for _, setting := range settings {
+		if value, ok := os.LookupEnv(setting.Name); ok {
+			apply("environmental variable", setting.Name, value)
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, setting := range settings {
+			if setting.Flag == f.Name {
+				apply("flag -"+f.Name+" for", setting.Name, *values[setting.Name])
+			}
+		}
+	})
+	problems = append(problems, config.validate(len(flags.Args()) == 0)...)
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+	return config, flags.Args(), nil
+}
+
+// Read KEY=value lines, blank lines and lines starting with # are ignored
+func readFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the config file: %w", err)
+	}
+	defer file.Close()
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d must be a KEY=value line", path, number)
+		}
+		values[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values, scanner.Err()
+}
+
+// Find every invalid setting. serving is false for subcommands, which never sign tokens
+func (config *Config) validate(serving bool) ValidationError {
+	var problems ValidationError
+	check := func(valid bool, format string, args ...interface{}) {
+		if !valid {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(config.Mode == MODE_DEV || config.Mode == MODE_PROD, "MODE must be %s or %s, got %q", MODE_DEV, MODE_PROD, config.Mode)
+	check(config.Port > 0 && config.Port <= 65535, "PORT must be between 1 and 65535, got %d", config.Port)
+	check(config.JWTSecret != "" || !serving, "JWT_SECRET is required")
+	check(config.Repository == REPOSITORY_POSTGRES || config.Repository == REPOSITORY_MEMORY, "REPOSITORY must be %s or %s, got %q", REPOSITORY_POSTGRES, REPOSITORY_MEMORY, config.Repository)
+	_, err := logging.ParseLevel(config.LogLevel)
+	check(err == nil, "LOG_LEVEL must be debug, info, warn or error, got %q", config.LogLevel)
+	check(config.TraceExporter == TRACE_EXPORTER_NONE || config.TraceExporter == TRACE_EXPORTER_STDOUT, "TRACE_EXPORTER must be %s or %s, got %q", TRACE_EXPORTER_NONE, TRACE_EXPORTER_STDOUT, config.TraceExporter)
+	// The database isn't used by the in-memory repository
+	if config.Repository == REPOSITORY_POSTGRES {
+		database := config.Database
+		check(database.User != "", "DB_USER is required")
+		check(database.Password != "", "DB_PASSWORD is required")
+		check(database.Host != "", "DB_HOST is required")
+		check(database.Name != "", "DB_PATH is required")
+		check(contains(SSL_MODES, database.SSLMode), "DB_SSLMODE must be one of %s, got %q", strings.Join(SSL_MODES, ", "), database.SSLMode)
+		check(database.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS can't be negative, got %d", database.MaxOpenConns)
+		check(database.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS can't be negative, got %d", database.MaxIdleConns)
+		check(database.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME can't be negative, got %s", database.ConnMaxLifetime)
+	}
+	check(config.Cache.Size > 0, "CACHE_SIZE must be a positive integer, got %d", config.Cache.Size)
+	check(config.Cache.TTL >= 0, "CACHE_TTL can't be negative, got %s", config.Cache.TTL)
+	check(config.Media.Root != "", "MEDIA_ROOT can't be empty")
+	// Without a host the images are served by the api from the path of the url, which can't hide its routes
+	mediaURL, err := url.Parse(config.Media.URL)
+	validMediaURL := err == nil && (mediaURL.Host != "" || (strings.HasPrefix(mediaURL.Path, "/") && mediaURL.Path != "/" && strings.TrimSuffix(mediaURL.Path, "/") != "/api/v1"))
+	check(validMediaURL, "MEDIA_URL must be an absolute url or a path other than / and /api/v1/, got %q", config.Media.URL)
+	check(config.RateLimit.Requests > 0, "RATE_LIMIT must be a positive number, got %v", config.RateLimit.Requests)
+	check(config.RateLimit.Burst > 0, "RATE_LIMIT_BURST must be a positive integer, got %d", config.RateLimit.Burst)
+	return problems
+}
+
+func contains(list []string, item string) bool {
+	for _, value := range list {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Clear the settings of the environment for the test, so only the ones it sets are used
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, setting := range settings {
+		if value, ok := os.LookupEnv(setting.Name); ok {
+			t.Setenv(setting.Name, value)
+			os.Unsetenv(setting.Name)
+		}
+	}
+	t.Setenv("CONFIG_FILE", "")
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PORT", "http")
+	t.Setenv("MODE", "staging")
+	t.Setenv("CACHE_TTL", "-1s")
+	_, err := Load([]string{"-log-level", "verbose"})
+	problems, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	expected := []string{
+		"environmental variable PORT must be an integer",
+		"MODE must be dev or prod",
+		"JWT_SECRET is required",
+		"LOG_LEVEL must be debug, info, warn or error",
+		"DB_USER is required",
+		"DB_PASSWORD is required",
+		"DB_HOST is required",
+		"DB_PATH is required",
+		"CACHE_TTL can't be negative",
+	}
+	for _, problem := range expected {
+		if !strings.Contains(problems.Error(), problem) {
+			t.Errorf("expected the problem %q in:\n%s", problem, problems.Error())
+		}
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("expected %d problems, got %d:\n%s", len(expected), len(problems), problems.Error())
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	file := filepath.Join(t.TempDir(), "config")
+	content := "# Local settings\nREPOSITORY=memory\nJWT_SECRET=from-file\nPORT=3000\nLOG_LEVEL=debug\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PORT", "4000")
+	t.Setenv("LOG_LEVEL", "warn")
+	config, err := Load([]string{"-config", file, "-log-level", "error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.JWTSecret.Value() != "from-file" || config.Port != 4000 || config.LogLevel != "error" {
+		t.Errorf("expected the flags to override the environment and the environment the file, got %+v", config)
+	}
+}
+
+func TestParseSubcommandsDontNeedTheJWTSecret(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("REPOSITORY", "memory")
+	config, args, err := Parse([]string{"-port", "3000", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != 3000 || strings.Join(args, " ") != "migrate up" {
+		t.Errorf("expected the subcommand after the flags, got %v and %+v", args, config)
+	}
+	if _, _, err = Parse(nil); err == nil || !strings.Contains(err.Error(), "JWT_SECRET is required") {
+		t.Errorf("expected the secret to be required to serve the API, got %v", err)
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	config := Default()
+	config.JWTSecret = "jwt-secret-value"
+	config.Database.Password = "database-password-value"
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string]string{
+		"%v":   fmt.Sprintf("%v", config),
+		"%+v":  fmt.Sprintf("%+v", config),
+		"%#v":  fmt.Sprintf("%#v", *config),
+		"%s":   fmt.Sprintf("%s", config.JWTSecret),
+		"json": string(encoded),
+	}
+	for format, output := range outputs {
+		if strings.Contains(output, "jwt-secret-value") || strings.Contains(output, "database-password-value") {
+			t.Errorf("%s: expected the secrets to be redacted, got %s", format, output)
+		}
+		if !strings.Contains(output, REDACTED) {
+			t.Errorf("%s: expected %s in %s", format, REDACTED, output)
+		}
+	}
+	if config.JWTSecret.Value() != "jwt-secret-value" {
+		t.Errorf("expected Value to return the secret, got %q", config.JWTSecret.Value())
+	}
+	if !strings.Contains(config.Database.URL(), "database-password-value") {
+		t.Error("expected the connection url to include the password")
+	}
+}
@@ -41,3 +41,46 @@ var COFFEE_SPECIES = map[string]string{
 	"Lb": "Libérica",
 	"Ex": "Excelsa",
 }
+
+var ROAST_LEVELS = map[string]string{
+	"Li": "Clara",
+	"Me": "Media",
+	"MD": "Media oscura",
+	"Da": "Oscura",
+}
+
+var COFFEE_PROCESSES = map[string]string{
+	"Wa": "Lavado",
+	"Na": "Natural",
+	"Ho": "Honey",
+	"An": "Anaeróbico",
+}
+
+// Valid values for the sort parameter of the coffee bags list, a leading minus sign means descending order
+var COFFEE_BAG_SORTING = map[string]string{
+	"id":        "id ASC",
+	"-id":       "id DESC",
+	"brand":     "brand ASC",
+	"-brand":    "brand DESC",
+	"price":     "price ASC NULLS LAST",
+	"-price":    "price DESC NULLS LAST",
+	"altitude":  "altitude ASC NULLS LAST",
+	"-altitude": "altitude DESC NULLS LAST",
+}
+
+var STOCK_STATUSES = map[string]string{
+	"IS": "En existencia",
+	"LS": "Pocas piezas",
+	"OS": "Agotado",
+}
+
+// Code of a display name of one of the choices above, the reads of coffee bags return the display names. Unknown
+// names are returned as they are
+func ChoiceCode(choices map[string]string, name string) string {
+	for code, displayName := range choices {
+		if displayName == name {
+			return code
+		}
+	}
+	return name
+}
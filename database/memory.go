@@ -0,0 +1,1052 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/migrations"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/schedule"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/lib/pq"
+)
+
+// Mean radius of the earth used by ST_DistanceSphere, in meters
+const EARTH_RADIUS = 6371008.0
+
+type memoryUser struct {
+	models.GetUserResponse
+	Password string
+	IsStaff  bool
+}
+
+// Repository that keeps everything in memory, used by unit tests and to run the API without PostGIS.
+// It follows the behavior of PostgresRepository, including its error messages and ordering. Models are copied
+// on the way in and out, so callers can't modify the stored data
+type MemoryRepository struct {
+	mu           sync.RWMutex
+	lastIds      map[string]uint64
+	shops        map[string]*models.CoffeeShop
+	openingHours map[string]*models.OpeningHours
+	photos       map[string]*models.ShopPhoto
+	users        map[string]*memoryUser
+	follows      []*models.FollowUnfollowRequest
+	likes        []*models.LikeUnlikeCoffeeShopRequest
+	coffeeBags   map[string]*models.CoffeeBag
+	availability []*models.CoffeeBagAvailability
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		lastIds:      make(map[string]uint64),
+		shops:        make(map[string]*models.CoffeeShop),
+		openingHours: make(map[string]*models.OpeningHours),
+		photos:       make(map[string]*models.ShopPhoto),
+		users:        make(map[string]*memoryUser),
+		coffeeBags:   make(map[string]*models.CoffeeBag),
+	}
+}
+
+// Ids are sequential by table, like bigserial columns
+func (repo *MemoryRepository) nextId(table string) string {
+	repo.lastIds[table]++
+	return strconv.FormatUint(repo.lastIds[table], 10)
+}
+
+func (repo *MemoryRepository) GetCoffeeShops(ctx context.Context, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	shops := repo.filterShops(func(shop *models.CoffeeShop) bool {
+		return repo.isOpenAt(shop.ID, openAt)
+	})
+	sort.SliceStable(shops, func(i, j int) bool {
+		if shops[i].CreatedDate.Equal(shops[j].CreatedDate) {
+			return idLess(shops[j].ID, shops[i].ID)
+		}
+		return shops[i].CreatedDate.After(shops[j].CreatedDate)
+	})
+	return copyShops(paginate(shops, page, size)), nil
+}
+
+func (repo *MemoryRepository) GetCoffeeShopById(ctx context.Context, id string) (*models.CoffeeShop, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	shop, ok := repo.shops[id]
+	if !ok {
+		return &models.CoffeeShop{}, sql.ErrNoRows
+	}
+	return copyShops([]*models.CoffeeShop{shop})[0], nil
+}
+
+func (repo *MemoryRepository) CreateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) (string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	now := time.Now()
+	shop := models.CoffeeShop{
+		ID:           repo.nextId("shops_shop"),
+		Name:         shopRequest.Name,
+		Address:      shopRequest.Address,
+		City:         shopRequest.City,
+		Roaster:      shopRequest.Roaster,
+		Location:     shopRequest.Location,
+		Rating:       shopRequest.Rating,
+		CreatedDate:  now,
+		ModifiedDate: now,
+		Version:      1,
+	}
+	repo.shops[shop.ID] = &shop
+	return shop.ID, nil
+}
+
+func (repo *MemoryRepository) ImportCoffeeShops(ctx context.Context, shops []*models.CoffeeShop, radius float64, dryRun bool) ([]string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	// A dry run imports into copies that are thrown away, like a transaction rolled back
+	if dryRun {
+		storedShops, lastIds := repo.shops, repo.lastIds
+		repo.shops, repo.lastIds = make(map[string]*models.CoffeeShop, len(storedShops)), make(map[string]uint64, len(lastIds))
+		for id, shop := range storedShops {
+			repo.shops[id] = copyShops([]*models.CoffeeShop{shop})[0]
+		}
+		for table, lastId := range lastIds {
+			repo.lastIds[table] = lastId
+		}
+		defer func() { repo.shops, repo.lastIds = storedShops, lastIds }()
+	}
+	actions := make([]string, len(shops))
+	now := time.Now()
+	for i, shop := range shops {
+		var match *models.CoffeeShop
+		for _, stored := range repo.shops {
+			if !strings.EqualFold(stored.Name, shop.Name) || sphereDistance(stored.Location, shop.Location) > radius {
+				continue
+			}
+			if match == nil || sphereDistance(stored.Location, shop.Location) < sphereDistance(match.Location, shop.Location) ||
+				(sphereDistance(stored.Location, shop.Location) == sphereDistance(match.Location, shop.Location) && idLess(stored.ID, match.ID)) {
+				match = stored
+			}
+		}
+		if match == nil {
+			actions[i] = models.IMPORT_CREATED
+			shop.ID = repo.nextId("shops_shop")
+			repo.shops[shop.ID] = &models.CoffeeShop{ID: shop.ID, Name: shop.Name, Address: shop.Address, City: shop.City, Roaster: shop.Roaster, Location: shop.Location, Rating: shop.Rating, CreatedDate: now, ModifiedDate: now, Version: 1}
+			continue
+		}
+		actions[i], shop.ID = models.IMPORT_UPDATED, match.ID
+		match.Location, match.City, match.Roaster, match.Address, match.Rating = shop.Location, shop.City, shop.Roaster, shop.Address, shop.Rating
+		match.ModifiedDate = now
+		match.Version++
+	}
+	return actions, nil
+}
+
+func (repo *MemoryRepository) UpdateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	shop, ok := repo.shops[shopRequest.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if shop.Version != shopRequest.Version {
+		return models.ErrVersionMismatch
+	}
+	shop.Name, shop.Location, shop.Address, shop.City = shopRequest.Name, shopRequest.Location, shopRequest.Address, shopRequest.City
+	shop.Rating, shop.Roaster = shopRequest.Rating, shopRequest.Roaster
+	shop.ModifiedDate = time.Now()
+	shop.Version++
+	shopRequest.Version++
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteCoffeeShop(ctx context.Context, id string, version uint64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	shop, ok := repo.shops[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if shop.Version != version {
+		return models.ErrVersionMismatch
+	}
+	delete(repo.shops, id)
+	// Everything that belongs to the shop is removed with it
+	delete(repo.openingHours, id)
+	for photoId, photo := range repo.photos {
+		if photo.CoffeeShopId == id {
+			delete(repo.photos, photoId)
+		}
+	}
+	repo.likes = filter(repo.likes, func(like *models.LikeUnlikeCoffeeShopRequest) bool { return like.ShopId != id })
+	repo.availability = filter(repo.availability, func(availability *models.CoffeeBagAvailability) bool {
+		return availability.CoffeeShopId != id
+	})
+	return nil
+}
+
+func (repo *MemoryRepository) SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	// Like plainto_tsquery, every word of the query must be present
+	words := strings.Fields(strings.ToLower(query))
+	shops := repo.filterShops(func(shop *models.CoffeeShop) bool {
+		if len(words) == 0 || !repo.isOpenAt(shop.ID, openAt) {
+			return false
+		}
+		document := strings.ToLower(shop.Name + " " + shop.Address)
+		for _, word := range words {
+			if !strings.Contains(document, word) {
+				return false
+			}
+		}
+		return true
+	})
+	sortById(shops)
+	return copyShops(paginate(shops, page, size)), nil
+}
+
+func (repo *MemoryRepository) GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	shops := repo.filterShops(func(shop *models.CoffeeShop) bool {
+		return repo.isOpenAt(shop.ID, openAt)
+	})
+	point := types.Point{float64(UserCoordinates.Latitude), float64(UserCoordinates.Longitude)}
+	sortByDistance(shops, point)
+	return copyShops(paginate(shops, 0, 10)), nil
+}
+
+func (repo *MemoryRepository) GetOpeningHours(ctx context.Context, coffeeShopIds []string) (map[string]*models.OpeningHours, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	// Past special hours are irrelevant, but yesterday's may still be running after midnight
+	yesterday := time.Now().In(schedule.Location).AddDate(0, 0, -1).Format(schedule.DATE_LAYOUT)
+	hours := make(map[string]*models.OpeningHours)
+	for _, id := range coffeeShopIds {
+		openingHours := &models.OpeningHours{CoffeeShopId: id, Weekly: []models.OpeningInterval{}, Special: []models.SpecialHours{}}
+		if stored, ok := repo.openingHours[id]; ok {
+			openingHours.Weekly = append(openingHours.Weekly, stored.Weekly...)
+			for _, special := range stored.Special {
+				if special.Date >= yesterday {
+					openingHours.Special = append(openingHours.Special, special)
+				}
+			}
+		}
+		hours[id] = openingHours
+	}
+	return hours, nil
+}
+
+func (repo *MemoryRepository) UpdateOpeningHours(ctx context.Context, openingHours *models.OpeningHours) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	shop, ok := repo.shops[openingHours.CoffeeShopId]
+	if !ok {
+		return fmt.Errorf("coffee shop %s doesn't exist", openingHours.CoffeeShopId)
+	}
+	stored := &models.OpeningHours{
+		CoffeeShopId: openingHours.CoffeeShopId,
+		Weekly:       append([]models.OpeningInterval{}, openingHours.Weekly...),
+		Special:      append([]models.SpecialHours{}, openingHours.Special...),
+	}
+	sort.SliceStable(stored.Weekly, func(i, j int) bool {
+		if stored.Weekly[i].Weekday == stored.Weekly[j].Weekday {
+			return stored.Weekly[i].Opens < stored.Weekly[j].Opens
+		}
+		return stored.Weekly[i].Weekday < stored.Weekly[j].Weekday
+	})
+	sort.SliceStable(stored.Special, func(i, j int) bool {
+		if stored.Special[i].Date == stored.Special[j].Date {
+			return stored.Special[i].Opens < stored.Special[j].Opens
+		}
+		return stored.Special[i].Date < stored.Special[j].Date
+	})
+	repo.openingHours[openingHours.CoffeeShopId] = stored
+	shop.ModifiedDate = time.Now()
+	return nil
+}
+
+func (repo *MemoryRepository) GetCoffeeShopPhotos(ctx context.Context, coffeeShopIds []string) (map[string][]*models.ShopPhoto, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	requested := make(map[string]bool, len(coffeeShopIds))
+	for _, id := range coffeeShopIds {
+		requested[id] = true
+	}
+	var photos []*models.ShopPhoto
+	for _, photo := range repo.photos {
+		if requested[photo.CoffeeShopId] {
+			photoCopy := *photo
+			photos = append(photos, &photoCopy)
+		}
+	}
+	sort.SliceStable(photos, func(i, j int) bool { return idLess(photos[i].ID, photos[j].ID) })
+	photosByShop := make(map[string][]*models.ShopPhoto)
+	for _, photo := range photos {
+		photosByShop[photo.CoffeeShopId] = append(photosByShop[photo.CoffeeShopId], photo)
+	}
+	return photosByShop, nil
+}
+
+func (repo *MemoryRepository) AddCoffeeShopPhoto(ctx context.Context, photo *models.ShopPhoto) (*models.ShopPhoto, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	shop, ok := repo.shops[photo.CoffeeShopId]
+	if !ok {
+		return photo, fmt.Errorf("coffee shop %s doesn't exist", photo.CoffeeShopId)
+	}
+	photo.ID = repo.nextId("shops_shopphoto")
+	photo.CreatedDate = time.Now()
+	stored := *photo
+	repo.photos[photo.ID] = &stored
+	shop.ModifiedDate = photo.CreatedDate
+	return photo, nil
+}
+
+func (repo *MemoryRepository) DeleteCoffeeShopPhoto(ctx context.Context, coffeeShopId string, photoId string) (*models.ShopPhoto, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	photo, ok := repo.photos[photoId]
+	if !ok || photo.CoffeeShopId != coffeeShopId {
+		return &models.ShopPhoto{}, sql.ErrNoRows
+	}
+	delete(repo.photos, photoId)
+	if shop, ok := repo.shops[coffeeShopId]; ok {
+		shop.ModifiedDate = time.Now()
+	}
+	return photo, nil
+}
+
+// Same clusters as ST_ClusterDBSCAN with minpoints 1: shops closer than the cluster distance are joined,
+// transitively, into the same cluster
+func (repo *MemoryRepository) GetCoffeeShopClusters(ctx context.Context, clustersRequest *models.CoffeeShopClustersRequest) ([]*models.CoffeeShopCluster, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	// Locations are stored as POINT(latitude longitude), so X is the latitude and Y the longitude
+	shops := repo.filterShops(func(shop *models.CoffeeShop) bool {
+		return shop.Location[0] >= clustersRequest.MinLatitude && shop.Location[0] <= clustersRequest.MaxLatitude &&
+			shop.Location[1] >= clustersRequest.MinLongitude && shop.Location[1] <= clustersRequest.MaxLongitude
+	})
+	sortById(shops)
+	distance := clusterDistance(clustersRequest.Zoom)
+	parents := make([]int, len(shops))
+	for i := range parents {
+		parents[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		for parents[i] != i {
+			parents[i] = parents[parents[i]]
+			i = parents[i]
+		}
+		return i
+	}
+	for i := range shops {
+		for j := i + 1; j < len(shops); j++ {
+			if planarDistance(shops[i].Location, shops[j].Location) <= distance {
+				parents[root(i)] = root(j)
+			}
+		}
+	}
+	var clusters []*models.CoffeeShopCluster
+	clustersByRoot := make(map[int]*models.CoffeeShopCluster)
+	for i, shop := range shops {
+		latitude, longitude := shop.Location[0], shop.Location[1]
+		cluster, ok := clustersByRoot[root(i)]
+		if !ok {
+			cluster = &models.CoffeeShopCluster{BoundingBox: models.BoundingBox{
+				MinLongitude: longitude, MinLatitude: latitude, MaxLongitude: longitude, MaxLatitude: latitude,
+			}}
+			clustersByRoot[root(i)] = cluster
+			clusters = append(clusters, cluster)
+		}
+		cluster.Count++
+		// The centroid is accumulated as a sum and divided at the end
+		cluster.Centroid[0] += latitude
+		cluster.Centroid[1] += longitude
+		cluster.MinLatitude = math.Min(cluster.MinLatitude, latitude)
+		cluster.MaxLatitude = math.Max(cluster.MaxLatitude, latitude)
+		cluster.MinLongitude = math.Min(cluster.MinLongitude, longitude)
+		cluster.MaxLongitude = math.Max(cluster.MaxLongitude, longitude)
+	}
+	for _, cluster := range clusters {
+		cluster.Centroid[0] /= float64(cluster.Count)
+		cluster.Centroid[1] /= float64(cluster.Count)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Count > clusters[j].Count })
+	return clusters, nil
+}
+
+func (repo *MemoryRepository) GetUser(ctx context.Context, email string) (*models.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	for _, user := range repo.users {
+		if user.Email == email {
+			return &models.User{Id: user.Id, Email: user.Email, Password: user.Password, IsStaff: user.IsStaff}, nil
+		}
+	}
+	return &models.User{}, sql.ErrNoRows
+}
+
+func (repo *MemoryRepository) GetUserById(ctx context.Context, id string) (*models.GetUserResponse, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	user, ok := repo.users[id]
+	if !ok {
+		return &models.GetUserResponse{}, sql.ErrNoRows
+	}
+	userCopy := user.GetUserResponse
+	return &userCopy, nil
+}
+
+func (repo *MemoryRepository) RegisterUser(ctx context.Context, user *models.SignUpRequest) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.usernameOrEmailTaken("", user.Username, user.Email) {
+		return errors.New("An user with that username or email address already exists")
+	}
+	id := repo.nextId("accounts_user")
+	repo.users[id] = &memoryUser{
+		GetUserResponse: models.GetUserResponse{Id: id, Email: user.Email, Username: user.Username, Version: 1},
+		Password:        user.HashedPassword,
+		IsStaff:         user.IsStaff,
+	}
+	return nil
+}
+
+func (repo *MemoryRepository) UpdateUser(ctx context.Context, user *models.UpdateUserRequest) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, ok := repo.users[user.Id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if stored.Version != user.Version {
+		return models.ErrVersionMismatch
+	}
+	if repo.usernameOrEmailTaken(user.Id, user.Username, "") {
+		return errors.New("An user with that username or email address already exists")
+	}
+	stored.Username, stored.Bio, stored.FirstName, stored.LastName = user.Username, user.Bio, user.FirstName, user.LastName
+	stored.Version++
+	user.Version++
+	return nil
+}
+
+func (repo *MemoryRepository) UpdateProfilePicture(ctx context.Context, userId string, image string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.ProfilePicture = image
+	user.Version++
+	return nil
+}
+
+func (repo *MemoryRepository) DeleteUser(ctx context.Context, id string, version uint64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if user.Version != version {
+		return models.ErrVersionMismatch
+	}
+	delete(repo.users, id)
+	repo.follows = filter(repo.follows, func(follow *models.FollowUnfollowRequest) bool {
+		return follow.UserFromId != id && follow.UserToId != id
+	})
+	repo.likes = filter(repo.likes, func(like *models.LikeUnlikeCoffeeShopRequest) bool { return like.UserId != id })
+	return nil
+}
+
+func (repo *MemoryRepository) SetUserStaff(ctx context.Context, email string, isStaff bool) error {
+	return repo.updateUserByEmail(email, func(user *memoryUser) { user.IsStaff = isStaff })
+}
+
+func (repo *MemoryRepository) UpdateUserPassword(ctx context.Context, email string, hashedPassword string) error {
+	return repo.updateUserByEmail(email, func(user *memoryUser) { user.Password = hashedPassword })
+}
+
+func (repo *MemoryRepository) updateUserByEmail(email string, update func(user *memoryUser)) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, user := range repo.users {
+		if user.Email == email {
+			update(user)
+			user.Version++
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// Tokens aren't kept in memory, there are never any to delete
+func (repo *MemoryRepository) DeleteUserTokens(ctx context.Context, userId string, scope string) (int64, error) {
+	return 0, nil
+}
+
+func (repo *MemoryRepository) FollowUser(ctx context.Context, followUnfollowUserRequest *models.FollowUnfollowRequest) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, follow := range repo.follows {
+		if *follow == *followUnfollowUserRequest {
+			return errors.New("You are already following this user")
+		}
+	}
+	if repo.users[followUnfollowUserRequest.UserFromId] == nil || repo.users[followUnfollowUserRequest.UserToId] == nil {
+		return errors.New("Both users must exist to follow an user")
+	}
+	follow := *followUnfollowUserRequest
+	repo.follows = append(repo.follows, &follow)
+	return nil
+}
+
+func (repo *MemoryRepository) UnfollowUser(ctx context.Context, followUnfollowUserRequest *models.FollowUnfollowRequest) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.follows = filter(repo.follows, func(follow *models.FollowUnfollowRequest) bool {
+		return *follow != *followUnfollowUserRequest
+	})
+	return nil
+}
+
+func (repo *MemoryRepository) GetUserFollowing(ctx context.Context, userId string) ([]*models.GetUserResponse, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var users []*models.GetUserResponse
+	for _, follow := range repo.follows {
+		if follow.UserFromId == userId {
+			users = append(users, repo.publicUser(follow.UserToId))
+		}
+	}
+	return users, nil
+}
+
+func (repo *MemoryRepository) GetUserFollowers(ctx context.Context, userId string) ([]*models.GetUserResponse, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var users []*models.GetUserResponse
+	for _, follow := range repo.follows {
+		if follow.UserToId == userId {
+			users = append(users, repo.publicUser(follow.UserFromId))
+		}
+	}
+	return users, nil
+}
+
+func (repo *MemoryRepository) GetLikedCoffeeShops(ctx context.Context, likes *models.LikesByUserRequest) ([]*models.CoffeeShop, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var shops []*models.CoffeeShop
+	for _, like := range repo.likes {
+		if like.UserId == likes.UserId {
+			shops = append(shops, repo.shops[like.ShopId])
+		}
+	}
+	return copyShops(paginate(shops, likes.Page, likes.Size)), nil
+}
+
+func (repo *MemoryRepository) LikeCoffeeShop(ctx context.Context, like *models.LikeUnlikeCoffeeShopRequest) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, storedLike := range repo.likes {
+		if *storedLike == *like {
+			return errors.New("You already like that coffee shop. You can't like it twice.")
+		}
+	}
+	if repo.shops[like.ShopId] == nil || repo.users[like.UserId] == nil {
+		return errors.New("The coffee shop and the user must exist to like a coffee shop")
+	}
+	storedLike := *like
+	repo.likes = append(repo.likes, &storedLike)
+	return nil
+}
+
+func (repo *MemoryRepository) UnlikeCoffeeShop(ctx context.Context, like *models.LikeUnlikeCoffeeShopRequest) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.likes = filter(repo.likes, func(storedLike *models.LikeUnlikeCoffeeShopRequest) bool {
+		return *storedLike != *like
+	})
+	return nil
+}
+
+// The actions of the feed are recorded in feeds_action by the Django application, this API never writes them.
+// Follows and likes made through it don't show up in the feed, so the feed is always empty
+func (repo *MemoryRepository) GetUserFeed(ctx context.Context, id string) ([]*models.Feed, error) {
+	return nil, nil
+}
+
+func (repo *MemoryRepository) GetCoffeeBags(ctx context.Context, CoffeeBagsList models.CoffeeBagsList) ([]*models.CoffeeBag, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	brand := strings.ToLower(CoffeeBagsList.Brand)
+	search := strings.ToLower(CoffeeBagsList.Search)
+	var coffeeBags []*models.CoffeeBag
+	for _, coffeeBag := range repo.coffeeBags {
+		lowerBrand := strings.ToLower(coffeeBag.Brand)
+		switch {
+		case CoffeeBagsList.Species != "" && coffeeBag.Species != CoffeeBagsList.Species,
+			CoffeeBagsList.Origin != "" && coffeeBag.Origin != CoffeeBagsList.Origin,
+			CoffeeBagsList.Roast != "" && coffeeBag.Roast != CoffeeBagsList.Roast,
+			CoffeeBagsList.Process != "" && coffeeBag.Process != CoffeeBagsList.Process,
+			brand != "" && !strings.HasPrefix(lowerBrand, brand),
+			search != "" && !strings.Contains(lowerBrand, search) && !containsWords(lowerBrand, search),
+			CoffeeBagsList.City != "" && !repo.soldInCity(coffeeBag.ID, CoffeeBagsList.City):
+			continue
+		}
+		coffeeBags = append(coffeeBags, coffeeBag)
+	}
+	sortCoffeeBags(coffeeBags, CoffeeBagsList.Sort)
+	coffeeBags = copyBags(paginate(coffeeBags, CoffeeBagsList.Page, CoffeeBagsList.Size))
+	for _, coffeeBag := range coffeeBags {
+		displayCoffeeBag(coffeeBag)
+		coffeeBag.Version = 0
+	}
+	return coffeeBags, nil
+}
+
+func (repo *MemoryRepository) CreateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if coffeeBag.TastingNotes == nil {
+		coffeeBag.TastingNotes = pq.StringArray{}
+	}
+	coffeeBag.ID = repo.nextId("shops_coffeebag")
+	stored := copyBags([]*models.CoffeeBag{coffeeBag})[0]
+	stored.Availability = nil
+	stored.Version = 1
+	repo.coffeeBags[coffeeBag.ID] = stored
+	return coffeeBag, nil
+}
+
+func (repo *MemoryRepository) GetCoffeeBagById(ctx context.Context, coffeeBagId string) (*models.CoffeeBag, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	coffeeBag, ok := repo.coffeeBags[coffeeBagId]
+	if !ok {
+		return &models.CoffeeBag{}, sql.ErrNoRows
+	}
+	return copyBags([]*models.CoffeeBag{coffeeBag})[0], nil
+}
+
+func (repo *MemoryRepository) ImportCoffeeBags(ctx context.Context, coffeeBags []*models.CoffeeBag, dryRun bool) ([]string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if dryRun {
+		storedBags, lastIds := repo.coffeeBags, repo.lastIds
+		repo.coffeeBags, repo.lastIds = make(map[string]*models.CoffeeBag, len(storedBags)), make(map[string]uint64, len(lastIds))
+		for id, coffeeBag := range storedBags {
+			repo.coffeeBags[id] = copyBags([]*models.CoffeeBag{coffeeBag})[0]
+		}
+		for table, lastId := range lastIds {
+			repo.lastIds[table] = lastId
+		}
+		defer func() { repo.coffeeBags, repo.lastIds = storedBags, lastIds }()
+	}
+	actions := make([]string, len(coffeeBags))
+	for i, coffeeBag := range coffeeBags {
+		if coffeeBag.TastingNotes == nil {
+			coffeeBag.TastingNotes = pq.StringArray{}
+		}
+		var match *models.CoffeeBag
+		for _, stored := range repo.coffeeBags {
+			if strings.EqualFold(stored.Brand, coffeeBag.Brand) && stored.Species == coffeeBag.Species && stored.Origin == coffeeBag.Origin &&
+				stored.Process == coffeeBag.Process && strings.EqualFold(stored.Variety, coffeeBag.Variety) && (match == nil || idLess(stored.ID, match.ID)) {
+				match = stored
+			}
+		}
+		if match == nil {
+			actions[i] = models.IMPORT_CREATED
+			coffeeBag.ID = repo.nextId("shops_coffeebag")
+			stored := copyBags([]*models.CoffeeBag{coffeeBag})[0]
+			stored.Availability = nil
+			stored.Version = 1
+			repo.coffeeBags[coffeeBag.ID] = stored
+			continue
+		}
+		actions[i], coffeeBag.ID = models.IMPORT_UPDATED, match.ID
+		updated := copyBags([]*models.CoffeeBag{coffeeBag})[0]
+		match.Roast, match.Altitude, match.TastingNotes, match.Weight, match.Price = updated.Roast, updated.Altitude, updated.TastingNotes, updated.Weight, updated.Price
+		match.Version++
+	}
+	return actions, nil
+}
+
+func (repo *MemoryRepository) UpdateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if coffeeBag.TastingNotes == nil {
+		coffeeBag.TastingNotes = pq.StringArray{}
+	}
+	stored, ok := repo.coffeeBags[coffeeBag.ID]
+	if !ok {
+		return coffeeBag, sql.ErrNoRows
+	}
+	if stored.Version != coffeeBag.Version {
+		return coffeeBag, models.ErrVersionMismatch
+	}
+	updated := copyBags([]*models.CoffeeBag{coffeeBag})[0]
+	updated.Availability = nil
+	updated.Version++
+	repo.coffeeBags[coffeeBag.ID] = updated
+	coffeeBag.Version++
+	return coffeeBag, nil
+}
+
+func (repo *MemoryRepository) DeleteCoffeeBag(ctx context.Context, coffeeBagId string, version uint64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	coffeeBag, ok := repo.coffeeBags[coffeeBagId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if coffeeBag.Version != version {
+		return models.ErrVersionMismatch
+	}
+	delete(repo.coffeeBags, coffeeBagId)
+	repo.availability = filter(repo.availability, func(availability *models.CoffeeBagAvailability) bool {
+		return availability.CoffeeBagId != coffeeBagId
+	})
+	return nil
+}
+
+func (repo *MemoryRepository) GetCoffeeBagByCoffeeShop(ctx context.Context, coffeeShopId *models.CoffeeBagByShopId) ([]*models.CoffeeBag, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var availabilities []*models.CoffeeBagAvailability
+	for _, availability := range repo.availability {
+		if availability.CoffeeShopId == coffeeShopId.CoffeeShopId {
+			availabilities = append(availabilities, availability)
+		}
+	}
+	var coffeeBags []*models.CoffeeBag
+	for _, availability := range paginate(availabilities, coffeeShopId.Page, coffeeShopId.Size) {
+		coffeeBag := copyBags([]*models.CoffeeBag{repo.coffeeBags[availability.CoffeeBagId]})[0]
+		availabilityCopy := *availability
+		availabilityCopy.CoffeeBagId, availabilityCopy.CoffeeShopId = "", ""
+		availabilityCopy.StockStatus = STOCK_STATUSES[availabilityCopy.StockStatus]
+		coffeeBag.Availability = &availabilityCopy
+		coffeeBag.Version = 0
+		displayCoffeeBag(coffeeBag)
+		coffeeBags = append(coffeeBags, coffeeBag)
+	}
+	return coffeeBags, nil
+}
+
+func (repo *MemoryRepository) GetCoffeeShopsByCoffeeBag(ctx context.Context, coffeeBagId *models.CoffeeShopsByCoffeeBagId) ([]*models.CoffeeShop, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	var shops []*models.CoffeeShop
+	for _, availability := range repo.availability {
+		if availability.CoffeeBagId == coffeeBagId.CoffeeBagId {
+			shops = append(shops, repo.shops[availability.CoffeeShopId])
+		}
+	}
+	if coffeeBagId.Coordinates == nil {
+		sort.SliceStable(shops, func(i, j int) bool { return shops[i].Name < shops[j].Name })
+		return copyShops(paginate(shops, coffeeBagId.Page, coffeeBagId.Size)), nil
+	}
+	point := types.Point{float64(coffeeBagId.Coordinates.Latitude), float64(coffeeBagId.Coordinates.Longitude)}
+	sortByDistance(shops, point)
+	shops = copyShops(paginate(shops, coffeeBagId.Page, coffeeBagId.Size))
+	for _, shop := range shops {
+		distance := sphereDistance(shop.Location, point)
+		shop.Distance = &distance
+	}
+	return shops, nil
+}
+
+func (repo *MemoryRepository) AddCoffeeBagToCoffeeShop(ctx context.Context, availability *models.CoffeeBagAvailability) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.findAvailability(availability.CoffeeBagId, availability.CoffeeShopId) != nil {
+		return errors.New("That coffee bag is already registered as a product of that coffee shop")
+	}
+	if repo.coffeeBags[availability.CoffeeBagId] == nil || repo.shops[availability.CoffeeShopId] == nil {
+		return errors.New("The coffee bag and the coffee shop must exist to register a coffee bag as a product")
+	}
+	stored := *availability
+	if stored.StockStatus == "" {
+		stored.StockStatus = "IS"
+	}
+	stored.UpdatedAt = time.Now()
+	repo.availability = append(repo.availability, &stored)
+	return nil
+}
+
+func (repo *MemoryRepository) UpdateCoffeeBagAvailability(ctx context.Context, availability *models.CoffeeBagAvailability) (*models.CoffeeBagAvailability, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored := repo.findAvailability(availability.CoffeeBagId, availability.CoffeeShopId)
+	if stored == nil {
+		return nil, sql.ErrNoRows
+	}
+	*stored = *availability
+	if stored.StockStatus == "" {
+		stored.StockStatus = "IS"
+	}
+	stored.UpdatedAt = time.Now()
+	updated := *stored
+	updated.StockStatus = STOCK_STATUSES[updated.StockStatus]
+	return &updated, nil
+}
+
+func (repo *MemoryRepository) RemoveCoffeeBagFromCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.availability = filter(repo.availability, func(availability *models.CoffeeBagAvailability) bool {
+		return availability.CoffeeBagId != coffeeBagId || availability.CoffeeShopId != coffeeShopId
+	})
+	return nil
+}
+
+func (repo *MemoryRepository) GetCatalogStats(ctx context.Context) (*models.CatalogStats, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	stats := models.CatalogStats{
+		CoffeeShops:  len(repo.shops),
+		CoffeeBags:   len(repo.coffeeBags),
+		Availability: len(repo.availability),
+		Photos:       len(repo.photos),
+		Users:        len(repo.users),
+		Likes:        len(repo.likes),
+	}
+	cities := make(map[string]bool)
+	for _, shop := range repo.shops {
+		cities[shop.City] = true
+		if shop.Roaster {
+			stats.Roasters++
+		}
+	}
+	stats.Cities = len(cities)
+	for _, user := range repo.users {
+		if user.IsStaff {
+			stats.StaffUsers++
+		}
+	}
+	return &stats, nil
+}
+
+// The in-memory repository always follows the schema of the last migration
+func (repo *MemoryRepository) SchemaVersion(ctx context.Context) (*models.SchemaVersion, error) {
+	version, err := migrations.Latest()
+	if err != nil {
+		return nil, err
+	}
+	return &models.SchemaVersion{Version: version}, nil
+}
+
+func (repo *MemoryRepository) Close() error {
+	return nil
+}
+
+// Must be called with the lock held
+func (repo *MemoryRepository) filterShops(keep func(shop *models.CoffeeShop) bool) []*models.CoffeeShop {
+	var shops []*models.CoffeeShop
+	for _, shop := range repo.shops {
+		if keep(shop) {
+			shops = append(shops, shop)
+		}
+	}
+	return shops
+}
+
+// A null openAt disables the opening hours filter
+func (repo *MemoryRepository) isOpenAt(coffeeShopId string, openAt *time.Time) bool {
+	return openAt == nil || schedule.IsOpen(repo.openingHours[coffeeShopId], *openAt)
+}
+
+func (repo *MemoryRepository) soldInCity(coffeeBagId string, city string) bool {
+	for _, availability := range repo.availability {
+		if availability.CoffeeBagId == coffeeBagId && strings.EqualFold(repo.shops[availability.CoffeeShopId].City, city) {
+			return true
+		}
+	}
+	return false
+}
+
+func (repo *MemoryRepository) findAvailability(coffeeBagId string, coffeeShopId string) *models.CoffeeBagAvailability {
+	for _, availability := range repo.availability {
+		if availability.CoffeeBagId == coffeeBagId && availability.CoffeeShopId == coffeeShopId {
+			return availability
+		}
+	}
+	return nil
+}
+
+// Usernames and emails are unique, exceptId allows an user to keep its own username
+func (repo *MemoryRepository) usernameOrEmailTaken(exceptId string, username string, email string) bool {
+	for id, user := range repo.users {
+		if id != exceptId && (user.Username == username || (email != "" && user.Email == email)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Followers and following lists don't include the version of the users
+func (repo *MemoryRepository) publicUser(id string) *models.GetUserResponse {
+	user := repo.users[id].GetUserResponse
+	user.Version = 0
+	return &user
+}
+
+// Codes are replaced by their names in the lists, like in PostgresRepository
+func displayCoffeeBag(coffeeBag *models.CoffeeBag) {
+	coffeeBag.Species = COFFEE_SPECIES[coffeeBag.Species]
+	coffeeBag.Origin = STATE_CHOICES[coffeeBag.Origin]
+	coffeeBag.Roast = ROAST_LEVELS[coffeeBag.Roast]
+	coffeeBag.Process = COFFEE_PROCESSES[coffeeBag.Process]
+}
+
+// Same order as COFFEE_BAG_SORTING, null prices and altitudes go last
+func sortCoffeeBags(coffeeBags []*models.CoffeeBag, sorting string) {
+	descending := strings.HasPrefix(sorting, "-")
+	field := strings.TrimPrefix(sorting, "-")
+	if _, ok := COFFEE_BAG_SORTING[sorting]; !ok {
+		field, descending = "id", false
+	}
+	compareNullable := func(a *float64, b *float64) (less bool, equal bool) {
+		switch {
+		case a == nil || b == nil:
+			return a != nil, a == nil && b == nil
+		case descending:
+			return *a > *b, *a == *b
+		default:
+			return *a < *b, *a == *b
+		}
+	}
+	sort.SliceStable(coffeeBags, func(i, j int) bool {
+		a, b := coffeeBags[i], coffeeBags[j]
+		switch field {
+		case "brand":
+			if a.Brand != b.Brand {
+				return (a.Brand < b.Brand) != descending
+			}
+		case "price":
+			if less, equal := compareNullable(a.Price, b.Price); !equal {
+				return less
+			}
+		case "altitude":
+			if less, equal := compareNullable(intToFloat(a.Altitude), intToFloat(b.Altitude)); !equal {
+				return less
+			}
+		default:
+			return idLess(a.ID, b.ID) != descending
+		}
+		return idLess(a.ID, b.ID)
+	})
+}
+
+func intToFloat(value *int) *float64 {
+	if value == nil {
+		return nil
+	}
+	converted := float64(*value)
+	return &converted
+}
+
+// Whole word matching, like a full text search with the simple configuration
+func containsWords(document string, query string) bool {
+	words := strings.Fields(document)
+	for _, queryWord := range strings.Fields(query) {
+		found := false
+		for _, word := range words {
+			if word == queryWord {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sortById(shops []*models.CoffeeShop) {
+	sort.SliceStable(shops, func(i, j int) bool { return idLess(shops[i].ID, shops[j].ID) })
+}
+
+// Same order as the <-> operator, the planar distance between the points
+func sortByDistance(shops []*models.CoffeeShop, point types.Point) {
+	sortById(shops)
+	sort.SliceStable(shops, func(i, j int) bool {
+		return planarDistance(shops[i].Location, point) < planarDistance(shops[j].Location, point)
+	})
+}
+
+func planarDistance(a types.Point, b types.Point) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
+
+// Distance in meters between two POINT(latitude longitude), like ST_DistanceSphere
+func sphereDistance(a types.Point, b types.Point) float64 {
+	toRadians := math.Pi / 180
+	latitudeA, latitudeB := a[0]*toRadians, b[0]*toRadians
+	deltaLatitude, deltaLongitude := latitudeB-latitudeA, (b[1]-a[1])*toRadians
+	h := math.Pow(math.Sin(deltaLatitude/2), 2) + math.Cos(latitudeA)*math.Cos(latitudeB)*math.Pow(math.Sin(deltaLongitude/2), 2)
+	return 2 * EARTH_RADIUS * math.Asin(math.Sqrt(h))
+}
+
+// Ids are numeric, "9" goes before "10"
+func idLess(a string, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func filter[T any](items []T, keep func(item T) bool) []T {
+	var kept []T
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// Same as LIMIT and OFFSET, a page out of range is empty
+func paginate[T any](items []T, page uint64, size uint64) []T {
+	offset := page * size
+	if offset >= uint64(len(items)) {
+		return nil
+	}
+	end := offset + size
+	if end > uint64(len(items)) {
+		end = uint64(len(items))
+	}
+	return items[offset:end]
+}
+
+func copyShops(shops []*models.CoffeeShop) []*models.CoffeeShop {
+	var copies []*models.CoffeeShop
+	for _, shop := range shops {
+		shopCopy := *shop
+		copies = append(copies, &shopCopy)
+	}
+	return copies
+}
+
+func copyBags(coffeeBags []*models.CoffeeBag) []*models.CoffeeBag {
+	var copies []*models.CoffeeBag
+	for _, coffeeBag := range coffeeBags {
+		coffeeBagCopy := *coffeeBag
+		coffeeBagCopy.TastingNotes = append(pq.StringArray{}, coffeeBag.TastingNotes...)
+		copies = append(copies, &coffeeBagCopy)
+	}
+	return copies
+}
@@ -0,0 +1,20 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/repository/repositorytest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		return NewMemoryRepository()
+	})
+}
+
+func TestCachedMemoryRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		return repository.NewCachedRepository(NewMemoryRepository(), repository.DEFAULT_CACHE_SIZE, repository.DEFAULT_CACHE_TTL)
+	})
+}
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/migrations"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// Key of the advisory lock held while migrating, concurrent runners wait for the lock instead of
+// applying the same migration twice
+const MIGRATIONS_LOCK_ID = 1_786_346_011
+
+// The version is kept in the same table as golang-migrate, so databases migrated with its CLI keep working
+const CREATE_SCHEMA_MIGRATIONS = "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL);"
+
+type MigrationStatus struct {
+	models.SchemaVersion
+	Latest  uint
+	Applied []*migrations.Migration
+	Pending []*migrations.Migration
+}
+
+// Applies the migrations to the database, one at a time. A migration that fails leaves the database dirty at its
+// version, it has to be fixed by hand and marked with Force before migrating again
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []*migrations.Migration
+	logger     *logging.Logger
+}
+
+func NewMigrator(db *sqlx.DB, migrationList []*migrations.Migration, logger *logging.Logger) *Migrator {
+	return &Migrator{db: db, migrations: migrationList, logger: logger}
+}
+
+// Migrator of the embedded migrations, sharing the connections of the repository
+func (repo *PostgresRepository) Migrator(logger *logging.Logger) (*Migrator, error) {
+	migrationList, err := migrations.Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(repo.db.DB, migrationList, logger), nil
+}
+
+func (repo *PostgresRepository) SchemaVersion(ctx context.Context) (*models.SchemaVersion, error) {
+	return readSchemaVersion(ctx, repo.db)
+}
+
+func readSchemaVersion(ctx context.Context, db sqlx.QueryerContext) (*models.SchemaVersion, error) {
+	var exists bool
+	// A database that was never migrated doesn't have the table
+	err := db.QueryRowxContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL;").Scan(&exists)
+	if err != nil || !exists {
+		return &models.SchemaVersion{}, err
+	}
+	var schemaVersion models.SchemaVersion
+	err = db.QueryRowxContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1;").Scan(&schemaVersion.Version, &schemaVersion.Dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.SchemaVersion{}, nil
+	}
+	return &schemaVersion, err
+}
+
+func (migrator *Migrator) latest() uint {
+	if len(migrator.migrations) == 0 {
+		return 0
+	}
+	return migrator.migrations[len(migrator.migrations)-1].Version
+}
+
+func (migrator *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	schemaVersion, err := readSchemaVersion(ctx, migrator.db)
+	if err != nil {
+		return nil, err
+	}
+	status := &MigrationStatus{SchemaVersion: *schemaVersion, Latest: migrator.latest()}
+	for _, migration := range migrator.migrations {
+		if migration.Version <= schemaVersion.Version {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status, nil
+}
+
+// Apply every pending migration
+func (migrator *Migrator) Up(ctx context.Context) error {
+	return migrator.withLock(ctx, func(conn *sqlx.Conn) error {
+		return migrator.migrateTo(ctx, conn, migrator.latest())
+	})
+}
+
+// Revert the last steps migrations
+func (migrator *Migrator) Down(ctx context.Context, steps int) error {
+	return migrator.withLock(ctx, func(conn *sqlx.Conn) error {
+		schemaVersion, err := readSchemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		var applied []uint
+		for _, migration := range migrator.migrations {
+			if migration.Version <= schemaVersion.Version {
+				applied = append(applied, migration.Version)
+			}
+		}
+		if steps > len(applied) {
+			return fmt.Errorf("can't revert %d migrations, only %d are applied", steps, len(applied))
+		}
+		var target uint
+		if steps < len(applied) {
+			target = applied[len(applied)-steps-1]
+		}
+		return migrator.migrateTo(ctx, conn, target)
+	})
+}
+
+// Apply or revert migrations until the database is at version, 0 reverts all of them
+func (migrator *Migrator) Goto(ctx context.Context, version uint) error {
+	return migrator.withLock(ctx, func(conn *sqlx.Conn) error {
+		return migrator.migrateTo(ctx, conn, version)
+	})
+}
+
+// Mark the database as being at version without running any migration, after fixing a failed one by hand
+func (migrator *Migrator) Force(ctx context.Context, version uint) error {
+	if !migrator.known(version) {
+		return fmt.Errorf("there isn't a migration with version %d", version)
+	}
+	return migrator.withLock(ctx, func(conn *sqlx.Conn) error {
+		return setSchemaVersion(ctx, conn, version, false)
+	})
+}
+
+func (migrator *Migrator) known(version uint) bool {
+	if version == 0 {
+		return true
+	}
+	for _, migration := range migrator.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Session advisory locks belong to a connection, so everything runs in the same one
+func (migrator *Migrator) withLock(ctx context.Context, migrate func(conn *sqlx.Conn) error) error {
+	conn, err := migrator.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var locked bool
+	if err = conn.QueryRowxContext(ctx, "SELECT pg_try_advisory_lock($1);", MIGRATIONS_LOCK_ID).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		migrator.logger.Info("waiting for another migration runner to finish")
+		if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", MIGRATIONS_LOCK_ID); err != nil {
+			return err
+		}
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", MIGRATIONS_LOCK_ID)
+	if _, err = conn.ExecContext(ctx, CREATE_SCHEMA_MIGRATIONS); err != nil {
+		return err
+	}
+	return migrate(conn)
+}
+
+// Must be called with the lock held
+func (migrator *Migrator) migrateTo(ctx context.Context, conn *sqlx.Conn, target uint) error {
+	schemaVersion, err := readSchemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if schemaVersion.Dirty {
+		return fmt.Errorf("the database is dirty at version %d because a migration failed, fix it by hand and run migrate force <version>", schemaVersion.Version)
+	}
+	if !migrator.known(schemaVersion.Version) {
+		return fmt.Errorf("the database is at version %d, which isn't one of the embedded migrations", schemaVersion.Version)
+	}
+	if !migrator.known(target) {
+		return fmt.Errorf("there isn't a migration with version %d", target)
+	}
+	if target == schemaVersion.Version {
+		migrator.logger.Info("the database is already at the target version", "version", target)
+		return nil
+	}
+	if target > schemaVersion.Version {
+		for _, migration := range migrator.migrations {
+			if migration.Version > schemaVersion.Version && migration.Version <= target {
+				if err = migrator.apply(ctx, conn, migration, migration.Up, migration.Version, "up"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for i := len(migrator.migrations) - 1; i >= 0; i-- {
+		migration := migrator.migrations[i]
+		if migration.Version > target && migration.Version <= schemaVersion.Version {
+			var previous uint
+			if i > 0 {
+				previous = migrator.migrations[i-1].Version
+			}
+			if err = migrator.apply(ctx, conn, migration, migration.Down, previous, "down"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The migrations manage their own transactions, the version is marked dirty until the statements succeed
+func (migrator *Migrator) apply(ctx context.Context, conn *sqlx.Conn, migration *migrations.Migration, statements string, version uint, direction string) error {
+	if err := setSchemaVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, statements); err != nil {
+		// Leave the transaction the migration opened, if any, so the connection can be reused
+		conn.ExecContext(context.Background(), "ROLLBACK;")
+		return fmt.Errorf("migration %d_%s %s failed: %w", migration.Version, migration.Name, direction, err)
+	}
+	if err := setSchemaVersion(ctx, conn, version, false); err != nil {
+		return err
+	}
+	migrator.logger.Info("migrated", "version", migration.Version, "name", migration.Name, "direction", direction)
+	return nil
+}
+
+func setSchemaVersion(ctx context.Context, conn *sqlx.Conn, version uint, dirty bool) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, "TRUNCATE schema_migrations;"); err != nil {
+		return err
+	}
+	// Like golang-migrate, a database without migrations doesn't have a row
+	if version > 0 || dirty {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2);", version, dirty); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/migrations"
+	"github.com/jmoiron/sqlx"
+)
+
+// Migrations with a gap between their versions. Applying one twice fails because the tables already exist
+var migratorTestMigrations = []*migrations.Migration{
+	{Version: 1, Name: "create_first", Up: "CREATE TABLE migrator_first (id int);", Down: "DROP TABLE migrator_first;"},
+	{Version: 3, Name: "create_second", Up: "CREATE TABLE migrator_second (id int);", Down: "DROP TABLE migrator_second;"},
+}
+
+// The statements of a migration run in one implicit transaction, the table isn't kept when the select fails
+var failingMigration = &migrations.Migration{
+	Version: 4,
+	Name:    "select_missing_column",
+	Up:      "CREATE TABLE migrator_failed (id int); SELECT missing FROM migrator_failed;",
+	Down:    "DROP TABLE migrator_failed;",
+}
+
+// Each case runs in its own schema, the Postgres url is the one of TestPostgresRepository
+func testMigrator(t *testing.T, databaseURL string) {
+	newMigrator := func(t *testing.T, schemaURL string, migrationList []*migrations.Migration) *Migrator {
+		t.Helper()
+		db, err := sqlx.Connect("postgres", schemaURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewMigrator(db, migrationList, logging.New(io.Discard, logging.LEVEL_ERROR))
+	}
+	expectVersion := func(t *testing.T, migrator *Migrator, version uint, dirty bool) {
+		t.Helper()
+		status, err := migrator.Status(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Version != version || status.Dirty != dirty {
+			t.Errorf("expected version %d with dirty %t, got %d with dirty %t", version, dirty, status.Version, status.Dirty)
+		}
+	}
+
+	t.Run("Gaps", func(t *testing.T) {
+		ctx := context.Background()
+		migrator := newMigrator(t, withSchema(t, databaseURL), migratorTestMigrations)
+		if err := migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		expectVersion(t, migrator, 3, false)
+		// Reverting one step goes back to the previous migration, not to the missing version
+		if err := migrator.Down(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		expectVersion(t, migrator, 1, false)
+		if err := migrator.Goto(ctx, 2); err == nil {
+			t.Error("expected an error migrating to a version without a migration")
+		}
+		if err := migrator.Goto(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+		expectVersion(t, migrator, 0, false)
+	})
+
+	t.Run("Dirty", func(t *testing.T) {
+		ctx := context.Background()
+		schemaURL := withSchema(t, databaseURL)
+		migrator := newMigrator(t, schemaURL, append(migratorTestMigrations, failingMigration))
+		if err := migrator.Up(ctx); err == nil || !strings.Contains(err.Error(), "4_select_missing_column up failed") {
+			t.Fatalf("expected the failing migration to be reported, got %v", err)
+		}
+		expectVersion(t, migrator, 4, true)
+		// Nothing runs until the database is fixed and forced to a version
+		if err := migrator.Up(ctx); err == nil || !strings.Contains(err.Error(), "dirty at version 4") {
+			t.Fatalf("expected the dirty database to be reported, got %v", err)
+		}
+		if err := migrator.Down(ctx, 1); err == nil || !strings.Contains(err.Error(), "dirty at version 4") {
+			t.Fatalf("expected the dirty database to be reported, got %v", err)
+		}
+		if err := migrator.Force(ctx, 2); err == nil {
+			t.Error("expected an error forcing a version without a migration")
+		}
+		if err := migrator.Force(ctx, 3); err != nil {
+			t.Fatal(err)
+		}
+		expectVersion(t, migrator, 3, false)
+		// Once the failing migration is fixed it's applied normally
+		fixed := *failingMigration
+		fixed.Up = "CREATE TABLE migrator_failed (id int);"
+		migrator = newMigrator(t, schemaURL, append(migratorTestMigrations, &fixed))
+		if err := migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+		expectVersion(t, migrator, 4, false)
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		schemaURL := withSchema(t, databaseURL)
+		db, err := sqlx.Connect("postgres", schemaURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		// Another runner holding the lock
+		conn, err := db.Connx(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err = conn.ExecContext(context.Background(), "SELECT pg_advisory_lock($1);", MIGRATIONS_LOCK_ID); err != nil {
+			t.Fatal(err)
+		}
+		migrator := newMigrator(t, schemaURL, migratorTestMigrations)
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		if err = migrator.Up(ctx); err == nil {
+			t.Fatal("expected the migrator to wait for the lock until the context is done")
+		}
+		expectVersion(t, migrator, 0, false)
+		if _, err = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", MIGRATIONS_LOCK_ID); err != nil {
+			t.Fatal(err)
+		}
+		if err = migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		expectVersion(t, migrator, 3, false)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		schemaURL := withSchema(t, databaseURL)
+		runners := []*Migrator{
+			newMigrator(t, schemaURL, migratorTestMigrations),
+			newMigrator(t, schemaURL, migratorTestMigrations),
+			newMigrator(t, schemaURL, migratorTestMigrations),
+		}
+		var wg sync.WaitGroup
+		errs := make([]error, len(runners))
+		for i, migrator := range runners {
+			wg.Add(1)
+			go func(i int, migrator *Migrator) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				errs[i] = migrator.Up(ctx)
+			}(i, migrator)
+		}
+		wg.Wait()
+		// The runners that wait find the migrations applied, none of them runs one twice
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("runner %d: %v", i, err)
+			}
+		}
+		expectVersion(t, runners[0], 3, false)
+	})
+}
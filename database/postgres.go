@@ -2,42 +2,39 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"log"
-	"net/url"
-	"os"
+	"fmt"
+	"math"
 	"strings"
 	"time"
 
+	"github.com/EduardoZepeda/go-coffee-api/config"
 	"github.com/EduardoZepeda/go-coffee-api/models"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresRepository struct {
-	db *sqlx.DB
+	db tracedDB
 }
 
-func GenerateConnectionString() url.URL {
-	q := make(url.Values)
-	q.Set("sslmode", "require")
-	q.Set("timezone", "utc")
-	u := url.URL{
-		// Remember to update environmental variables at vercel
-		Scheme:   "postgres",
-		User:     url.UserPassword(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD")),
-		Host:     os.Getenv("DB_HOST"),
-		Path:     os.Getenv("DB_PATH"),
-		RawQuery: q.Encode(),
+func NewPostgresRepository(config config.DatabaseConfig) (*PostgresRepository, error) {
+	// Remember to update environmental variables at vercel
+	repo, err := NewPostgresRepositoryFromURL(config.URL())
+	if err != nil {
+		return nil, err
 	}
-	return u
+	repo.db.SetMaxOpenConns(config.MaxOpenConns)
+	repo.db.SetMaxIdleConns(config.MaxIdleConns)
+	repo.db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	return repo, nil
 }
 
-func NewPostgresRepository() (*PostgresRepository, error) {
-	u := GenerateConnectionString()
-	db, err := sqlx.Connect("postgres", u.String())
+// Connect to the database at the given postgres:// url
+func NewPostgresRepositoryFromURL(databaseURL string) (*PostgresRepository, error) {
+	db, err := sqlx.Connect("postgres", databaseURL)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 	db.SetMaxOpenConns(25)                 // The default is 0 (unlimited)
@@ -49,21 +46,21 @@ func NewPostgresRepository() (*PostgresRepository, error) {
 
 	err = db.PingContext(ctx)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	return &PostgresRepository{db}, nil
+	return &PostgresRepository{tracedDB{db}}, nil
 }
 
-func (repo *PostgresRepository) GetCoffeeShops(ctx context.Context, page uint64, size uint64) ([]*models.CoffeeShop, error) {
+func (repo *PostgresRepository) GetCoffeeShops(ctx context.Context, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
 	var shops []*models.CoffeeShop
-	err := repo.db.SelectContext(ctx, &shops, "SELECT id, name, location, address, roaster, city, rating, created_date, modified_date FROM shops_shop ORDER BY created_date DESC LIMIT $1 OFFSET $2;", size, page*size)
+	// A null openAt disables the opening hours filter
+	err := repo.db.SelectContext(ctx, &shops, "SELECT id, name, location, address, roaster, city, rating, created_date, modified_date FROM shops_shop WHERE ($3::timestamptz IS NULL OR shop_is_open(id, $3)) ORDER BY created_date DESC LIMIT $1 OFFSET $2;", size, page*size, openAt)
 	return shops, err
 }
 
 func (repo *PostgresRepository) GetCoffeeShopById(ctx context.Context, id string) (*models.CoffeeShop, error) {
 	var shop models.CoffeeShop
-	err := repo.db.GetContext(ctx, &shop, "SELECT id, name, location, address, rating, created_date, modified_date FROM shops_shop WHERE id = $1;", id)
+	err := repo.db.GetContext(ctx, &shop, "SELECT id, name, location, address, roaster, city, rating, created_date, modified_date, version FROM shops_shop WHERE id = $1;", id)
 	return &shop, err
 }
 
@@ -73,28 +70,172 @@ func (repo *PostgresRepository) CreateCoffeeShop(ctx context.Context, shopReques
 	return id, err
 }
 
+// A coffee shop with the same name, ignoring case, within radius meters of an imported one is updated instead of
+// creating a new one. Every shop is imported in the same transaction, which is rolled back when dryRun is set
+func (repo *PostgresRepository) ImportCoffeeShops(ctx context.Context, shops []*models.CoffeeShop, radius float64, dryRun bool) ([]string, error) {
+	tx, err := repo.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	actions := make([]string, len(shops))
+	for i, shop := range shops {
+		var id string
+		err = tx.GetContext(ctx, &id, "SELECT id FROM shops_shop WHERE lower(name) = lower($1) AND ST_DistanceSphere(ST_FlipCoordinates(location), ST_FlipCoordinates($2::geometry)) <= $3 ORDER BY ST_DistanceSphere(ST_FlipCoordinates(location), ST_FlipCoordinates($2::geometry)), id LIMIT 1;", shop.Name, shop.Location, radius)
+		if errors.Is(err, sql.ErrNoRows) {
+			actions[i] = models.IMPORT_CREATED
+			err = tx.QueryRowContext(ctx, "INSERT INTO shops_shop (name, location, city, roaster, address, rating, created_date, modified_date) VALUES ($1, $2, $3, $4, $5, $6, current_timestamp, current_timestamp) RETURNING id;", shop.Name, shop.Location, shop.City, shop.Roaster, shop.Address, shop.Rating).Scan(&shop.ID)
+		} else if err == nil {
+			actions[i], shop.ID = models.IMPORT_UPDATED, id
+			_, err = tx.ExecContext(ctx, "UPDATE shops_shop SET location = $2, city = $3, roaster = $4, address = $5, rating = $6, modified_date = current_timestamp, version = version + 1 WHERE id = $1;", id, shop.Location, shop.City, shop.Roaster, shop.Address, shop.Rating)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return actions, nil
+	}
+	return actions, tx.Commit()
+}
+
 func (repo *PostgresRepository) UpdateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) error {
-	_, err := repo.db.NamedExecContext(ctx, "UPDATE shops_shop SET name = :name, location = :location, address = :address, rating = :rating, roaster = :roaster, modified_date = current_timestamp WHERE id = :id;", shopRequest)
-	return err
+	// The version is compared in the same statement, so two concurrent updates can't both succeed
+	result, err := repo.db.NamedExecContext(ctx, "UPDATE shops_shop SET name = :name, location = :location, address = :address, city = :city, rating = :rating, roaster = :roaster, modified_date = current_timestamp, version = version + 1 WHERE id = :id AND version = :version;", shopRequest)
+	if err = repo.checkVersionedWrite(ctx, result, err, "shops_shop", shopRequest.ID); err != nil {
+		return err
+	}
+	shopRequest.Version++
+	return nil
 }
 
-func (repo *PostgresRepository) DeleteCoffeeShop(ctx context.Context, id string) error {
-	_, err := repo.db.NamedExecContext(ctx, "DELETE FROM shops_shop WHERE id = :id;", map[string]interface{}{"id": id})
-	return err
+func (repo *PostgresRepository) DeleteCoffeeShop(ctx context.Context, id string, version uint64) error {
+	result, err := repo.db.ExecContext(ctx, "DELETE FROM shops_shop WHERE id = $1 AND version = $2;", id, version)
+	return repo.checkVersionedWrite(ctx, result, err, "shops_shop", id)
 }
 
-func (repo *PostgresRepository) SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64) ([]*models.CoffeeShop, error) {
+func (repo *PostgresRepository) SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
 	var cafes []*models.CoffeeShop
-	err := repo.db.SelectContext(ctx, &cafes, "SELECT id, name, location, address, roaster, rating, created_date, modified_date FROM shops_shop WHERE to_tsvector(COALESCE(LOWER(name), '') || COALESCE(LOWER(address), '') || COALESCE(LOWER(content), '')) @@ plainto_tsquery($1) LIMIT $2 OFFSET $3;", query, size, page*size)
+	err := repo.db.SelectContext(ctx, &cafes, "SELECT id, name, location, address, roaster, rating, created_date, modified_date FROM shops_shop WHERE to_tsvector(COALESCE(LOWER(name), '') || COALESCE(LOWER(address), '') || COALESCE(LOWER(content), '')) @@ plainto_tsquery($1) AND ($4::timestamptz IS NULL OR shop_is_open(id, $4)) LIMIT $2 OFFSET $3;", query, size, page*size, openAt)
 	return cafes, err
 }
 
-func (repo *PostgresRepository) GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates) ([]*models.CoffeeShop, error) {
+func (repo *PostgresRepository) GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates, openAt *time.Time) ([]*models.CoffeeShop, error) {
 	var cafes []*models.CoffeeShop
-	err := repo.db.SelectContext(ctx, &cafes, "SELECT id, name, location, address, roaster, rating, created_date, modified_date FROM shops_shop ORDER BY location <-> ST_SetSRID(ST_MakePoint($1, $2), 4326) LIMIT 10;", UserCoordinates.Latitude, UserCoordinates.Longitude)
+	err := repo.db.SelectContext(ctx, &cafes, "SELECT id, name, location, address, roaster, rating, created_date, modified_date FROM shops_shop WHERE ($3::timestamptz IS NULL OR shop_is_open(id, $3)) ORDER BY location <-> ST_SetSRID(ST_MakePoint($1, $2), 4326) LIMIT 10;", UserCoordinates.Latitude, UserCoordinates.Longitude, openAt)
 	return cafes, err
 }
 
+func (repo *PostgresRepository) GetOpeningHours(ctx context.Context, coffeeShopIds []string) (map[string]*models.OpeningHours, error) {
+	type weeklyRow struct {
+		ShopId string `db:"shop_id"`
+		models.OpeningInterval
+	}
+	type specialRow struct {
+		ShopId string `db:"shop_id"`
+		models.SpecialHours
+	}
+	hours := make(map[string]*models.OpeningHours)
+	for _, id := range coffeeShopIds {
+		hours[id] = &models.OpeningHours{CoffeeShopId: id, Weekly: []models.OpeningInterval{}, Special: []models.SpecialHours{}}
+	}
+	var weekly []weeklyRow
+	err := repo.db.SelectContext(ctx, &weekly, "SELECT shop_id, weekday, to_char(opens, 'HH24:MI') AS opens, to_char(closes, 'HH24:MI') AS closes FROM shops_openinghours WHERE shop_id = ANY($1::bigint[]) ORDER BY weekday, opens;", pq.Array(coffeeShopIds))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range weekly {
+		hours[row.ShopId].Weekly = append(hours[row.ShopId].Weekly, row.OpeningInterval)
+	}
+	// Past special hours are irrelevant, but yesterday's may still be running after midnight
+	var special []specialRow
+	err = repo.db.SelectContext(ctx, &special, "SELECT shop_id, to_char(date, 'YYYY-MM-DD') AS date, closed, COALESCE(to_char(opens, 'HH24:MI'), '') AS opens, COALESCE(to_char(closes, 'HH24:MI'), '') AS closes, description FROM shops_specialhours WHERE shop_id = ANY($1::bigint[]) AND date >= (now() AT TIME ZONE 'America/Mexico_City')::date - 1 ORDER BY date, opens;", pq.Array(coffeeShopIds))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range special {
+		hours[row.ShopId].Special = append(hours[row.ShopId].Special, row.SpecialHours)
+	}
+	return hours, nil
+}
+
+func (repo *PostgresRepository) UpdateOpeningHours(ctx context.Context, openingHours *models.OpeningHours) error {
+	// Opening hours are replaced as a whole, so a failure must not leave the shop with half of its schedule
+	tx, err := repo.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, "DELETE FROM shops_openinghours WHERE shop_id = $1;", openingHours.CoffeeShopId); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM shops_specialhours WHERE shop_id = $1;", openingHours.CoffeeShopId); err != nil {
+		return err
+	}
+	for _, interval := range openingHours.Weekly {
+		_, err = tx.ExecContext(ctx, "INSERT INTO shops_openinghours (shop_id, weekday, opens, closes) VALUES ($1, $2, $3, $4);", openingHours.CoffeeShopId, interval.Weekday, interval.Opens, interval.Closes)
+		if err != nil {
+			return err
+		}
+	}
+	for _, special := range openingHours.Special {
+		_, err = tx.ExecContext(ctx, "INSERT INTO shops_specialhours (shop_id, date, closed, opens, closes, description) VALUES ($1, $2, $3, NULLIF($4, '')::time, NULLIF($5, '')::time, $6);", openingHours.CoffeeShopId, special.Date, special.Closed, special.Opens, special.Closes, special.Description)
+		if err != nil {
+			return err
+		}
+	}
+	// The opening hours are part of the shop, its Last-Modified header must change as well
+	if _, err = tx.ExecContext(ctx, "UPDATE shops_shop SET modified_date = current_timestamp WHERE id = $1;", openingHours.CoffeeShopId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Distance in degrees under which two shops are drawn as a single marker at a given zoom level.
+// A 256px map tile covers 360/2^zoom degrees, so the clusters are roughly 60px wide on screen.
+func clusterDistance(zoom uint64) float64 {
+	return 360.0 / math.Pow(2, float64(zoom)) * 60.0 / 256.0
+}
+
+func (repo *PostgresRepository) GetCoffeeShopPhotos(ctx context.Context, coffeeShopIds []string) (map[string][]*models.ShopPhoto, error) {
+	var photos []*models.ShopPhoto
+	err := repo.db.SelectContext(ctx, &photos, "SELECT id, shop_id, image, created_date FROM shops_shopphoto WHERE shop_id = ANY($1::bigint[]) ORDER BY created_date;", pq.Array(coffeeShopIds))
+	if err != nil {
+		return nil, err
+	}
+	photosByShop := make(map[string][]*models.ShopPhoto)
+	for _, photo := range photos {
+		photosByShop[photo.CoffeeShopId] = append(photosByShop[photo.CoffeeShopId], photo)
+	}
+	return photosByShop, nil
+}
+
+func (repo *PostgresRepository) AddCoffeeShopPhoto(ctx context.Context, photo *models.ShopPhoto) (*models.ShopPhoto, error) {
+	// The photos are part of the shop, its Last-Modified header must change as well
+	err := repo.db.QueryRowContext(ctx, "WITH shop AS (UPDATE shops_shop SET modified_date = current_timestamp WHERE id = $1) INSERT INTO shops_shopphoto (shop_id, image, created_date) VALUES ($1, $2, current_timestamp) RETURNING id, created_date;", photo.CoffeeShopId, photo.Image).Scan(&photo.ID, &photo.CreatedDate)
+	return photo, err
+}
+
+func (repo *PostgresRepository) DeleteCoffeeShopPhoto(ctx context.Context, coffeeShopId string, photoId string) (*models.ShopPhoto, error) {
+	var photo models.ShopPhoto
+	// The deleted row is returned so its file can be removed from the storage
+	err := repo.db.GetContext(ctx, &photo, "WITH shop AS (UPDATE shops_shop SET modified_date = current_timestamp WHERE id = $2) DELETE FROM shops_shopphoto WHERE id = $1 AND shop_id = $2 RETURNING id, shop_id, image, created_date;", photoId, coffeeShopId)
+	return &photo, err
+}
+
+func (repo *PostgresRepository) GetCoffeeShopClusters(ctx context.Context, clustersRequest *models.CoffeeShopClustersRequest) ([]*models.CoffeeShopCluster, error) {
+	var clusters []*models.CoffeeShopCluster
+	// ST_ClusterDBSCAN with minpoints 1 assigns every shop inside the bounding box to a cluster, even the isolated ones.
+	// Locations are stored as POINT(latitude longitude), so X is the latitude and Y the longitude
+	err := repo.db.SelectContext(ctx, &clusters, `SELECT ST_Centroid(ST_Collect(location)) AS centroid, COUNT(*) AS count,
+	ST_YMin(ST_Extent(location)) AS min_longitude, ST_XMin(ST_Extent(location)) AS min_latitude,
+	ST_YMax(ST_Extent(location)) AS max_longitude, ST_XMax(ST_Extent(location)) AS max_latitude
+	FROM (SELECT location, ST_ClusterDBSCAN(location, eps := $5, minpoints := 1) OVER () AS cluster_id FROM shops_shop
+	WHERE location && ST_MakeEnvelope($1, $2, $3, $4, 4326)) AS clustered_shops GROUP BY cluster_id ORDER BY count DESC;`,
+		clustersRequest.MinLatitude, clustersRequest.MinLongitude, clustersRequest.MaxLatitude, clustersRequest.MaxLongitude, clusterDistance(clustersRequest.Zoom))
+	return clusters, err
+}
+
 func (repo *PostgresRepository) GetUser(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	err := repo.db.GetContext(ctx, &user, "SELECT id, email, password, is_staff FROM accounts_user WHERE email = $1;", email)
@@ -105,12 +246,12 @@ func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*mo
 	var user models.GetUserResponse
 	// Null values cannot be converted to string automatically, thus, we need to handle null values from db
 	// COALESCE will return the first not null value, and it must be used together with as <field>, otherwise it will fail
-	err := repo.db.GetContext(ctx, &user, "SELECT id, email, username, first_name, last_name, COALESCE(bio, '') as bio FROM accounts_user WHERE id = $1;", id)
+	err := repo.db.GetContext(ctx, &user, "SELECT id, email, username, first_name, last_name, COALESCE(bio, '') as bio, COALESCE(profile_picture, '') as profile_picture, version FROM accounts_user WHERE id = $1;", id)
 	return &user, err
 }
 
 func (repo *PostgresRepository) RegisterUser(ctx context.Context, user *models.SignUpRequest) error {
-	_, err := repo.db.ExecContext(ctx, "INSERT INTO accounts_user (is_superuser, password, username, email, is_staff, is_active, first_name, last_name, date_joined) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, current_timestamp);", false, user.HashedPassword, user.Username, user.Email, false, true, "", "")
+	_, err := repo.db.ExecContext(ctx, "INSERT INTO accounts_user (is_superuser, password, username, email, is_staff, is_active, first_name, last_name, date_joined) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, current_timestamp);", false, user.HashedPassword, user.Username, user.Email, user.IsStaff, true, "", "")
 	if err != nil {
 		// Check for user constraints on database
 		if strings.Contains(err.Error(), "accounts_user_username_key") || strings.Contains(err.Error(), "unique-email") {
@@ -121,13 +262,56 @@ func (repo *PostgresRepository) RegisterUser(ctx context.Context, user *models.S
 }
 
 func (repo *PostgresRepository) UpdateUser(ctx context.Context, user *models.UpdateUserRequest) error {
-	_, err := repo.db.NamedExecContext(ctx, "UPDATE accounts_user SET username = :Username, bio = :Bio, first_name = :FirstName, last_name = :LastName WHERE id = :Id;", user)
-	return err
+	result, err := repo.db.NamedExecContext(ctx, "UPDATE accounts_user SET username = :Username, bio = :Bio, first_name = :FirstName, last_name = :LastName, version = version + 1 WHERE id = :Id AND version = :Version;", user)
+	if err = repo.checkVersionedWrite(ctx, result, err, "accounts_user", user.Id); err != nil {
+		return err
+	}
+	user.Version++
+	return nil
 }
 
-func (repo *PostgresRepository) DeleteUser(ctx context.Context, id string) error {
-	_, err := repo.db.ExecContext(ctx, "DELETE FROM accounts_user WHERE id = $1;", id)
-	return err
+func (repo *PostgresRepository) UpdateProfilePicture(ctx context.Context, userId string, image string) error {
+	result, err := repo.db.ExecContext(ctx, "UPDATE accounts_user SET profile_picture = NULLIF($1, ''), version = version + 1 WHERE id = $2;", image, userId)
+	return checkRowsAffected(result, err)
+}
+
+func (repo *PostgresRepository) DeleteUser(ctx context.Context, id string, version uint64) error {
+	result, err := repo.db.ExecContext(ctx, "DELETE FROM accounts_user WHERE id = $1 AND version = $2;", id, version)
+	return repo.checkVersionedWrite(ctx, result, err, "accounts_user", id)
+}
+
+func (repo *PostgresRepository) SetUserStaff(ctx context.Context, email string, isStaff bool) error {
+	result, err := repo.db.ExecContext(ctx, "UPDATE accounts_user SET is_staff = $1, version = version + 1 WHERE email = $2;", isStaff, email)
+	return checkRowsAffected(result, err)
+}
+
+func (repo *PostgresRepository) UpdateUserPassword(ctx context.Context, email string, hashedPassword string) error {
+	result, err := repo.db.ExecContext(ctx, "UPDATE accounts_user SET password = $1, version = version + 1 WHERE email = $2;", hashedPassword, email)
+	return checkRowsAffected(result, err)
+}
+
+// An empty scope deletes the tokens of every scope
+func (repo *PostgresRepository) DeleteUserTokens(ctx context.Context, userId string, scope string) (int64, error) {
+	result, err := repo.db.ExecContext(ctx, "DELETE FROM tokens WHERE user_id = $1 AND ($2 = '' OR scope = $2);", userId, scope)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// sql.ErrNoRows when the statement didn't change any row
+func checkRowsAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (repo *PostgresRepository) FollowUser(ctx context.Context, followUnfollowUserRequest *models.FollowUnfollowRequest) error {
@@ -148,13 +332,13 @@ func (repo *PostgresRepository) UnfollowUser(ctx context.Context, followUnfollow
 
 func (repo *PostgresRepository) GetUserFollowing(ctx context.Context, userId string) ([]*models.GetUserResponse, error) {
 	var users []*models.GetUserResponse
-	err := repo.db.SelectContext(ctx, &users, "SELECT accounts_user.id, username, first_name, last_name, COALESCE(bio, '') as bio, email FROM accounts_user INNER JOIN accounts_contact ON accounts_contact.user_to_id = accounts_user.id WHERE accounts_contact.user_from_id = $1;", userId)
+	err := repo.db.SelectContext(ctx, &users, "SELECT accounts_user.id, username, first_name, last_name, COALESCE(bio, '') as bio, COALESCE(profile_picture, '') as profile_picture, email FROM accounts_user INNER JOIN accounts_contact ON accounts_contact.user_to_id = accounts_user.id WHERE accounts_contact.user_from_id = $1;", userId)
 	return users, err
 }
 
 func (repo *PostgresRepository) GetUserFollowers(ctx context.Context, userId string) ([]*models.GetUserResponse, error) {
 	var users []*models.GetUserResponse
-	err := repo.db.SelectContext(ctx, &users, "SELECT accounts_user.id, username, first_name, last_name, COALESCE(bio, '') as bio, email FROM accounts_user INNER JOIN accounts_contact ON accounts_contact.user_from_id = accounts_user.id WHERE accounts_contact.user_to_id = $1;", userId)
+	err := repo.db.SelectContext(ctx, &users, "SELECT accounts_user.id, username, first_name, last_name, COALESCE(bio, '') as bio, COALESCE(profile_picture, '') as profile_picture, email FROM accounts_user INNER JOIN accounts_contact ON accounts_contact.user_from_id = accounts_user.id WHERE accounts_contact.user_to_id = $1;", userId)
 	return users, err
 }
 
@@ -191,9 +375,55 @@ func (repo *PostgresRepository) GetUserFeed(ctx context.Context, id string) ([]*
 	return feed, err
 }
 
+// Escape the LIKE wildcards, so user input is always matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 func (repo *PostgresRepository) GetCoffeeBags(ctx context.Context, CoffeeBagsList models.CoffeeBagsList) ([]*models.CoffeeBag, error) {
 	var coffeeBags []*models.CoffeeBag
-	rows, err := repo.db.QueryxContext(ctx, "SELECT id, brand, species, origin FROM shops_coffeebag LIMIT $1 OFFSET $2;", CoffeeBagsList.Size, CoffeeBagsList.Page*CoffeeBagsList.Size)
+	// Only the filters present in the request are added to the query
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+	if CoffeeBagsList.Species != "" {
+		addCondition("species = ?", CoffeeBagsList.Species)
+	}
+	if CoffeeBagsList.Origin != "" {
+		addCondition("origin = ?", CoffeeBagsList.Origin)
+	}
+	if CoffeeBagsList.Roast != "" {
+		addCondition("roast = ?", CoffeeBagsList.Roast)
+	}
+	if CoffeeBagsList.Process != "" {
+		addCondition("process = ?", CoffeeBagsList.Process)
+	}
+	if CoffeeBagsList.Brand != "" {
+		addCondition("brand ILIKE ? || '%'", likeEscaper.Replace(CoffeeBagsList.Brand))
+	}
+	if CoffeeBagsList.Search != "" {
+		// Full text search matches whole words, ILIKE catches the partial ones
+		addCondition("(to_tsvector('simple', brand) @@ plainto_tsquery('simple', ?) OR brand ILIKE '%' || ? || '%')", CoffeeBagsList.Search, likeEscaper.Replace(CoffeeBagsList.Search))
+	}
+	if CoffeeBagsList.City != "" {
+		addCondition("EXISTS (SELECT 1 FROM shops_coffeebag_coffee_shop INNER JOIN shops_shop ON shops_shop.id = shops_coffeebag_coffee_shop.shop_id WHERE shops_coffeebag_coffee_shop.coffeebag_id = shops_coffeebag.id AND LOWER(shops_shop.city) = LOWER(?))", CoffeeBagsList.City)
+	}
+	query := "SELECT id, brand, species, origin, COALESCE(roast, '') AS roast, COALESCE(process, '') AS process, altitude, variety, tasting_notes, weight, price FROM shops_coffeebag"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Sorting is always taken from the whitelist, never from the request
+	orderBy, ok := COFFEE_BAG_SORTING[CoffeeBagsList.Sort]
+	if !ok {
+		orderBy = COFFEE_BAG_SORTING["id"]
+	}
+	args = append(args, CoffeeBagsList.Size, CoffeeBagsList.Page*CoffeeBagsList.Size)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d;", orderBy, len(args)-1, len(args))
+	rows, err := repo.db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -202,6 +432,8 @@ func (repo *PostgresRepository) GetCoffeeBags(ctx context.Context, CoffeeBagsLis
 		err = rows.StructScan(&item)
 		item.Species = COFFEE_SPECIES[item.Species]
 		item.Origin = STATE_CHOICES[item.Origin]
+		item.Roast = ROAST_LEVELS[item.Roast]
+		item.Process = COFFEE_PROCESSES[item.Process]
 		coffeeBags = append(coffeeBags, &item)
 	}
 	err = rows.Err()
@@ -210,30 +442,75 @@ func (repo *PostgresRepository) GetCoffeeBags(ctx context.Context, CoffeeBagsLis
 
 func (repo *PostgresRepository) CreateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error) {
 	var coffeBagId string
-	err := repo.db.QueryRowContext(ctx, "INSERT INTO shops_coffeebag (brand, species, origin) VALUES($1, $2, $3) RETURNING id;", coffeeBag.Brand, coffeeBag.Species, coffeeBag.Origin).Scan(&coffeBagId)
+	if coffeeBag.TastingNotes == nil {
+		coffeeBag.TastingNotes = pq.StringArray{}
+	}
+	err := repo.db.QueryRowContext(ctx, "INSERT INTO shops_coffeebag (brand, species, origin, roast, process, altitude, variety, tasting_notes, weight, price) VALUES($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10) RETURNING id;", coffeeBag.Brand, coffeeBag.Species, coffeeBag.Origin, coffeeBag.Roast, coffeeBag.Process, coffeeBag.Altitude, coffeeBag.Variety, coffeeBag.TastingNotes, coffeeBag.Weight, coffeeBag.Price).Scan(&coffeBagId)
 	coffeeBag.ID = coffeBagId
 	return coffeeBag, err
 }
 
 func (repo *PostgresRepository) GetCoffeeBagById(ctx context.Context, coffeeBagId string) (*models.CoffeeBag, error) {
 	var coffeeShopBag models.CoffeeBag
-	err := repo.db.GetContext(ctx, &coffeeShopBag, "SELECT id, brand, species, origin FROM shops_coffeebag WHERE id = $1;", coffeeBagId)
+	err := repo.db.GetContext(ctx, &coffeeShopBag, "SELECT id, brand, species, origin, COALESCE(roast, '') AS roast, COALESCE(process, '') AS process, altitude, variety, tasting_notes, weight, price, version FROM shops_coffeebag WHERE id = $1;", coffeeBagId)
 	return &coffeeShopBag, err
 }
 
+// A coffee bag with the same brand, ignoring case, species, origin, process and variety as an imported one is updated
+// instead of creating a new one. Every coffee bag is imported in the same transaction, which is rolled back when
+// dryRun is set
+func (repo *PostgresRepository) ImportCoffeeBags(ctx context.Context, coffeeBags []*models.CoffeeBag, dryRun bool) ([]string, error) {
+	tx, err := repo.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	actions := make([]string, len(coffeeBags))
+	for i, coffeeBag := range coffeeBags {
+		if coffeeBag.TastingNotes == nil {
+			coffeeBag.TastingNotes = pq.StringArray{}
+		}
+		var id string
+		err = tx.GetContext(ctx, &id, "SELECT id FROM shops_coffeebag WHERE lower(brand) = lower($1) AND species = $2 AND origin = $3 AND COALESCE(process, '') = $4 AND lower(COALESCE(variety, '')) = lower($5) ORDER BY id LIMIT 1;", coffeeBag.Brand, coffeeBag.Species, coffeeBag.Origin, coffeeBag.Process, coffeeBag.Variety)
+		if errors.Is(err, sql.ErrNoRows) {
+			actions[i] = models.IMPORT_CREATED
+			err = tx.QueryRowContext(ctx, "INSERT INTO shops_coffeebag (brand, species, origin, roast, process, altitude, variety, tasting_notes, weight, price) VALUES($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10) RETURNING id;", coffeeBag.Brand, coffeeBag.Species, coffeeBag.Origin, coffeeBag.Roast, coffeeBag.Process, coffeeBag.Altitude, coffeeBag.Variety, coffeeBag.TastingNotes, coffeeBag.Weight, coffeeBag.Price).Scan(&coffeeBag.ID)
+		} else if err == nil {
+			actions[i], coffeeBag.ID = models.IMPORT_UPDATED, id
+			_, err = tx.ExecContext(ctx, "UPDATE shops_coffeebag SET roast = NULLIF($2, ''), altitude = $3, tasting_notes = $4, weight = $5, price = $6, version = version + 1 WHERE id = $1;", id, coffeeBag.Roast, coffeeBag.Altitude, coffeeBag.TastingNotes, coffeeBag.Weight, coffeeBag.Price)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return actions, nil
+	}
+	return actions, tx.Commit()
+}
+
 func (repo *PostgresRepository) UpdateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error) {
-	_, err := repo.db.NamedExecContext(ctx, "UPDATE shops_coffeebag SET brand = brand, species = species, origin = origin WHERE id = id;", coffeeBag)
-	return coffeeBag, err
+	if coffeeBag.TastingNotes == nil {
+		coffeeBag.TastingNotes = pq.StringArray{}
+	}
+	result, err := repo.db.NamedExecContext(ctx, "UPDATE shops_coffeebag SET brand = :brand, species = :species, origin = :origin, roast = NULLIF(:roast, ''), process = NULLIF(:process, ''), altitude = :altitude, variety = :variety, tasting_notes = :tasting_notes, weight = :weight, price = :price, version = version + 1 WHERE id = :id AND version = :version;", coffeeBag)
+	if err = repo.checkVersionedWrite(ctx, result, err, "shops_coffeebag", coffeeBag.ID); err != nil {
+		return coffeeBag, err
+	}
+	coffeeBag.Version++
+	return coffeeBag, nil
 }
 
-func (repo *PostgresRepository) DeleteCoffeeBag(ctx context.Context, coffeeBagId string) error {
-	_, err := repo.db.ExecContext(ctx, "DELETE FROM shops_coffeebag WHERE id = $1;", coffeeBagId)
-	return err
+func (repo *PostgresRepository) DeleteCoffeeBag(ctx context.Context, coffeeBagId string, version uint64) error {
+	result, err := repo.db.ExecContext(ctx, "DELETE FROM shops_coffeebag WHERE id = $1 AND version = $2;", coffeeBagId, version)
+	return repo.checkVersionedWrite(ctx, result, err, "shops_coffeebag", coffeeBagId)
 }
 
 func (repo *PostgresRepository) GetCoffeeBagByCoffeeShop(ctx context.Context, coffeeShopId *models.CoffeeBagByShopId) ([]*models.CoffeeBag, error) {
 	var coffeeBags []*models.CoffeeBag
-	rows, err := repo.db.QueryxContext(ctx, "SELECT shops_coffeebag.id, brand, species, origin FROM shops_coffeebag INNER JOIN shops_coffeebag_coffee_shop ON shops_coffeebag.id = shops_coffeebag_coffee_shop.coffeebag_id WHERE shops_coffeebag_coffee_shop.shop_id = $1 LIMIT $2 OFFSET $3;", coffeeShopId.CoffeeShopId, coffeeShopId.Size, coffeeShopId.Page*coffeeShopId.Size)
+	rows, err := repo.db.QueryxContext(ctx, `SELECT shops_coffeebag.id, brand, species, origin, COALESCE(roast, '') AS roast, COALESCE(process, '') AS process, altitude, variety, tasting_notes, weight, shops_coffeebag.price,
+	shops_coffeebag_coffee_shop.price AS "availability.price", shops_coffeebag_coffee_shop.size AS "availability.size", stock_status AS "availability.stock_status",
+	COALESCE(to_char(roast_date, 'YYYY-MM-DD'), '') AS "availability.roast_date", updated_at AS "availability.updated_at" FROM shops_coffeebag INNER JOIN shops_coffeebag_coffee_shop ON shops_coffeebag.id = shops_coffeebag_coffee_shop.coffeebag_id WHERE shops_coffeebag_coffee_shop.shop_id = $1 LIMIT $2 OFFSET $3;`, coffeeShopId.CoffeeShopId, coffeeShopId.Size, coffeeShopId.Page*coffeeShopId.Size)
 	if err != nil {
 		return nil, err
 	}
@@ -242,14 +519,28 @@ func (repo *PostgresRepository) GetCoffeeBagByCoffeeShop(ctx context.Context, co
 		err = rows.StructScan(&item)
 		item.Species = COFFEE_SPECIES[item.Species]
 		item.Origin = STATE_CHOICES[item.Origin]
+		item.Roast = ROAST_LEVELS[item.Roast]
+		item.Process = COFFEE_PROCESSES[item.Process]
+		item.Availability.StockStatus = STOCK_STATUSES[item.Availability.StockStatus]
 		coffeeBags = append(coffeeBags, &item)
 	}
 	err = rows.Err()
 	return coffeeBags, err
 }
 
-func (repo *PostgresRepository) AddCoffeeBagToCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error {
-	_, err := repo.db.ExecContext(ctx, "INSERT INTO shops_coffeebag_coffee_shop (coffeebag_id, shop_id) VALUES($1, $2);", coffeeBagId, coffeeShopId)
+func (repo *PostgresRepository) GetCoffeeShopsByCoffeeBag(ctx context.Context, coffeeBagId *models.CoffeeShopsByCoffeeBagId) ([]*models.CoffeeShop, error) {
+	var coffeeShops []*models.CoffeeShop
+	if coffeeBagId.Coordinates == nil {
+		err := repo.db.SelectContext(ctx, &coffeeShops, "SELECT shops_shop.id, name, location, address, roaster, city, rating, created_date, modified_date FROM shops_shop INNER JOIN shops_coffeebag_coffee_shop ON shops_coffeebag_coffee_shop.shop_id = shops_shop.id WHERE shops_coffeebag_coffee_shop.coffeebag_id = $1 ORDER BY name LIMIT $2 OFFSET $3;", coffeeBagId.CoffeeBagId, coffeeBagId.Size, coffeeBagId.Page*coffeeBagId.Size)
+		return coffeeShops, err
+	}
+	// Locations are stored as POINT(latitude longitude), they must be flipped to calculate the distance in meters
+	err := repo.db.SelectContext(ctx, &coffeeShops, "SELECT shops_shop.id, name, location, address, roaster, city, rating, created_date, modified_date, ST_DistanceSphere(ST_FlipCoordinates(location), ST_SetSRID(ST_MakePoint($3, $2), 4326)) AS distance FROM shops_shop INNER JOIN shops_coffeebag_coffee_shop ON shops_coffeebag_coffee_shop.shop_id = shops_shop.id WHERE shops_coffeebag_coffee_shop.coffeebag_id = $1 ORDER BY location <-> ST_SetSRID(ST_MakePoint($2, $3), 4326) LIMIT $4 OFFSET $5;", coffeeBagId.CoffeeBagId, coffeeBagId.Coordinates.Latitude, coffeeBagId.Coordinates.Longitude, coffeeBagId.Size, coffeeBagId.Page*coffeeBagId.Size)
+	return coffeeShops, err
+}
+
+func (repo *PostgresRepository) AddCoffeeBagToCoffeeShop(ctx context.Context, availability *models.CoffeeBagAvailability) error {
+	_, err := repo.db.NamedExecContext(ctx, "INSERT INTO shops_coffeebag_coffee_shop (coffeebag_id, shop_id, price, size, stock_status, roast_date, updated_at) VALUES(:coffeebag_id, :shop_id, :price, :size, COALESCE(NULLIF(:stock_status, ''), 'IS'), NULLIF(:roast_date, '')::date, current_timestamp);", availability)
 	if err != nil {
 		if strings.Contains(err.Error(), "shops_coffeebag_coffee_shop_coffeebag_id_shop_id_2d92af17_uniq") {
 			return errors.New("That coffee bag is already registered as a product of that coffee shop")
@@ -258,11 +549,71 @@ func (repo *PostgresRepository) AddCoffeeBagToCoffeeShop(ctx context.Context, co
 	return err
 }
 
+func (repo *PostgresRepository) UpdateCoffeeBagAvailability(ctx context.Context, availability *models.CoffeeBagAvailability) (*models.CoffeeBagAvailability, error) {
+	var updatedAvailability models.CoffeeBagAvailability
+	rows, err := repo.db.NamedQueryContext(ctx, `UPDATE shops_coffeebag_coffee_shop SET price = :price, size = :size, stock_status = COALESCE(NULLIF(:stock_status, ''), 'IS'), roast_date = NULLIF(:roast_date, '')::date, updated_at = current_timestamp
+	WHERE coffeebag_id = :coffeebag_id AND shop_id = :shop_id RETURNING coffeebag_id, shop_id, price, size, stock_status, COALESCE(to_char(roast_date, 'YYYY-MM-DD'), '') AS roast_date, updated_at;`, availability)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	err = rows.StructScan(&updatedAvailability)
+	// Same display name as the reads of the coffee bags of a coffee shop
+	updatedAvailability.StockStatus = STOCK_STATUSES[updatedAvailability.StockStatus]
+	return &updatedAvailability, err
+}
+
 func (repo *PostgresRepository) RemoveCoffeeBagFromCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error {
 	_, err := repo.db.ExecContext(ctx, "DELETE FROM shops_coffeebag_coffee_shop WHERE coffeebag_id = $1 and shop_id = $2;", coffeeBagId, coffeeShopId)
 	return err
 }
 
+// A conditional write that didn't affect any row either targeted a missing row or an outdated version
+func (repo *PostgresRepository) checkVersionedWrite(ctx context.Context, result sql.Result, err error, table string, id string) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	var exists bool
+	// The table name is never user input
+	if err = repo.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = $1);", id); err != nil {
+		return err
+	}
+	if exists {
+		return models.ErrVersionMismatch
+	}
+	return sql.ErrNoRows
+}
+
+func (repo *PostgresRepository) GetCatalogStats(ctx context.Context) (*models.CatalogStats, error) {
+	var stats models.CatalogStats
+	err := repo.db.GetContext(ctx, &stats, `SELECT
+	(SELECT count(*) FROM shops_shop) AS coffee_shops,
+	(SELECT count(DISTINCT city) FROM shops_shop) AS cities,
+	(SELECT count(*) FROM shops_shop WHERE roaster) AS roasters,
+	(SELECT count(*) FROM shops_coffeebag) AS coffee_bags,
+	(SELECT count(*) FROM shops_coffeebag_coffee_shop) AS availability,
+	(SELECT count(*) FROM shops_shopphoto) AS photos,
+	(SELECT count(*) FROM accounts_user) AS users,
+	(SELECT count(*) FROM accounts_user WHERE is_staff) AS staff_users,
+	(SELECT count(*) FROM shops_shop_likes) AS likes;`)
+	return &stats, err
+}
+
+// Statistics of the connection pool
+func (repo *PostgresRepository) Stats() sql.DBStats {
+	return repo.db.Stats()
+}
+
 func (repo *PostgresRepository) Close() error {
 	return repo.db.Close()
 }
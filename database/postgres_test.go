@@ -0,0 +1,148 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/repository/repositorytest"
+	"github.com/jmoiron/sqlx"
+)
+
+const POSTGIS_IMAGE = "postgis/postgis:16-3.4"
+
+// Runs the contract suite against Postgres. TEST_DATABASE_URL can point to any database with PostGIS available,
+// otherwise a PostGIS container is started with docker. The test is skipped when neither is available, unless
+// REQUIRE_POSTGRES is set, so CI can't pass without running it
+func TestPostgresRepository(t *testing.T) {
+	if testing.Short() {
+		skipPostgres(t, "skipping the Postgres repository in short mode")
+	}
+	databaseURL, ok := os.LookupEnv("TEST_DATABASE_URL")
+	if !ok {
+		databaseURL = startPostgres(t)
+	}
+	repo, err := NewPostgresRepositoryFromURL(withSchema(t, databaseURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	migrate(t, repo)
+	t.Run("Migrator", func(t *testing.T) { testMigrator(t, databaseURL) })
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		// Every other table references one of these, or is emptied with them
+		_, err := repo.db.Exec("TRUNCATE shops_shop, shops_coffeebag, accounts_user RESTART IDENTITY CASCADE;")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+// Skip the test, or fail it when REQUIRE_POSTGRES is set
+func skipPostgres(t *testing.T, reason string) {
+	t.Helper()
+	if os.Getenv("REQUIRE_POSTGRES") != "" {
+		t.Fatal("REQUIRE_POSTGRES is set: " + reason)
+	}
+	t.Skip(reason)
+}
+
+// Start a disposable PostGIS container and return its url
+func startPostgres(t *testing.T) string {
+	if _, err := exec.LookPath("docker"); err != nil {
+		skipPostgres(t, "set TEST_DATABASE_URL or install docker to test the Postgres repository")
+	}
+	output, err := exec.Command("docker", "run", "--detach", "--rm", "--env", "POSTGRES_PASSWORD=postgres", "--publish", "127.0.0.1::5432", POSTGIS_IMAGE).Output()
+	if err != nil {
+		skipPostgres(t, fmt.Sprintf("couldn't start %s: %v", POSTGIS_IMAGE, err))
+	}
+	container := strings.TrimSpace(string(output))
+	t.Cleanup(func() { exec.Command("docker", "stop", container).Run() })
+	output, err = exec.Command("docker", "port", container, "5432/tcp").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := strings.TrimSpace(strings.Split(string(output), "\n")[0])
+	// The server restarts once after creating the PostGIS extension, it's ready after the second start
+	deadline := time.Now().Add(time.Minute)
+	for {
+		logs, _ := exec.Command("docker", "logs", container).CombinedOutput()
+		if bytes.Count(logs, []byte("database system is ready to accept connections")) >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s didn't start in time:\n%s", POSTGIS_IMAGE, logs)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return fmt.Sprintf("postgres://postgres:postgres@%s/postgres?sslmode=disable", address)
+}
+
+// Create a schema only for this run, so the tables of the database at TEST_DATABASE_URL are never touched
+func withSchema(t *testing.T, databaseURL string) string {
+	db, err := sqlx.Connect("postgres", databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	schema := fmt.Sprintf("repository_test_%d", time.Now().UnixNano())
+	if _, err = db.Exec("CREATE EXTENSION IF NOT EXISTS postgis; CREATE SCHEMA " + schema + ";"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db, err := sqlx.Connect("postgres", databaseURL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer db.Close()
+		if _, err = db.Exec("DROP SCHEMA " + schema + " CASCADE;"); err != nil {
+			t.Error(err)
+		}
+	})
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PostGIS is installed in the public schema
+	q := u.Query()
+	q.Set("search_path", schema+",public")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Apply every embedded migration, and check they can be reverted and applied again
+func migrate(t *testing.T, repo *PostgresRepository) {
+	migrator, err := repo.Migrator(logging.New(io.Discard, logging.LEVEL_ERROR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err = migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = migrator.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != status.Latest || status.Dirty || len(status.Pending) > 0 {
+		t.Fatalf("expected every migration to be applied, got version %d of %d", status.Version, status.Latest)
+	}
+}
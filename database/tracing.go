@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/EduardoZepeda/go-coffee-api/tracing"
+	"github.com/jmoiron/sqlx"
+)
+
+// The operation and the first table of a statement, like UPDATE shops_shop or SELECT shops_coffeebag
+var statementTable = regexp.MustCompile(`(?is)^\s*(?:UPDATE|INSERT\s+INTO|DELETE\s+FROM|.*?\bFROM)\s+([A-Za-z_][A-Za-z0-9_.]*)`)
+
+// Name of the span of a statement, the operation alone when there's no table, like SELECT for function calls
+func statementName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	operation := strings.ToUpper(fields[0])
+	if match := statementTable.FindStringSubmatch(query); match != nil {
+		return operation + " " + match[1]
+	}
+	return operation
+}
+
+// Start the span of a query, a child of the span of the context
+func startQuery(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	return tracing.Start(ctx, statementName(query), "kind", "client", "db.system", "postgresql", "db.statement", strings.Join(strings.Fields(query), " "))
+}
+
+// A query that doesn't find a row isn't a failure, the repository returns sql.ErrNoRows as a 404
+func endQuery(span *tracing.Span, err error) {
+	if !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// The connection pool of the repository. Every query runs in a span named after its statement
+type tracedDB struct {
+	*sqlx.DB
+}
+
+func (db tracedDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startQuery(ctx, query)
+	err := db.DB.GetContext(ctx, dest, query, args...)
+	endQuery(span, err)
+	return err
+}
+
+func (db tracedDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startQuery(ctx, query)
+	err := db.DB.SelectContext(ctx, dest, query, args...)
+	endQuery(span, err)
+	return err
+}
+
+func (db tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (db tracedDB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	result, err := db.DB.NamedExecContext(ctx, query, arg)
+	endQuery(span, err)
+	return result, err
+}
+
+// The span ends once the query is sent, reading the rows isn't part of it
+func (db tracedDB) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := db.DB.NamedQueryContext(ctx, query, arg)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (db tracedDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := db.DB.QueryxContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (db tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+func (db tracedDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*tracedTx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, ctx: ctx}, nil
+}
+
+// A transaction, its statements are traced like the ones of the pool
+type tracedTx struct {
+	*sqlx.Tx
+	// Context the transaction began with, for the span of the commit
+	ctx context.Context
+}
+
+func (tx *tracedTx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startQuery(ctx, query)
+	err := tx.Tx.GetContext(ctx, dest, query, args...)
+	endQuery(span, err)
+	return err
+}
+
+func (tx *tracedTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (tx *tracedTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := tx.Tx.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+func (tx *tracedTx) Commit() error {
+	_, span := startQuery(tx.ctx, "COMMIT")
+	err := tx.Tx.Commit()
+	endQuery(span, err)
+	return err
+}
@@ -0,0 +1,21 @@
+package database
+
+import "testing"
+
+func TestStatementName(t *testing.T) {
+	for query, expected := range map[string]string{
+		"SELECT id, name FROM shops_shop WHERE id = $1;":                            "SELECT shops_shop",
+		"select count(*) FROM (SELECT 1 FROM likes) AS l;":                          "SELECT likes",
+		"INSERT INTO shops_shop (name) VALUES ($1) RETURNING id;":                   "INSERT shops_shop",
+		"UPDATE shops_coffeebag SET price = :price WHERE id = :id;":                 "UPDATE shops_coffeebag",
+		"DELETE FROM accounts_user WHERE id = $1 AND version = $2;":                 "DELETE accounts_user",
+		"\n\tSELECT shops_coffeebag.id\n\tFROM shops_coffeebag\n\tWHERE brand = $1": "SELECT shops_coffeebag",
+		"WITH recent AS (SELECT * FROM feed) SELECT * FROM recent;":                 "WITH feed",
+		"SELECT to_regclass('schema_migrations') IS NOT NULL;":                      "SELECT",
+		"COMMIT": "COMMIT",
+	} {
+		if name := statementName(query); name != expected {
+			t.Errorf("expected %q for %q, got %q", expected, query, name)
+		}
+	}
+}
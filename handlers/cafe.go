@@ -4,16 +4,29 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/EduardoZepeda/go-coffee-api/models"
 	"github.com/EduardoZepeda/go-coffee-api/parameters"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/schedule"
 	"github.com/EduardoZepeda/go-coffee-api/types"
 	"github.com/EduardoZepeda/go-coffee-api/validator"
 
 	"github.com/gorilla/mux"
 )
 
+// Add the fields that don't belong to shops_shop: opening status and photos. Only detail responses include the
+// opening hours
+func completeCoffeeShops(r *http.Request, app *application.App, detail bool, coffeeShops ...*models.CoffeeShop) error {
+	if err := setOpeningStatus(r.Context(), app, detail, coffeeShops...); err != nil {
+		return err
+	}
+	return setPhotos(r.Context(), app, imageSize(r), coffeeShops...)
+}
+
 // GetCoffeeShops godoc
 // @Summary      Get a list of coffee shops
 // @Description  Get a list of all coffee shop in Guadalajara. Use page and size GET arguments to regulate the number of objects returned and the page, respectively.
@@ -25,6 +38,9 @@ import (
 // @Param search query string false "Search term"
 // @Param longitude query float32 false "User longitude"
 // @Param latitude query float32 false "User latitude"
+// @Param open_now query bool false "Only coffee shops open right now"
+// @Param open_at query string false "Only coffee shops open at the given timestamp, for example: 2022-10-05T18:30:00-05:00"
+// @Param image_size query int false "Thumbnail size of the photo urls: 128, 512 or 1024"
 // @Success      200  {array}  models.CoffeeShop
 // @Failure      404  {object}  []models.EmptyBody
 // @Failure      500  {object}  types.ApiError
@@ -42,12 +58,17 @@ func GetCoffeeShops(app *application.App) http.HandlerFunc {
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusBadRequest)
 			return
 		}
+		openAt, err := parameters.GetOpenAtParam(r)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
 		// If there is search term parameter
 		searchTerm := parameters.GetStringParam(r, "search", "")
 		if searchTerm != "" {
-			cafes, err := app.Repo.SearchCoffeeShops(r.Context(), searchTerm, page, size)
+			cafes, err := app.Repo.SearchCoffeeShops(r.Context(), searchTerm, page, size, openAt)
 			if err != nil {
-				app.Logger.Println(err)
+				logging.FromContext(r.Context()).Error("searching coffee shops failed", "error", err)
 				app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 				return
 			}
@@ -56,13 +77,18 @@ func GetCoffeeShops(app *application.App) http.HandlerFunc {
 				app.Respond(w, []int{}, http.StatusNotFound)
 				return
 			}
+			if err = completeCoffeeShops(r, app, false, cafes...); err != nil {
+				logging.FromContext(r.Context()).Error("completing coffee shops failed", "error", err)
+				app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+				return
+			}
 			app.Respond(w, cafes, http.StatusOK)
 			return
 		}
 		// if there is latitude and longitude in parameters
 		userCoordinates, err := parameters.GetLongitudeAndLatitudeTerms(r)
 		if userCoordinates != nil && err == nil {
-			cafes, err := app.Repo.GetNearestCoffeeShop(r.Context(), userCoordinates)
+			cafes, err := app.Repo.GetNearestCoffeeShop(r.Context(), userCoordinates, openAt)
 			if err != nil {
 				app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 				return
@@ -72,13 +98,18 @@ func GetCoffeeShops(app *application.App) http.HandlerFunc {
 				app.Respond(w, []int{}, http.StatusNotFound)
 				return
 			}
+			if err = completeCoffeeShops(r, app, false, cafes...); err != nil {
+				logging.FromContext(r.Context()).Error("completing coffee shops failed", "error", err)
+				app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+				return
+			}
 			app.Respond(w, cafes, http.StatusOK)
 			return
 		}
 		// List coffes in a default way
-		cafes, err := app.Repo.GetCoffeeShops(r.Context(), page, size)
+		cafes, err := app.Repo.GetCoffeeShops(r.Context(), page, size, openAt)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("listing coffee shops failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
@@ -87,6 +118,11 @@ func GetCoffeeShops(app *application.App) http.HandlerFunc {
 			app.Respond(w, []int{}, http.StatusNotFound)
 			return
 		}
+		if err = completeCoffeeShops(r, app, false, cafes...); err != nil {
+			logging.FromContext(r.Context()).Error("completing coffee shops failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
 		app.Respond(w, cafes, http.StatusOK)
 		return
 	}
@@ -99,7 +135,10 @@ func GetCoffeeShops(app *application.App) http.HandlerFunc {
 // @Accept       json
 // @Produce      json
 // @Param coffee_shop_id path string true "Coffee Shop ID"
+// @Param image_size query int false "Thumbnail size of the photo urls: 128, 512 or 1024"
 // @Success      200  {object}  models.CoffeeShop
+// @Header       200  {string}  ETag  "Version of the coffee shop, send it in If-Match to update or delete it"
+// @Header       200  {string}  Last-Modified  "Last time the coffee shop, its photos or opening hours were modified, or the coffee shop opened or closed"
 // @Failure      404  {object}  models.EmptyBody
 // @Failure      500  {object}  types.ApiError
 // @Router       /coffee-shops/{coffee_shop_id} [get]
@@ -107,8 +146,18 @@ func GetCoffeeShopById(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		cafe, err := app.Repo.GetCoffeeShopById(r.Context(), params["id"])
+		if err == nil {
+			err = completeCoffeeShops(r, app, true, cafe)
+		}
 		switch err {
 		case nil:
+			setVersionETag(w, cafe.Version)
+			// is_open, next_open and next_close change when the shop opens or closes, without modifying the shop
+			lastModified := cafe.ModifiedDate
+			if lastChange := schedule.LastChange(cafe.OpeningHours, time.Now()); lastChange.After(lastModified) {
+				lastModified = lastChange
+			}
+			w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
 			app.Respond(w, cafe, http.StatusOK)
 		case sql.ErrNoRows:
 			app.Respond(w, struct{}{}, http.StatusNotFound)
@@ -150,7 +199,7 @@ func CreateCoffeeShop(app *application.App) http.HandlerFunc {
 		}
 		insertedId, err := app.Repo.CreateCoffeeShop(r.Context(), &coffeeShop)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("creating the coffee shop failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
@@ -168,15 +217,24 @@ func CreateCoffeeShop(app *application.App) http.HandlerFunc {
 // @Produce      json
 // @Param request body models.CoffeeShop true "Updated Coffee Shop data"
 // @Param Authorization header string true "With the bearer started. Only staff members"
+// @Param If-Match header string true "ETag of the coffee shop as it was retrieved, or * to match any version"
 // @Param coffee_shop_id path string true "Coffee Shop ID"
 // @Success      200  {object}  models.CoffeeShop
+// @Header       200  {string}  ETag  "New version of the coffee shop"
 // @Failure      400  {object}  types.ApiError
 // @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
 // @Failure      500  {object}  types.ApiError
 // @Router       /coffee-shops/{coffee_shop_id} [put]
 func UpdateCoffeeShop(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			respondIfMatchError(app, w, err)
+			return
+		}
 		var coffeeShop = models.CoffeeShop{}
 		coffeeShop.ID = params["id"]
 		decoder := json.NewDecoder(r.Body)
@@ -190,12 +248,99 @@ func UpdateCoffeeShop(app *application.App) http.HandlerFunc {
 			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
 			return
 		}
-		err := app.Repo.UpdateCoffeeShop(r.Context(), &coffeeShop)
+		if version == ANY_VERSION {
+			current, err := repository.Uncached(app.Repo).GetCoffeeShopById(r.Context(), params["id"])
+			if err != nil {
+				respondVersionedWriteError(app, w, r, err)
+				return
+			}
+			version = current.Version
+		}
+		// Ignore any version coming from the body, only If-Match is trusted
+		coffeeShop.Version = version
+		if err = app.Repo.UpdateCoffeeShop(r.Context(), &coffeeShop); err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		setVersionETag(w, coffeeShop.Version)
+		app.Respond(w, &coffeeShop, http.StatusOK)
+	}
+}
+
+// PatchCoffeeShop godoc
+// @Summary      Partially update a coffee shop
+// @Description  Update only the fields present in the body of a coffee shop by its Id, following JSON merge patch semantics (RFC 7396). The updated coffee shop is returned as stored in the database.
+// @Tags         coffee shops
+// @Accept       json
+// @Produce      json
+// @Param request body models.CoffeeShop true "Coffee Shop fields to update"
+// @Param Authorization header string true "With the bearer started. Only staff members"
+// @Param If-Match header string true "ETag of the coffee shop as it was retrieved, or * to match any version"
+// @Param coffee_shop_id path string true "Coffee Shop ID"
+// @Success      200  {object}  models.CoffeeShop
+// @Header       200  {string}  ETag  "New version of the coffee shop"
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-shops/{coffee_shop_id} [patch]
+func PatchCoffeeShop(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			respondIfMatchError(app, w, err)
+			return
+		}
+		currentCoffeeShop, err := repository.Uncached(app.Repo).GetCoffeeShopById(r.Context(), params["id"])
+		switch err {
+		case nil:
+			// Don't merge the patch over a representation the client hasn't seen
+			// If-Match: * patches whatever version was just read
+			if version == ANY_VERSION {
+				version = currentCoffeeShop.Version
+			}
+			if currentCoffeeShop.Version != version {
+				respondVersionedWriteError(app, w, r, models.ErrVersionMismatch)
+				return
+			}
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("getting the coffee shop failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		var coffeeShop = models.CoffeeShop{}
+		if err = applyMergePatch(w, r, currentCoffeeShop, &coffeeShop); err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		// The id always comes from the url
+		coffeeShop.ID = params["id"]
+		v := validator.New()
+		if validator.ValidateCoffeeShop(v, &coffeeShop); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		coffeeShop.Version = version
+		if err = app.Repo.UpdateCoffeeShop(r.Context(), &coffeeShop); err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		updatedCoffeeShop, err := app.Repo.GetCoffeeShopById(r.Context(), params["id"])
+		if err == nil {
+			err = completeCoffeeShops(r, app, true, updatedCoffeeShop)
+		}
 		if err != nil {
+			logging.FromContext(r.Context()).Error("getting the updated coffee shop failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
-		app.Respond(w, &coffeeShop, http.StatusOK)
+		setVersionETag(w, updatedCoffeeShop.Version)
+		app.Respond(w, updatedCoffeeShop, http.StatusOK)
 	}
 }
 
@@ -207,17 +352,43 @@ func UpdateCoffeeShop(app *application.App) http.HandlerFunc {
 // @Produce      json
 // @Param coffee_shop_id path string true "Coffee Shop ID"
 // @Param Authorization header string true "With the bearer started. Only staff members"
+// @Param If-Match header string true "ETag of the coffee shop as it was retrieved, or * to match any version"
 // @Success      204  {object}  models.EmptyBody
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
 // @Failure      500  {object}  types.ApiError
 // @Router       /coffee-shops/{coffee_shop_id} [delete]
 func DeleteCoffeeShop(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
-		err := app.Repo.DeleteCoffeeShop(r.Context(), params["id"])
+		version, err := ifMatchVersion(r)
 		if err != nil {
+			respondIfMatchError(app, w, err)
+			return
+		}
+		if version == ANY_VERSION {
+			current, err := repository.Uncached(app.Repo).GetCoffeeShopById(r.Context(), params["id"])
+			if err != nil {
+				respondVersionedWriteError(app, w, r, err)
+				return
+			}
+			version = current.Version
+		}
+		// The rows of the photos are deleted with the coffee shop, their keys are read before
+		photos, err := repository.Uncached(app.Repo).GetCoffeeShopPhotos(r.Context(), []string{params["id"]})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("getting the photos failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
+		if err = app.Repo.DeleteCoffeeShop(r.Context(), params["id"], version); err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		for _, photo := range photos[params["id"]] {
+			deleteImage(r.Context(), app, photo.Image)
+		}
 		app.Respond(w, struct{}{}, http.StatusNoContent)
 	}
 }
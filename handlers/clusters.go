@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/parameters"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
+)
+
+// GetCoffeeShopClusters godoc
+// @Summary      Get coffee shops grouped in clusters
+// @Description  Group the coffee shops inside a bounding box into clusters according to the map zoom level. Each cluster contains its centroid, the number of coffee shops and its own bounding box.
+// @Tags         coffee shops
+// @Accept       json
+// @Produce      json
+// @Param bbox query string true "Bounding box: minLongitude,minLatitude,maxLongitude,maxLatitude"
+// @Param zoom query int true "Map zoom level, from 0 to 22"
+// @Success      200  {array}  models.CoffeeShopCluster
+// @Failure      400  {object}  types.ApiError
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-shops/clusters [get]
+func GetCoffeeShopClusters(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		boundingBox, err := parameters.GetBoundingBoxParam(r)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("zoom") == "" {
+			app.Respond(w, types.ApiError{Message: "zoom must be present as a query parameter"}, http.StatusBadRequest)
+			return
+		}
+		zoom, err := parameters.GetIntParam(r, "zoom", 0)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		clustersRequest := models.CoffeeShopClustersRequest{BoundingBox: *boundingBox, Zoom: zoom}
+		v := validator.New()
+		if validator.ValidateCoffeeShopClusters(v, &clustersRequest); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		clusters, err := app.Repo.GetCoffeeShopClusters(r.Context(), &clustersRequest)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("clustering coffee shops failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		if len(clusters) == 0 {
+			app.Respond(w, []int{}, http.StatusOK)
+			return
+		}
+		app.Respond(w, clusters, http.StatusOK)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"net/http"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/EduardoZepeda/go-coffee-api/models"
 	"github.com/EduardoZepeda/go-coffee-api/parameters"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
 	"github.com/EduardoZepeda/go-coffee-api/types"
 	"github.com/EduardoZepeda/go-coffee-api/validator"
 	"github.com/gorilla/mux"
@@ -15,13 +17,22 @@ import (
 
 // GetCoffeeBags godoc
 // @Summary      Get a list of coffee bags
-// @Description  Get a list of all coffee bags in Guadalajara. Use page and size GET arguments to regulate the number of objects returned and the page, respectively.
+// @Description  Get a list of all coffee bags in Guadalajara. Use page and size GET arguments to regulate the number of objects returned and the page, respectively. The list can be filtered and sorted.
 // @Tags         coffee bags
 // @Accept       json
 // @Produce      json
 // @Param page query int false "Page number"
 // @Param size query int false "Size number"
+// @Param species query string false "Species code: Ar, Ro, Lb or Ex"
+// @Param origin query string false "Origin state code, from 01 to 32"
+// @Param roast query string false "Roast level code: Li, Me, MD or Da"
+// @Param process query string false "Process code: Wa, Na, Ho or An"
+// @Param brand query string false "Brand prefix"
+// @Param search query string false "Search term for the brand"
+// @Param city query string false "Only coffee bags sold by a coffee shop in this city"
+// @Param sort query string false "Sort by id, brand, price or altitude. Use a minus sign for descending order, e.g. -price"
 // @Success      200  {array}  models.CoffeeBag
+// @Failure      400  {object}  types.ApiError
 // @Failure      404  {object}  []models.EmptyBody
 // @Failure      500  {object}  types.ApiError
 // @Router       /coffee-bags [get]
@@ -38,11 +49,25 @@ func GetCoffeeBags(app *application.App) http.HandlerFunc {
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusBadRequest)
 			return
 		}
-		// List coffes bags in a default way
-		coffeeBagRequests := models.CoffeeBagsList{Pagination: models.Pagination{Page: page, Size: size}}
+		coffeeBagRequests := models.CoffeeBagsList{
+			Species:    parameters.GetStringParam(r, "species", ""),
+			Origin:     parameters.GetStringParam(r, "origin", ""),
+			Roast:      parameters.GetStringParam(r, "roast", ""),
+			Process:    parameters.GetStringParam(r, "process", ""),
+			Brand:      parameters.GetStringParam(r, "brand", ""),
+			Search:     parameters.GetStringParam(r, "search", ""),
+			City:       parameters.GetStringParam(r, "city", ""),
+			Sort:       parameters.GetStringParam(r, "sort", ""),
+			Pagination: models.Pagination{Page: page, Size: size},
+		}
+		v := validator.New()
+		if validator.ValidateCoffeeBagsList(v, &coffeeBagRequests); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
 		cafes, err := app.Repo.GetCoffeeBags(r.Context(), coffeeBagRequests)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("listing coffee bags failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
@@ -64,6 +89,7 @@ func GetCoffeeBags(app *application.App) http.HandlerFunc {
 // @Produce      json
 // @Param coffee_bag_id path string true "Coffee Bag ID"
 // @Success      200  {object}  models.CoffeeBag
+// @Header       200  {string}  ETag  "Version of the coffee bag, send it in If-Match to update or delete it"
 // @Failure      404  {object}  models.EmptyBody
 // @Failure      500  {object}  types.ApiError
 // @Router       /coffee-bags/{coffee_bag_id} [get]
@@ -73,6 +99,7 @@ func GetCoffeeBagById(app *application.App) http.HandlerFunc {
 		coffeeBag, err := app.Repo.GetCoffeeBagById(r.Context(), params["id"])
 		switch err {
 		case nil:
+			setVersionETag(w, coffeeBag.Version)
 			app.Respond(w, coffeeBag, http.StatusOK)
 			return
 		case sql.ErrNoRows:
@@ -87,7 +114,7 @@ func GetCoffeeBagById(app *application.App) http.HandlerFunc {
 
 // CreateCoffeeBag godoc
 // @Summary      Create a new coffee bag
-// @Description  Create a coffee bag object.
+// @Description  Create a coffee bag object. Species (Ar, Ro, Lb, Ex), origin (01 to 32), roast (Li, Me, MD, Da) and process (Wa, Na, Ho, An) use codes. Altitude is in meters, weight in grams and price in MXN.
 // @Tags         coffee bags
 // @Accept       json
 // @Produce      json
@@ -115,7 +142,7 @@ func CreateCoffeeBag(app *application.App) http.HandlerFunc {
 		}
 		insertedCoffeeBag, err := app.Repo.CreateCoffeeBag(r.Context(), &coffeeBag)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("creating the coffee bag failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
@@ -132,15 +159,24 @@ func CreateCoffeeBag(app *application.App) http.HandlerFunc {
 // @Produce      json
 // @Param request body models.CoffeeBag true "Updated Coffee Bag data"
 // @Param Authorization header string true "With the bearer started. Only staff members"
+// @Param If-Match header string true "ETag of the coffee bag as it was retrieved, or * to match any version"
 // @Param coffee_bag_id path string true "Coffee Bag ID"
 // @Success      200  {object}  models.CoffeeBag
+// @Header       200  {string}  ETag  "New version of the coffee bag"
 // @Failure      400  {object}  types.ApiError
 // @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
 // @Failure      500  {object}  types.ApiError
 // @Router       /coffee-bags/{coffee_bag_id} [put]
 func UpdateCoffeeBag(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			respondIfMatchError(app, w, err)
+			return
+		}
 		var coffeeBag = models.CoffeeBag{}
 		decoder := json.NewDecoder(r.Body)
 		decoder.DisallowUnknownFields()
@@ -154,12 +190,96 @@ func UpdateCoffeeBag(app *application.App) http.HandlerFunc {
 			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
 			return
 		}
-		_, err := app.Repo.UpdateCoffeeBag(r.Context(), &coffeeBag)
+		if version == ANY_VERSION {
+			current, err := repository.Uncached(app.Repo).GetCoffeeBagById(r.Context(), params["id"])
+			if err != nil {
+				respondVersionedWriteError(app, w, r, err)
+				return
+			}
+			version = current.Version
+		}
+		// Ignore any version coming from the body, only If-Match is trusted
+		coffeeBag.Version = version
+		if _, err = app.Repo.UpdateCoffeeBag(r.Context(), &coffeeBag); err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		setVersionETag(w, coffeeBag.Version)
+		app.Respond(w, &coffeeBag, http.StatusOK)
+	}
+}
+
+// PatchCoffeeBag godoc
+// @Summary      Partially update a coffee bag
+// @Description  Update only the fields present in the body of a coffee bag by its Id, following JSON merge patch semantics (RFC 7396). Use null to remove optional fields. The updated coffee bag is returned as stored in the database.
+// @Tags         coffee bags
+// @Accept       json
+// @Produce      json
+// @Param request body models.CoffeeBag true "Coffee Bag fields to update"
+// @Param Authorization header string true "With the bearer started. Only staff members"
+// @Param If-Match header string true "ETag of the coffee bag as it was retrieved, or * to match any version"
+// @Param coffee_bag_id path string true "Coffee Bag ID"
+// @Success      200  {object}  models.CoffeeBag
+// @Header       200  {string}  ETag  "New version of the coffee bag"
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-bags/{coffee_bag_id} [patch]
+func PatchCoffeeBag(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			respondIfMatchError(app, w, err)
+			return
+		}
+		currentCoffeeBag, err := repository.Uncached(app.Repo).GetCoffeeBagById(r.Context(), params["id"])
+		switch err {
+		case nil:
+			// Don't merge the patch over a representation the client hasn't seen
+			// If-Match: * patches whatever version was just read
+			if version == ANY_VERSION {
+				version = currentCoffeeBag.Version
+			}
+			if currentCoffeeBag.Version != version {
+				respondVersionedWriteError(app, w, r, models.ErrVersionMismatch)
+				return
+			}
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("getting the coffee bag failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		var coffeeBag = models.CoffeeBag{}
+		if err = applyMergePatch(w, r, currentCoffeeBag, &coffeeBag); err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		// The id always comes from the url
+		coffeeBag.ID = params["id"]
+		v := validator.New()
+		if validator.ValidateCoffeeBag(v, &coffeeBag); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		coffeeBag.Version = version
+		if _, err = app.Repo.UpdateCoffeeBag(r.Context(), &coffeeBag); err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		updatedCoffeeBag, err := app.Repo.GetCoffeeBagById(r.Context(), params["id"])
 		if err != nil {
+			logging.FromContext(r.Context()).Error("getting the updated coffee bag failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
-		app.Respond(w, &coffeeBag, http.StatusOK)
+		setVersionETag(w, updatedCoffeeBag.Version)
+		app.Respond(w, updatedCoffeeBag, http.StatusOK)
 	}
 }
 
@@ -171,15 +291,31 @@ func UpdateCoffeeBag(app *application.App) http.HandlerFunc {
 // @Produce      json
 // @Param coffee_bag_id path string true "Coffee Bag ID"
 // @Param Authorization header string true "With the bearer started. Only staff members"
+// @Param If-Match header string true "ETag of the coffee bag as it was retrieved, or * to match any version"
 // @Success      204  {object}  models.EmptyBody
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
 // @Failure      500  {object}  types.ApiError
 // @Router       /coffee-bags/{coffee_bag_id} [delete]
 func DeleteCoffeeBag(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
-		err := app.Repo.DeleteCoffeeBag(r.Context(), params["id"])
+		version, err := ifMatchVersion(r)
 		if err != nil {
-			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			respondIfMatchError(app, w, err)
+			return
+		}
+		if version == ANY_VERSION {
+			current, err := repository.Uncached(app.Repo).GetCoffeeBagById(r.Context(), params["id"])
+			if err != nil {
+				respondVersionedWriteError(app, w, r, err)
+				return
+			}
+			version = current.Version
+		}
+		if err = app.Repo.DeleteCoffeeBag(r.Context(), params["id"], version); err != nil {
+			respondVersionedWriteError(app, w, r, err)
 			return
 		}
 		app.Respond(w, struct{}{}, http.StatusNoContent)
@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
+	"io"
 	"net/http"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/EduardoZepeda/go-coffee-api/models"
 	"github.com/EduardoZepeda/go-coffee-api/parameters"
 	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
 	"github.com/gorilla/mux"
 )
 
 // GetCoffeeBagByCoffeeShop godoc
 // @Summary      Get a list of coffee bags by coffee shop
-// @Description  Get a list of all coffee bags sold by a given coffee shop in Guadalajara. Use page and size GET arguments to regulate the number of objects returned and the page, respectively.
+// @Description  Get a list of all coffee bags sold by a given coffee shop in Guadalajara, including their price, size, stock status and roast date at that coffee shop. Use page and size GET arguments to regulate the number of objects returned and the page, respectively.
 // @Tags         coffee bags by coffee shop
 // @Accept       json
 // @Produce      json
@@ -41,7 +46,7 @@ func GetCoffeeBagByCoffeeShop(app *application.App) http.HandlerFunc {
 		coffeeBagRequest := models.CoffeeBagByShopId{CoffeeShopId: params["id"], Pagination: models.Pagination{Page: page, Size: size}}
 		coffeeBags, err := app.Repo.GetCoffeeBagByCoffeeShop(r.Context(), &coffeeBagRequest)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("listing the coffee bags of the coffee shop failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
@@ -55,14 +60,74 @@ func GetCoffeeBagByCoffeeShop(app *application.App) http.HandlerFunc {
 	}
 }
 
+// GetCoffeeShopsByCoffeeBag godoc
+// @Summary      Get a list of coffee shops that sell a coffee bag
+// @Description  Get a list of the coffee shops that sell a given coffee bag. When latitude and longitude are present, the nearest coffee shops come first and include their distance in meters. Use page and size GET arguments to regulate the number of objects returned and the page, respectively.
+// @Tags         coffee bags by coffee shop
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Coffee Bag ID"
+// @Param page query int false "Page number"
+// @Param size query int false "Size number"
+// @Param longitude query float32 false "User longitude"
+// @Param latitude query float32 false "User latitude"
+// @Success      200  {array}  models.CoffeeShop
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  []models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-bags/{id}/coffee-shops [get]
+func GetCoffeeShopsByCoffeeBag(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		params := mux.Vars(r)
+		page, err := parameters.GetIntParam(r, "page", 0)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		size, err := parameters.GetIntParam(r, "size", 10)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		coffeeShopsRequest := models.CoffeeShopsByCoffeeBagId{CoffeeBagId: params["id"], Pagination: models.Pagination{Page: page, Size: size}}
+		// Coordinates are optional, but if any of them is sent both must be valid
+		if r.URL.Query().Get("latitude") != "" || r.URL.Query().Get("longitude") != "" {
+			coffeeShopsRequest.Coordinates, err = parameters.GetLongitudeAndLatitudeTerms(r)
+			if err != nil {
+				app.Respond(w, types.ApiError{Message: "Both latitude and longitude must be valid floating numbers"}, http.StatusBadRequest)
+				return
+			}
+		}
+		coffeeShops, err := app.Repo.GetCoffeeShopsByCoffeeBag(r.Context(), &coffeeShopsRequest)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("listing the coffee shops of the coffee bag failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		if len(coffeeShops) == 0 {
+			// if query returns nothing return 404 and []
+			app.Respond(w, []int{}, http.StatusNotFound)
+			return
+		}
+		if err = completeCoffeeShops(r, app, false, coffeeShops...); err != nil {
+			logging.FromContext(r.Context()).Error("completing coffee shops failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		app.Respond(w, coffeeShops, http.StatusOK)
+	}
+}
+
 // AddCoffeeBagToCoffeeShop godoc
 // @Summary      Add a new coffee bag to a coffee shop
-// @Description  Add a new coffee bag to a coffee shop by their ids
+// @Description  Add a new coffee bag to a coffee shop by their ids. The body is optional, it contains the price in MXN, the size in grams, the stock status (IS, LS or OS) and the roast date of the coffee bag at that coffee shop.
 // @Tags         coffee bags by coffee shop
 // @Accept       json
 // @Produce      json
 // @Param coffee_bag_id path string true "Coffee Bag ID"
 // @Param id path string true "Coffee Shop ID"
+// @Param request body models.CoffeeBagAvailability false "Coffee bag availability at the coffee shop"
 // @Param Authorization header string true "With the bearer started. Only staff members"
 // @Success      201  {object}  models.EmptyBody
 // @Failure      400  {object}  types.ApiError
@@ -72,9 +137,24 @@ func GetCoffeeBagByCoffeeShop(app *application.App) http.HandlerFunc {
 func AddCoffeeBagToCoffeeShop(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
-		err := app.Repo.AddCoffeeBagToCoffeeShop(r.Context(), params["coffee_bag_id"], params["id"])
+		var availability = models.CoffeeBagAvailability{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		// An empty body only links the coffee bag to the coffee shop
+		if err := decoder.Decode(&availability); err != nil && err != io.EOF {
+			app.Respond(w, types.ApiError{Message: "Invalid JSON syntax in body request."}, http.StatusBadRequest)
+			return
+		}
+		v := validator.New()
+		if validator.ValidateCoffeeBagAvailability(v, &availability); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		availability.CoffeeBagId = params["coffee_bag_id"]
+		availability.CoffeeShopId = params["id"]
+		err := app.Repo.AddCoffeeBagToCoffeeShop(r.Context(), &availability)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("adding the coffee bag to the coffee shop failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
@@ -82,6 +162,51 @@ func AddCoffeeBagToCoffeeShop(app *application.App) http.HandlerFunc {
 	}
 }
 
+// UpdateCoffeeBagAvailability godoc
+// @Summary      Update a coffee bag availability at a coffee shop
+// @Description  Update the price in MXN, the size in grams, the stock status (IS, LS or OS) and the roast date of a coffee bag at a coffee shop. The response has the display name of the stock status, like the coffee bags of a coffee shop.
+// @Tags         coffee bags by coffee shop
+// @Accept       json
+// @Produce      json
+// @Param coffee_bag_id path string true "Coffee Bag ID"
+// @Param id path string true "Coffee Shop ID"
+// @Param request body models.CoffeeBagAvailability true "Coffee bag availability at the coffee shop"
+// @Param Authorization header string true "With the bearer started. Only staff members"
+// @Success      200  {object}  models.CoffeeBagAvailability
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-shops/{id}/coffee-bags/{coffee_bag_id} [put]
+func UpdateCoffeeBagAvailability(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		var availability = models.CoffeeBagAvailability{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&availability); err != nil {
+			app.Respond(w, types.ApiError{Message: "Invalid JSON syntax in body request."}, http.StatusBadRequest)
+			return
+		}
+		v := validator.New()
+		if validator.ValidateCoffeeBagAvailability(v, &availability); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		availability.CoffeeBagId = params["coffee_bag_id"]
+		availability.CoffeeShopId = params["id"]
+		updatedAvailability, err := app.Repo.UpdateCoffeeBagAvailability(r.Context(), &availability)
+		switch err {
+		case nil:
+			app.Respond(w, updatedAvailability, http.StatusOK)
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+		default:
+			logging.FromContext(r.Context()).Error("updating the availability failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+		}
+	}
+}
+
 // DeleteCoffeeBagFromCoffeeShop godoc
 // @Summary      Remove a coffee bag from a coffee shop
 // @Description  Remove a coffee bag from a coffee shop using their ids.
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/EduardoZepeda/go-coffee-api/types"
 )
 
@@ -24,7 +25,7 @@ func GetUserFeed(app *application.App) http.HandlerFunc {
 		userId := ctx.Value("userId")
 		feed, err := app.Repo.GetUserFeed(ctx, userId.(string))
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("getting the feed failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
 			return
 		}
@@ -17,6 +17,7 @@ import (
 // @Accept       json
 // @Produce      json
 // @Param user_id path string true "User id"
+// @Param image_size query int false "Thumbnail size of the profile picture urls: 128, 512 or 1024"
 // @Param Authorization header string true "With the bearer started."
 // @Success      200  {array}  models.GetUserResponse
 // @Failure      500  {object}  types.ApiError
@@ -33,6 +34,7 @@ func GetUserFollowingAccounts(app *application.App) http.HandlerFunc {
 			app.Respond(w, struct{}{}, http.StatusOK)
 			return
 		}
+		setProfilePictures(app, imageSize(r), users...)
 		app.Respond(w, users, http.StatusOK)
 		return
 	}
@@ -45,6 +47,7 @@ func GetUserFollowingAccounts(app *application.App) http.HandlerFunc {
 // @Accept       json
 // @Produce      json
 // @Param user_id path string true "User id"
+// @Param image_size query int false "Thumbnail size of the profile picture urls: 128, 512 or 1024"
 // @Param Authorization header string true "With the bearer started."
 // @Success      200  {array}  models.GetUserResponse
 // @Failure      500  {object}  types.ApiError
@@ -61,6 +64,7 @@ func GetUserFollowers(app *application.App) http.HandlerFunc {
 			app.Respond(w, struct{}{}, http.StatusOK)
 			return
 		}
+		setProfilePictures(app, imageSize(r), users...)
 		app.Respond(w, users, http.StatusOK)
 		return
 	}
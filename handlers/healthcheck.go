@@ -2,24 +2,60 @@ package handlers
 
 import (
 	"net/http"
-	"os"
+	"sync"
+	"time"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
 )
 
+// How long the healthcheck reuses the schema version, so frequent probes don't query the database every time.
+// Migrations run outside of the API, there's no write to invalidate it
+const SCHEMA_VERSION_TTL = 30 * time.Second
+
 // Healthcheck endping
 // @Summary      Returns the server status
-// @Description  Returns the api version, the environment and the server status
+// @Description  Returns the api version, the environment, the server status, the schema version of the database and the repository cache stats
 // @Tags         healthcheck
 // @Success      200  {object}  models.HealtcheckResponse
 // @Router       /healthcheck [get]
 func Healtcheck(app *application.App) http.HandlerFunc {
+	var (
+		mu            sync.Mutex
+		schemaVersion *models.SchemaVersion
+		readAt        time.Time
+	)
+	// Failed reads aren't kept, the next probe tries again
+	readSchemaVersion := func(r *http.Request) (*models.SchemaVersion, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if schemaVersion != nil && time.Since(readAt) < SCHEMA_VERSION_TTL {
+			return schemaVersion, nil
+		}
+		read, err := app.Repo.SchemaVersion(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		schemaVersion, readAt = read, time.Now()
+		return schemaVersion, nil
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		response := &models.HealtcheckResponse{
 			Version:     "1.0",
 			Status:      "up",
-			Environment: os.Getenv("MODE"),
+			Environment: app.Config.Mode,
+		}
+		if cachedRepository, ok := app.Repo.(*repository.CachedRepository); ok {
+			stats := cachedRepository.Stats()
+			response.Cache = &stats
+		}
+		schemaVersion, err := readSchemaVersion(r)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("reading the schema version failed", "error", err)
+		} else {
+			response.Schema = schemaVersion
 		}
 		app.Respond(w, response, http.StatusOK)
 	}
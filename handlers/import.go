@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/importer"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/parameters"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
+)
+
+// Maximum size of an imported file, 10 MB
+const MAX_IMPORT_SIZE int64 = 10 << 20
+
+type importFunc func(ctx context.Context, repo repository.Repository, reader io.Reader, format string, options importer.Options) (*models.ImportReport, error)
+
+// ImportCoffeeShops godoc
+// @Summary      Import coffee shops
+// @Description  Import coffee shops from a csv file, a GeoJSON FeatureCollection of points or a json array. A coffee shop with the same name as an existing one, within radius meters of it, updates the existing one. Invalid rows are skipped and reported, use dry_run to check a file without saving it. Csv files need a header with the columns name, address, latitude and longitude, and optionally city, roaster and rating. Only staff users can import coffee shops.
+// @Tags         coffee shops
+// @Accept       text/csv,application/geo+json,json
+// @Produce      json
+// @Param format query string false "csv, geojson or json, taken from the Content-Type header by default"
+// @Param dry_run query bool false "Validate and match the rows without saving them"
+// @Param batch_size query int false "Rows saved per transaction, by default every row is saved in a single transaction"
+// @Param radius query number false "Meters within which a coffee shop with the same name is the same coffee shop, 50 by default. 0 only matches the same location"
+// @Success      200  {object}  models.ImportReport
+// @Failure      400  {object}  types.ApiError
+// @Failure      403  {object}  types.ApiError
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-shops/import [post]
+func ImportCoffeeShops(app *application.App) http.HandlerFunc {
+	return importHandler(app, importer.ImportCoffeeShops)
+}
+
+// ImportCoffeeBags godoc
+// @Summary      Import coffee bags
+// @Description  Import coffee bags from a csv file or a json array. A coffee bag with the same brand, species, origin, process and variety as an existing one updates the existing one. Invalid rows are skipped and reported, use dry_run to check a file without saving it. Csv files need a header with the columns brand, species and origin, and optionally roast, process, altitude, variety, tasting_notes, separated by semicolons, weight and price. Choices can be codes or names, like Ar or Arábiga. Only staff users can import coffee bags.
+// @Tags         coffee bags
+// @Accept       text/csv,json
+// @Produce      json
+// @Param format query string false "csv or json, taken from the Content-Type header by default"
+// @Param dry_run query bool false "Validate and match the rows without saving them"
+// @Param batch_size query int false "Rows saved per transaction, by default every row is saved in a single transaction"
+// @Success      200  {object}  models.ImportReport
+// @Failure      400  {object}  types.ApiError
+// @Failure      403  {object}  types.ApiError
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-bags/import [post]
+func ImportCoffeeBags(app *application.App) http.HandlerFunc {
+	return importHandler(app, importer.ImportCoffeeBags)
+}
+
+func importHandler(app *application.App, importFile importFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := importFormat(r)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		dryRun, err := parameters.GetBoolParam(r, "dry_run", false)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		batchSize, err := parameters.GetIntParam(r, "batch_size", 0)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: "batch_size must be a positive integer. For example: &batch_size=100"}, http.StatusBadRequest)
+			return
+		}
+		radius, err := parameters.GetFloatParam(r, "radius", importer.DEFAULT_RADIUS)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		options := importer.Options{DryRun: dryRun, BatchSize: int(batchSize), Radius: radius}
+		v := validator.New()
+		if options.Validate(v); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MAX_IMPORT_SIZE)
+		report, err := importFile(r.Context(), app.Repo, r.Body, format, options)
+		if errors.Is(err, importer.ErrInvalidFile) {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("import failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		// The rows saved before the file stopped being readable are in the report
+		if report.Aborted {
+			app.Respond(w, report, http.StatusBadRequest)
+			return
+		}
+		app.Respond(w, report, http.StatusOK)
+	}
+}
+
+// The format query parameter takes precedence over the Content-Type header
+func importFormat(r *http.Request) (string, error) {
+	format := parameters.GetStringParam(r, "format", "")
+	if format != "" {
+		if _, ok := importer.FORMATS[format]; !ok {
+			return "", errors.New("format must be csv, geojson or json")
+		}
+		return format, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	for format, formatType := range importer.FORMATS {
+		if mediaType == formatType {
+			return format, nil
+		}
+	}
+	return "", errors.New("Send the file as text/csv, application/geo+json or application/json, or set the format query parameter")
+}
@@ -39,7 +39,7 @@ func GetLikedCoffeeShops(app *application.App) http.HandlerFunc {
 			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
 			return
 		}
-		currentUserId, err := utils.GetDataFromToken(r, "userId")
+		currentUserId, err := utils.GetDataFromToken(r, app.Config.JWTSecret.Value(), "userId")
 		if err != nil {
 			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
 			return
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/schedule"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
+	"github.com/gorilla/mux"
+)
+
+// Fill the is_open flag and the next opening and closing times of the coffee shops, detail responses include
+// the whole schedule too. Opening hours for all the shops are obtained using a single query
+func setOpeningStatus(ctx context.Context, app *application.App, detail bool, coffeeShops ...*models.CoffeeShop) error {
+	ids := make([]string, len(coffeeShops))
+	for i, coffeeShop := range coffeeShops {
+		ids[i] = coffeeShop.ID
+	}
+	openingHours, err := app.Repo.GetOpeningHours(ctx, ids)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, coffeeShop := range coffeeShops {
+		coffeeShop.IsOpen, coffeeShop.NextOpen, coffeeShop.NextClose = schedule.Status(openingHours[coffeeShop.ID], now)
+		if detail {
+			coffeeShop.OpeningHours = openingHours[coffeeShop.ID]
+		}
+	}
+	return nil
+}
+
+// GetOpeningHours godoc
+// @Summary      Get the opening hours of a coffee shop
+// @Description  Get the weekly opening hours and the upcoming special hours (holidays and closures) of a coffee shop. Weekdays go from 0 (Sunday) to 6 (Saturday) and hours are in America/Mexico_City time.
+// @Tags         coffee shops
+// @Accept       json
+// @Produce      json
+// @Param coffee_shop_id path string true "Coffee Shop ID"
+// @Success      200  {object}  models.OpeningHours
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-shops/{coffee_shop_id}/opening-hours [get]
+func GetOpeningHours(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		_, err := app.Repo.GetCoffeeShopById(r.Context(), params["id"])
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("getting the coffee shop failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		openingHours, err := app.Repo.GetOpeningHours(r.Context(), []string{params["id"]})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("getting the opening hours failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		app.Respond(w, openingHours[params["id"]], http.StatusOK)
+	}
+}
+
+// UpdateOpeningHours godoc
+// @Summary      Replace the opening hours of a coffee shop
+// @Description  Replace the weekly opening hours and the special hours of a coffee shop. A day can have multiple intervals, intervals whose closing time is lower than its opening time end the following day. Special hours replace the weekly hours of their date, use closed for holidays.
+// @Tags         coffee shops
+// @Accept       json
+// @Produce      json
+// @Param request body models.OpeningHours true "Opening hours"
+// @Param Authorization header string true "With the bearer started. Only staff members"
+// @Param coffee_shop_id path string true "Coffee Shop ID"
+// @Success      200  {object}  models.OpeningHours
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-shops/{coffee_shop_id}/opening-hours [put]
+func UpdateOpeningHours(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		var openingHours = models.OpeningHours{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&openingHours); err != nil {
+			app.Respond(w, types.ApiError{Message: "Invalid JSON syntax in body request."}, http.StatusBadRequest)
+			return
+		}
+		v := validator.New()
+		if validator.ValidateOpeningHours(v, &openingHours); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		_, err := app.Repo.GetCoffeeShopById(r.Context(), params["id"])
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("getting the coffee shop failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		openingHours.CoffeeShopId = params["id"]
+		err = app.Repo.UpdateOpeningHours(r.Context(), &openingHours)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("updating the opening hours failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		app.Respond(w, &openingHours, http.StatusOK)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/EduardoZepeda/go-coffee-api/utils"
+)
+
+// Maximum size of a merge patch body, 1 MB
+const MAX_PATCH_SIZE int64 = 1 << 20
+
+var ErrInvalidMergePatch = errors.New("Invalid JSON merge patch in body request. It must be a JSON object with the fields to update, use null to remove optional fields.")
+
+// Apply the JSON merge patch in the request body to the current representation of a resource and decode the
+// result into target. Fields that don't belong to the resource are rejected
+func applyMergePatch(w http.ResponseWriter, r *http.Request, current interface{}, target interface{}) error {
+	// RFC 7396 defines application/merge-patch+json, plain JSON is accepted as well
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			return errors.New("Content-Type must be application/merge-patch+json or application/json")
+		}
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_PATCH_SIZE))
+	if err != nil {
+		return ErrInvalidMergePatch
+	}
+	document, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	merged, err := utils.MergePatch(document, patch)
+	if err != nil {
+		return ErrInvalidMergePatch
+	}
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(target); err != nil {
+		return ErrInvalidMergePatch
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/images"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/parameters"
+	"github.com/EduardoZepeda/go-coffee-api/storage"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/utils"
+	"github.com/gorilla/mux"
+)
+
+// Maximum size of an uploaded image, 5 MB
+const MAX_UPLOAD_SIZE int64 = 5 << 20
+
+// Content types are sniffed from the file content, the extension and headers sent by the client are ignored
+var ALLOWED_IMAGE_TYPES = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Read the image sent in the "image" field of a multipart form
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_SIZE+1024)
+	if err := r.ParseMultipartForm(MAX_UPLOAD_SIZE); err != nil {
+		return nil, fmt.Errorf("Request body must be a multipart form smaller than %d MB", MAX_UPLOAD_SIZE>>20)
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, errors.New("Request body must include an image field")
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, MAX_UPLOAD_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > MAX_UPLOAD_SIZE {
+		return nil, fmt.Errorf("Images must be smaller than %d MB", MAX_UPLOAD_SIZE>>20)
+	}
+	if !ALLOWED_IMAGE_TYPES[http.DetectContentType(content)] {
+		return nil, images.ErrUnsupportedFormat
+	}
+	return content, nil
+}
+
+// Random storage keys prevent clients from guessing or overwriting other files
+func newImageKey(directory string, extension string) (string, error) {
+	name, err := utils.GenerateRandomString(16, utils.DJANGO_DEFAULT_ALLOWED_CHAR_SET)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s%s", directory, name, extension), nil
+}
+
+// Strip the metadata of an uploaded image and save it along with its thumbnails. It returns the key of the original
+func saveImage(ctx context.Context, app *application.App, directory string, content []byte) (string, error) {
+	processed, err := images.Process(content)
+	if err != nil {
+		return "", err
+	}
+	key, err := newImageKey(directory, processed.Extension)
+	if err != nil {
+		return "", err
+	}
+	if err = app.Storage.Save(ctx, key, bytes.NewReader(processed.Original)); err != nil {
+		return "", err
+	}
+	for size, thumbnail := range processed.Thumbnails {
+		if err = app.Storage.Save(ctx, images.VariantKey(key, size), bytes.NewReader(thumbnail)); err != nil {
+			deleteImage(ctx, app, key)
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+func respondSaveImageError(app *application.App, w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case images.ErrUnsupportedFormat, images.ErrTooLarge:
+		app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+	case storage.ErrDisabled:
+		app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusServiceUnavailable)
+	default:
+		logging.FromContext(r.Context()).Error("saving the image failed", "error", err)
+		app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+	}
+}
+
+// Remove an image and its thumbnails from the storage
+func deleteImage(ctx context.Context, app *application.App, key string) {
+	for _, imageKey := range images.Keys(key) {
+		if err := app.Storage.Delete(ctx, imageKey); err != nil {
+			logging.FromContext(ctx).Error("deleting the image failed", "key", imageKey, "error", err)
+		}
+	}
+}
+
+// Thumbnail size requested with the image_size parameter. Unsupported sizes return the original image
+func imageSize(r *http.Request) int {
+	size, err := parameters.GetIntParam(r, "image_size", 0)
+	if err != nil || !images.IsThumbnailSize(int(size)) {
+		return 0
+	}
+	return int(size)
+}
+
+// Fill the photos of the coffee shops with their urls. Photos for all the shops are obtained using a single query
+func setPhotos(ctx context.Context, app *application.App, size int, coffeeShops ...*models.CoffeeShop) error {
+	ids := make([]string, len(coffeeShops))
+	for i, coffeeShop := range coffeeShops {
+		ids[i] = coffeeShop.ID
+	}
+	photos, err := app.Repo.GetCoffeeShopPhotos(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, coffeeShop := range coffeeShops {
+		coffeeShop.Photos = photos[coffeeShop.ID]
+		for _, photo := range coffeeShop.Photos {
+			photo.URL = app.Storage.URL(images.VariantKey(photo.Image, size))
+		}
+	}
+	return nil
+}
+
+func setProfilePictures(app *application.App, size int, users ...*models.GetUserResponse) {
+	for _, user := range users {
+		user.ProfilePictureURL = app.Storage.URL(images.VariantKey(user.ProfilePicture, size))
+	}
+}
+
+// Update the current user's profile picture godoc
+// @Summary      Update current user's profile picture
+// @Description  Upload a new profile picture for the current user as the image field of a multipart form. JPEG, PNG and GIF images up to 5 MB and 40 megapixels are allowed. Metadata is removed and thumbnails of 128, 512 and 1024 pixels are generated.
+// @Tags         users
+// @Accept       mpfd
+// @Produce      json
+// @Param user_id path string true "User ID"
+// @Param image formData file true "Profile picture"
+// @Param image_size query int false "Thumbnail size of the returned url: 128, 512 or 1024"
+// @Param Authorization header string true "With the bearer started."
+// @Success      200  {object}  models.GetUserResponse
+// @Header       200  {string}  ETag  "New version of the user"
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Failure      503  {object}  types.ApiError
+// @Router       /users/{user_id}/profile-picture [put]
+func UpdateProfilePicture(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		ctx := r.Context()
+		userId := ctx.Value("userId")
+		// If claims from JWT token and params are differente raise an error
+		if params["id"] != userId {
+			app.Respond(w, types.ApiError{Message: "You don't have permissions to update this account."}, http.StatusBadRequest)
+			return
+		}
+		content, err := readImageUpload(w, r)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		user, err := app.Repo.GetUserById(ctx, params["id"])
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("getting the user failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		key, err := saveImage(ctx, app, "users/"+params["id"], content)
+		if err != nil {
+			respondSaveImageError(app, w, r, err)
+			return
+		}
+		err = app.Repo.UpdateProfilePicture(ctx, params["id"], key)
+		if err != nil {
+			// The new picture isn't referenced by the database
+			deleteImage(ctx, app, key)
+		}
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("saving the profile picture failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		// The previous picture is no longer referenced by the database
+		if user.ProfilePicture != "" {
+			deleteImage(ctx, app, user.ProfilePicture)
+		}
+		// Changing the picture bumps the version of the user
+		updatedUser, err := app.Repo.GetUserById(ctx, params["id"])
+		if err != nil {
+			logging.FromContext(r.Context()).Error("getting the updated user failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		setProfilePictures(app, imageSize(r), updatedUser)
+		setVersionETag(w, updatedUser.Version)
+		app.Respond(w, updatedUser, http.StatusOK)
+	}
+}
+
+// Delete the current user's profile picture godoc
+// @Summary      Delete current user's profile picture
+// @Description  Remove the profile picture of the current user
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param user_id path string true "User ID"
+// @Param Authorization header string true "With the bearer started."
+// @Success      204  {object}  models.EmptyBody
+// @Header       204  {string}  ETag  "New version of the user"
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Router       /users/{user_id}/profile-picture [delete]
+func DeleteProfilePicture(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		ctx := r.Context()
+		userId := ctx.Value("userId")
+		// If claims from JWT token and params are differente raise an error
+		if params["id"] != userId {
+			app.Respond(w, types.ApiError{Message: "You don't have permissions to update this account."}, http.StatusBadRequest)
+			return
+		}
+		user, err := app.Repo.GetUserById(ctx, params["id"])
+		if err == nil {
+			err = app.Repo.UpdateProfilePicture(ctx, params["id"], "")
+		}
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("deleting the profile picture failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		if user.ProfilePicture != "" {
+			deleteImage(ctx, app, user.ProfilePicture)
+		}
+		updatedUser, err := app.Repo.GetUserById(ctx, params["id"])
+		if err != nil {
+			logging.FromContext(r.Context()).Error("getting the updated user failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		setVersionETag(w, updatedUser.Version)
+		app.Respond(w, struct{}{}, http.StatusNoContent)
+	}
+}
+
+// AddCoffeeShopPhoto godoc
+// @Summary      Add a photo to a coffee shop
+// @Description  Upload a coffee shop photo as the image field of a multipart form. JPEG, PNG and GIF images up to 5 MB and 40 megapixels are allowed. Metadata is removed and thumbnails of 128, 512 and 1024 pixels are generated.
+// @Tags         coffee shops
+// @Accept       mpfd
+// @Produce      json
+// @Param coffee_shop_id path string true "Coffee Shop ID"
+// @Param image formData file true "Coffee shop photo"
+// @Param image_size query int false "Thumbnail size of the returned url: 128, 512 or 1024"
+// @Param Authorization header string true "With the bearer started. Only staff members"
+// @Success      201  {object}  models.ShopPhoto
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Failure      503  {object}  types.ApiError
+// @Router       /coffee-shops/{coffee_shop_id}/photos [post]
+func AddCoffeeShopPhoto(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		ctx := r.Context()
+		content, err := readImageUpload(w, r)
+		if err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		_, err = app.Repo.GetCoffeeShopById(ctx, params["id"])
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("getting the coffee shop failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		key, err := saveImage(ctx, app, "shops/"+params["id"], content)
+		if err != nil {
+			respondSaveImageError(app, w, r, err)
+			return
+		}
+		photo, err := app.Repo.AddCoffeeShopPhoto(ctx, &models.ShopPhoto{CoffeeShopId: params["id"], Image: key})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("adding the photo failed", "error", err)
+			deleteImage(ctx, app, key)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		photo.URL = app.Storage.URL(images.VariantKey(photo.Image, imageSize(r)))
+		app.Respond(w, photo, http.StatusCreated)
+	}
+}
+
+// DeleteCoffeeShopPhoto godoc
+// @Summary      Delete a coffee shop photo
+// @Description  Delete a coffee shop photo by its Id.
+// @Tags         coffee shops
+// @Accept       json
+// @Produce      json
+// @Param coffee_shop_id path string true "Coffee Shop ID"
+// @Param photo_id path string true "Photo ID"
+// @Param Authorization header string true "With the bearer started. Only staff members"
+// @Success      204  {object}  models.EmptyBody
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      500  {object}  types.ApiError
+// @Router       /coffee-shops/{coffee_shop_id}/photos/{photo_id} [delete]
+func DeleteCoffeeShopPhoto(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		ctx := r.Context()
+		photo, err := app.Repo.DeleteCoffeeShopPhoto(ctx, params["id"], params["photo_id"])
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("deleting the photo failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		deleteImage(ctx, app, photo.Image)
+		app.Respond(w, struct{}{}, http.StatusNoContent)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/metrics"
 	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
 	"github.com/EduardoZepeda/go-coffee-api/types"
 	"github.com/EduardoZepeda/go-coffee-api/utils"
 	"github.com/EduardoZepeda/go-coffee-api/validator"
@@ -37,18 +39,20 @@ func LoginUser(app *application.App) http.HandlerFunc {
 		}
 		user, err := app.Repo.GetUser(r.Context(), loginRequest.Email)
 		if err == sql.ErrNoRows {
+			app.Metrics.Logins.Inc(metrics.LOGIN_FAILURE)
 			app.Respond(w, types.ApiError{Message: "Invalid credentials"}, http.StatusNotFound)
 			return
 		}
 		passwordChecker, err := utils.NewDjangoPassword(user.Password)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("reading the password hash failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an error in the server. We'll check this issue. Please try again later"}, http.StatusInternalServerError)
 			return
 		}
 		// Verify hashes a password and compares it with the hash passed in when initialized
 		passwordsMatched := passwordChecker.VerifyPassword(loginRequest.Password)
 		if !passwordsMatched {
+			app.Metrics.Logins.Inc(metrics.LOGIN_FAILURE)
 			app.Respond(w, types.ApiError{Message: "Invalid credentials"}, http.StatusNotFound)
 			return
 		}
@@ -61,16 +65,17 @@ func LoginUser(app *application.App) http.HandlerFunc {
 		}
 		//SigningMethodES256 is different than SigningMethodHS256, the later doesn't require a RSA Priv Key as a Signed String
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+		tokenString, err := token.SignedString([]byte(app.Config.JWTSecret.Value()))
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("signing the token failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an error in the server. We'll check this issue. Please try again later"}, http.StatusInternalServerError)
 			return
 		}
 		tokenResponse := models.LoginResponse{
 			Token: tokenString,
 		}
-		app.Logger.Printf("User: %s has logged in", loginRequest.Email)
+		app.Metrics.Logins.Inc(metrics.LOGIN_SUCCESS)
+		logging.FromContext(r.Context()).Info("user logged in", "user_id", user.Id)
 		app.Respond(w, tokenResponse, http.StatusOK)
 	}
 }
@@ -108,11 +113,11 @@ func RegisterUser(app *application.App) http.HandlerFunc {
 		SignUpRequest.HashedPassword = hashedPassword
 		err = app.Repo.RegisterUser(r.Context(), &SignUpRequest)
 		if err != nil {
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Warn("registering the user failed", "error", err)
 			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
 			return
 		}
-		app.Logger.Printf("User with email: %s has been registered", SignUpRequest.Email)
+		logging.FromContext(r.Context()).Info("user registered")
 		app.Respond(w, struct{}{}, http.StatusCreated)
 		return
 	}
@@ -127,13 +132,23 @@ func RegisterUser(app *application.App) http.HandlerFunc {
 // @Param user_id path string true "User ID"
 // @Param request body models.UpdateUserRequest true "User data: id, bio, firstName, lastName and username"
 // @Param Authorization header string true "With the bearer started."
+// @Param If-Match header string true "ETag of the user as it was retrieved, or * to match any version"
 // @Success      200  {object}  models.UpdateUserRequest
+// @Header       200  {string}  ETag  "New version of the user"
 // @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
 // @Failure      500  {object}  types.ApiError
 // @Router       /users/{user_id} [put]
 func UpdateUser(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			respondIfMatchError(app, w, err)
+			return
+		}
 		var UpdateUserRequest = models.UpdateUserRequest{}
 		decoder := json.NewDecoder(r.Body)
 		decoder.DisallowUnknownFields()
@@ -156,17 +171,110 @@ func UpdateUser(app *application.App) http.HandlerFunc {
 		}
 		// Ignore any id coming from user, and assign it to params id
 		UpdateUserRequest.Id = params["id"]
-		err := app.Repo.UpdateUser(ctx, &UpdateUserRequest)
-		if err != nil {
-			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusInternalServerError)
+		if version == ANY_VERSION {
+			current, err := repository.Uncached(app.Repo).GetUserById(ctx, params["id"])
+			if err != nil {
+				respondVersionedWriteError(app, w, r, err)
+				return
+			}
+			version = current.Version
+		}
+		UpdateUserRequest.Version = version
+		if err = app.Repo.UpdateUser(ctx, &UpdateUserRequest); err != nil {
+			respondVersionedWriteError(app, w, r, err)
 			return
 		}
-		app.Logger.Printf("User with Id: %s has been updated", params["id"])
+		logging.FromContext(r.Context()).Info("user updated", "updated_user_id", params["id"])
+		setVersionETag(w, UpdateUserRequest.Version)
 		app.Respond(w, &UpdateUserRequest, http.StatusOK)
 		return
 	}
 }
 
+// Partially update the current user godoc
+// @Summary      Partially update current user,
+// @Description  Update only the fields present in the body of the current user, following JSON merge patch semantics (RFC 7396). Bio, firstName, lastName and username can be updated. The updated user is returned as stored in the database.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param user_id path string true "User ID"
+// @Param request body models.UpdateUserRequest true "User fields to update"
+// @Param Authorization header string true "With the bearer started."
+// @Param If-Match header string true "ETag of the user as it was retrieved, or * to match any version"
+// @Success      200  {object}  models.GetUserResponse
+// @Header       200  {string}  ETag  "New version of the user"
+// @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
+// @Failure      500  {object}  types.ApiError
+// @Router       /users/{user_id} [patch]
+func PatchUser(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		ctx := r.Context()
+		userId := ctx.Value("userId")
+		// If claims from JWT token and params are differente raise an error
+		if params["id"] != userId {
+			app.Respond(w, types.ApiError{Message: "You don't have permissions to update this account."}, http.StatusBadRequest)
+			return
+		}
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			respondIfMatchError(app, w, err)
+			return
+		}
+		user, err := repository.Uncached(app.Repo).GetUserById(ctx, params["id"])
+		switch err {
+		case nil:
+			// Don't merge the patch over a representation the client hasn't seen
+			// If-Match: * patches whatever version was just read
+			if version == ANY_VERSION {
+				version = user.Version
+			}
+			if user.Version != version {
+				respondVersionedWriteError(app, w, r, models.ErrVersionMismatch)
+				return
+			}
+		case sql.ErrNoRows:
+			app.Respond(w, struct{}{}, http.StatusNotFound)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("getting the user failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an error in the server. We'll check this issue. Please try again later"}, http.StatusInternalServerError)
+			return
+		}
+		currentUser := models.UpdateUserRequest{Id: user.Id, FirstName: user.FirstName, LastName: user.LastName, Bio: user.Bio, Username: user.Username}
+		var UpdateUserRequest = models.UpdateUserRequest{}
+		if err = applyMergePatch(w, r, &currentUser, &UpdateUserRequest); err != nil {
+			app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		// Ignore any id coming from user, and assign it to params id
+		UpdateUserRequest.Id = params["id"]
+		v := validator.New()
+		if validator.ValidateUserUpdate(v, &UpdateUserRequest); !v.Valid() {
+			app.Respond(w, types.ApiError{Errors: &v.Errors}, http.StatusBadRequest)
+			return
+		}
+		UpdateUserRequest.Version = version
+		if err = app.Repo.UpdateUser(ctx, &UpdateUserRequest); err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		updatedUser, err := app.Repo.GetUserById(ctx, params["id"])
+		if err != nil {
+			logging.FromContext(r.Context()).Error("getting the updated user failed", "error", err)
+			app.Respond(w, types.ApiError{Message: "There was an error in the server. We'll check this issue. Please try again later"}, http.StatusInternalServerError)
+			return
+		}
+		logging.FromContext(r.Context()).Info("user updated", "updated_user_id", params["id"])
+		setProfilePictures(app, imageSize(r), updatedUser)
+		setVersionETag(w, updatedUser.Version)
+		app.Respond(w, updatedUser, http.StatusOK)
+	}
+}
+
 // Get user account data godoc
 // @Summary      Get an user account data,
 // @Description  Get id, username, email, first name, last name and bio from a user
@@ -174,7 +282,9 @@ func UpdateUser(app *application.App) http.HandlerFunc {
 // @Accept       json
 // @Produce      json
 // @Param user_id path string true "User ID"
+// @Param image_size query int false "Thumbnail size of the profile picture url: 128, 512 or 1024"
 // @Success      200  {object}  models.GetUserResponse
+// @Header       200  {string}  ETag  "Version of the user, send it in If-Match to update or delete it"
 // @Failure      404  {object} models.EmptyBody
 // @Failure      500  {object}  types.ApiError
 // @Router       /users/{user_id} [get]
@@ -184,12 +294,14 @@ func GetUser(app *application.App) http.HandlerFunc {
 		user, err := app.Repo.GetUserById(r.Context(), params["id"])
 		switch err {
 		case nil:
+			setProfilePictures(app, imageSize(r), user)
+			setVersionETag(w, user.Version)
 			app.Respond(w, user, http.StatusOK)
 		case sql.ErrNoRows:
 			app.Respond(w, struct{}{}, http.StatusNotFound)
 			return
 		default:
-			app.Logger.Println(err)
+			logging.FromContext(r.Context()).Error("getting the user failed", "error", err)
 			app.Respond(w, types.ApiError{Message: "There was an error in the server. We'll check this issue. Please try again later"}, http.StatusInternalServerError)
 			return
 		}
@@ -204,8 +316,12 @@ func GetUser(app *application.App) http.HandlerFunc {
 // @Produce      json
 // @Param user_id path string true "User ID"
 // @Param Authorization header string true "With the bearer started."
+// @Param If-Match header string true "ETag of the user as it was retrieved, or * to match any version"
 // @Success      204  {object}  models.EmptyBody
 // @Failure      400  {object}  types.ApiError
+// @Failure      404  {object}  models.EmptyBody
+// @Failure      412  {object}  types.ApiError
+// @Failure      428  {object}  types.ApiError
 // @Failure      500  {object}  types.ApiError
 // @Router       /users/{user_id} [delete]
 func DeleteUser(app *application.App) http.HandlerFunc {
@@ -218,13 +334,28 @@ func DeleteUser(app *application.App) http.HandlerFunc {
 			app.Respond(w, types.ApiError{Message: "You don't have permissions to delete this account."}, http.StatusBadRequest)
 			return
 		}
-		err := app.Repo.DeleteUser(ctx, params["id"])
+		version, err := ifMatchVersion(r)
 		if err != nil {
-			app.Logger.Println(err)
-			app.Respond(w, types.ApiError{Message: "There was an error in the server. We'll check this issue. Please try again later"}, http.StatusInternalServerError)
+			respondIfMatchError(app, w, err)
 			return
 		}
-		app.Logger.Printf("User with Id: %s has been deleted", params["id"])
+		// The profile picture is read before the user is deleted, to delete its image afterwards
+		current, err := repository.Uncached(app.Repo).GetUserById(ctx, params["id"])
+		if err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		if version == ANY_VERSION {
+			version = current.Version
+		}
+		if err = app.Repo.DeleteUser(ctx, params["id"], version); err != nil {
+			respondVersionedWriteError(app, w, r, err)
+			return
+		}
+		if current.ProfilePicture != "" {
+			deleteImage(ctx, app, current.ProfilePicture)
+		}
+		logging.FromContext(r.Context()).Info("user deleted", "deleted_user_id", params["id"])
 		app.Respond(w, struct{}{}, http.StatusNoContent)
 		return
 	}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+)
+
+var (
+	ErrMissingIfMatch = errors.New("This request requires an If-Match header with the ETag of the resource. Retrieve the resource first to get it.")
+	ErrInvalidIfMatch = errors.New("The If-Match header doesn't match the current ETag of the resource. Retrieve the resource again and retry.")
+)
+
+// The ETag of shops, bags and users starts with their version, quoted as a strong entity tag. GET responses append
+// a hash of the body to it, see middleware.ConditionalGet
+func versionETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+func setVersionETag(w http.ResponseWriter, version uint64) {
+	w.Header().Set("ETag", versionETag(version))
+}
+
+// Returned by ifMatchVersion for "If-Match: *", which matches any version of an existing resource. Versions start
+// at 1, so it can't be mistaken for a real one
+const ANY_VERSION uint64 = 0
+
+// Read the version expected by the client from the If-Match header. Only a single entity tag or "*" is accepted,
+// because the write must target one specific version of the resource. The hash of the body is ignored
+func ifMatchVersion(r *http.Request) (uint64, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return 0, ErrMissingIfMatch
+	}
+	if ifMatch == "*" {
+		return ANY_VERSION, nil
+	}
+	if len(ifMatch) < 2 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, ErrInvalidIfMatch
+	}
+	version, _, _ := strings.Cut(ifMatch[1:len(ifMatch)-1], "-")
+	parsedVersion, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidIfMatch
+	}
+	return parsedVersion, nil
+}
+
+// Respond to a request whose If-Match header is missing or malformed
+func respondIfMatchError(app *application.App, w http.ResponseWriter, err error) {
+	if err == ErrMissingIfMatch {
+		app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusPreconditionRequired)
+		return
+	}
+	app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusPreconditionFailed)
+}
+
+// Respond to the errors returned by a conditional write in the repository
+func respondVersionedWriteError(app *application.App, w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case sql.ErrNoRows:
+		app.Respond(w, struct{}{}, http.StatusNotFound)
+	case models.ErrVersionMismatch:
+		app.Respond(w, types.ApiError{Message: ErrInvalidIfMatch.Error()}, http.StatusPreconditionFailed)
+	default:
+		logging.FromContext(r.Context()).Error("conditional write failed", "error", err)
+		app.Respond(w, types.ApiError{Message: "There was an internal server error"}, http.StatusInternalServerError)
+	}
+}
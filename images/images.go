@@ -0,0 +1,140 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	// Register the GIF decoder used by image.Decode
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Width or height, whichever is greater, of the thumbnails generated for every uploaded image
+var THUMBNAIL_SIZES = []int{128, 512, 1024}
+
+const JPEG_QUALITY int = 85
+
+// Width times height of the largest image accepted. Small files can declare huge dimensions, decompression bombs,
+// and the decoders allocate memory for all of their pixels
+const MAX_PIXELS int = 40_000_000
+
+var ErrUnsupportedFormat = errors.New("Only JPEG, PNG and GIF images are allowed")
+
+var ErrTooLarge = fmt.Errorf("Images can't be larger than %d megapixels", MAX_PIXELS/1_000_000)
+
+type ProcessedImage struct {
+	// File extension of the original and the thumbnails, GIF images are converted to PNG
+	Extension  string
+	Original   []byte
+	Thumbnails map[int][]byte
+}
+
+func IsThumbnailSize(size int) bool {
+	for _, thumbnailSize := range THUMBNAIL_SIZES {
+		if size == thumbnailSize {
+			return true
+		}
+	}
+	return false
+}
+
+// VariantKey returns the storage key of a thumbnail, thumbnails are stored next to the original image.
+// For example, the 128 thumbnail of shops/1/photo.jpg is shops/1/photo_128.jpg
+func VariantKey(key string, size int) string {
+	if key == "" || !IsThumbnailSize(size) {
+		return key
+	}
+	extension := path.Ext(key)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(key, extension), size, extension)
+}
+
+// Keys returns the storage keys of the original image and all of its thumbnails
+func Keys(key string) []string {
+	keys := []string{key}
+	for _, size := range THUMBNAIL_SIZES {
+		keys = append(keys, VariantKey(key, size))
+	}
+	return keys
+}
+
+func encode(img image.Image, format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: JPEG_QUALITY})
+	} else {
+		err = png.Encode(&buffer, img)
+	}
+	return buffer.Bytes(), err
+}
+
+func resize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// Images are never enlarged
+	if width <= size && height <= size {
+		return img
+	}
+	if width >= height {
+		width, height = size, height*size/width
+	} else {
+		width, height = width*size/height, size
+	}
+	if width == 0 {
+		width = 1
+	}
+	if height == 0 {
+		height = 1
+	}
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Src, nil)
+	return thumbnail
+}
+
+// Process decodes an uploaded image and encodes it again along with its thumbnails.
+// Encoders don't write any metadata, so EXIF data, GPS coordinates included, is removed from all the files
+func Process(content []byte) (*ProcessedImage, error) {
+	// The header is enough to know the dimensions, the pixels are decoded only if they're within the limit
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width > MAX_PIXELS/config.Height {
+		return nil, ErrTooLarge
+	}
+	img, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	processed := &ProcessedImage{Thumbnails: make(map[int][]byte)}
+	switch format {
+	case "jpeg":
+		img = applyOrientation(img, jpegOrientation(content))
+		processed.Extension = ".jpg"
+	case "png", "gif":
+		format = "png"
+		processed.Extension = ".png"
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	processed.Original, err = encode(img, format)
+	if err != nil {
+		return nil, err
+	}
+	for _, size := range THUMBNAIL_SIZES {
+		processed.Thumbnails[size], err = encode(resize(img, size), format)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return processed, nil
+}
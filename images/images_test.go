@@ -0,0 +1,174 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{255, 0, 0, 255}
+	blue = color.RGBA{0, 0, 255, 255}
+)
+
+// A 32x16 image, red on the left half and blue on the right half
+func halves() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	return img
+}
+
+// An APP1 segment with an EXIF orientation tag, in the given byte order
+func exifSegment(orientation int, byteOrder binary.ByteOrder) []byte {
+	tiff := make([]byte, 26)
+	if byteOrder == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	byteOrder.PutUint16(tiff[2:], 42)
+	byteOrder.PutUint32(tiff[4:], 8)
+	// A single IFD entry: tag 0x0112, type SHORT, count 1 and the value
+	byteOrder.PutUint16(tiff[8:], 1)
+	byteOrder.PutUint16(tiff[10:], 0x0112)
+	byteOrder.PutUint16(tiff[12:], 3)
+	byteOrder.PutUint32(tiff[14:], 1)
+	byteOrder.PutUint16(tiff[18:], uint16(orientation))
+	data := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+// Encode the image as a JPEG with an EXIF orientation tag right after the start of image marker
+func orientedJpeg(t *testing.T, img image.Image, orientation int, byteOrder binary.ByteOrder) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buffer.Bytes()
+	content := append([]byte{}, encoded[:2]...)
+	content = append(content, exifSegment(orientation, byteOrder)...)
+	return append(content, encoded[2:]...)
+}
+
+func isColor(c color.Color, want color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	near := func(value uint32, want uint8) bool {
+		diff := int(value>>8) - int(want)
+		return diff > -40 && diff < 40
+	}
+	return near(r, want.R) && near(g, want.G) && near(b, want.B)
+}
+
+func TestJpegOrientation(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			content := orientedJpeg(t, halves(), orientation, byteOrder)
+			if got := jpegOrientation(content); got != orientation {
+				t.Errorf("%s: expected orientation %d, got %d", byteOrder, orientation, got)
+			}
+		}
+	}
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, halves(), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]byte{
+		"without exif":          buffer.Bytes(),
+		"invalid orientation":   orientedJpeg(t, halves(), 9, binary.BigEndian),
+		"not a jpeg":            []byte("GIF89a"),
+		"truncated exif header": append([]byte{0xFF, 0xD8}, exifSegment(6, binary.BigEndian)[:12]...),
+	}
+	for name, content := range tests {
+		if got := jpegOrientation(content); got != 1 {
+			t.Errorf("%s: expected the default orientation, got %d", name, got)
+		}
+	}
+}
+
+func TestProcessAppliesTheOrientation(t *testing.T) {
+	// Where the red half of the image ends up after each orientation is applied
+	tests := []struct {
+		orientation   int
+		width, height int
+		redAt, blueAt image.Point
+	}{
+		{1, 32, 16, image.Pt(4, 8), image.Pt(28, 8)},
+		{2, 32, 16, image.Pt(28, 8), image.Pt(4, 8)},
+		{3, 32, 16, image.Pt(28, 8), image.Pt(4, 8)},
+		{4, 32, 16, image.Pt(4, 8), image.Pt(28, 8)},
+		{5, 16, 32, image.Pt(8, 4), image.Pt(8, 28)},
+		{6, 16, 32, image.Pt(8, 4), image.Pt(8, 28)},
+		{7, 16, 32, image.Pt(8, 28), image.Pt(8, 4)},
+		{8, 16, 32, image.Pt(8, 28), image.Pt(8, 4)},
+	}
+	for _, test := range tests {
+		processed, err := Process(orientedJpeg(t, halves(), test.orientation, binary.BigEndian))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The orientation tag isn't written again, so it must be applied only once
+		if got := jpegOrientation(processed.Original); got != 1 {
+			t.Errorf("orientation %d: expected the metadata to be removed, got orientation %d", test.orientation, got)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(processed.Original))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != test.width || img.Bounds().Dy() != test.height {
+			t.Errorf("orientation %d: expected %dx%d, got %v", test.orientation, test.width, test.height, img.Bounds())
+			continue
+		}
+		if !isColor(img.At(test.redAt.X, test.redAt.Y), red) || !isColor(img.At(test.blueAt.X, test.blueAt.Y), blue) {
+			t.Errorf("orientation %d: expected red at %v and blue at %v", test.orientation, test.redAt, test.blueAt)
+		}
+	}
+}
+
+func TestProcessGeneratesThumbnails(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 2048, 1024))); err != nil {
+		t.Fatal(err)
+	}
+	processed, err := Process(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed.Extension != ".png" {
+		t.Errorf("expected a png, got %s", processed.Extension)
+	}
+	for _, size := range THUMBNAIL_SIZES {
+		config, err := png.DecodeConfig(bytes.NewReader(processed.Thumbnails[size]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Width != size || config.Height != size/2 {
+			t.Errorf("expected a %dx%d thumbnail, got %dx%d", size, size/2, config.Width, config.Height)
+		}
+	}
+}
+
+func TestProcessRejectsDecompressionBombs(t *testing.T) {
+	// A GIF header declaring 65535x65535 pixels, without any of them
+	bomb := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")
+	if _, err := Process(bomb); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := Process([]byte("not an image")); err != ErrUnsupportedFormat {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package importer reads coffee shops and coffee bags from csv, GeoJSON or json files and saves them through the
+// repository. Rows are read one at a time, validated like the API does and saved in batches, every invalid row is
+// reported with its errors instead of stopping the import.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
+)
+
+const (
+	FORMAT_CSV     = "csv"
+	FORMAT_GEOJSON = "geojson"
+	FORMAT_JSON    = "json"
+	// Meters, coffee shops with the same name closer than this are the same coffee shop
+	DEFAULT_RADIUS = 50
+	// Meters, larger radiuses would merge different branches of the same coffee shop
+	MAX_RADIUS = 1000
+)
+
+var FORMATS = map[string]string{
+	FORMAT_CSV:     "text/csv",
+	FORMAT_GEOJSON: "application/geo+json",
+	FORMAT_JSON:    "application/json",
+}
+
+// The file can't be read at all, like a csv without the required columns or json that isn't an array
+var ErrInvalidFile = errors.New("invalid file")
+
+type Options struct {
+	// Validate and match every row, then roll back instead of saving
+	DryRun bool
+	// Rows saved per transaction, 0 saves every row in a single transaction
+	BatchSize int
+	// Only used by coffee shops, 0 only matches the coffee shops at the same location. Callers default to DEFAULT_RADIUS
+	Radius float64
+}
+
+func (options Options) Validate(v *validator.Validator) {
+	v.Validate(options.BatchSize >= 0, "batch_size", "Batch size must be 0, to import every row at once, or a positive integer")
+	v.Validate(options.Radius >= 0 && options.Radius <= MAX_RADIUS, "radius", fmt.Sprintf("Radius must be a number of meters between 0, to only match the same location, and %d", MAX_RADIUS))
+}
+
+// A row of the file and the errors found while parsing it. Rows that couldn't be parsed at all don't have an item
+type row[T any] struct {
+	number     int
+	item       T
+	errors     map[string]string
+	unreadable bool
+}
+
+// Returns io.EOF after the last row
+type rowReader[T any] func() (*row[T], error)
+
+// Import the coffee shops of the file, matching the existing ones by name and location. Errors are only returned
+// when the file can't be read from the start, otherwise they're part of the report
+func ImportCoffeeShops(ctx context.Context, repo repository.Repository, reader io.Reader, format string, options Options) (*models.ImportReport, error) {
+	var readRow rowReader[*models.CoffeeShop]
+	var err error
+	switch format {
+	case FORMAT_CSV:
+		readRow, err = csvReader(reader, SHOP_COLUMNS, shopFromRecord)
+	case FORMAT_GEOJSON:
+		readRow, err = geoJSONShopReader(reader)
+	case FORMAT_JSON:
+		readRow, err = jsonReader[*models.CoffeeShop](reader)
+	default:
+		err = fmt.Errorf("%w: unknown format %q", ErrInvalidFile, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return importRows(readRow, options, validateCoffeeShop, func(shops []*models.CoffeeShop) ([]string, error) {
+		return repo.ImportCoffeeShops(ctx, shops, options.Radius, options.DryRun)
+	})
+}
+
+// The API doesn't validate the location, since it's always picked from a map
+func validateCoffeeShop(v *validator.Validator, shop *models.CoffeeShop) {
+	validator.ValidateCoffeeShop(v, shop)
+	// Rows without a location are decoded as 0, 0, there aren't coffee shops in the middle of the Atlantic
+	v.Validate(shop.Location != types.Point{}, "Location", "Location is required")
+	v.Validate(shop.Location[0] >= -90 && shop.Location[0] <= 90 && shop.Location[1] >= -180 && shop.Location[1] <= 180, "Location", "Latitude must be between -90 and 90 and longitude between -180 and 180")
+}
+
+// Import the coffee bags of the file, matching the existing ones by brand, species, origin, process and variety
+func ImportCoffeeBags(ctx context.Context, repo repository.Repository, reader io.Reader, format string, options Options) (*models.ImportReport, error) {
+	var readRow rowReader[*models.CoffeeBag]
+	var err error
+	switch format {
+	case FORMAT_CSV:
+		readRow, err = csvReader(reader, BAG_COLUMNS, bagFromRecord)
+	case FORMAT_JSON:
+		readRow, err = jsonReader[*models.CoffeeBag](reader)
+	case FORMAT_GEOJSON:
+		err = fmt.Errorf("%w: coffee bags don't have a location, use csv or json", ErrInvalidFile)
+	default:
+		err = fmt.Errorf("%w: unknown format %q", ErrInvalidFile, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return importRows(readRow, options, validator.ValidateCoffeeBag, func(coffeeBags []*models.CoffeeBag) ([]string, error) {
+		return repo.ImportCoffeeBags(ctx, coffeeBags, options.DryRun)
+	})
+}
+
+// Valid rows are saved every options.BatchSize rows. A batch that fails marks all of its rows as failed, since
+// they're rolled back together, and the import goes on with the next one
+func importRows[T any](readRow rowReader[T], options Options, validate func(v *validator.Validator, item T), save func(items []T) ([]string, error)) (*models.ImportReport, error) {
+	report := &models.ImportReport{DryRun: options.DryRun, Errors: []models.ImportRowError{}}
+	var batch []T
+	var numbers []int
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		actions, err := save(batch)
+		for i, number := range numbers {
+			switch {
+			case err != nil:
+				report.Failed++
+				report.Errors = append(report.Errors, models.ImportRowError{Row: number, Errors: map[string]string{"Batch": err.Error()}})
+			case actions[i] == models.IMPORT_CREATED:
+				report.Created++
+			case actions[i] == models.IMPORT_UPDATED:
+				report.Updated++
+			}
+		}
+		batch, numbers = nil, nil
+	}
+	for {
+		row, err := readRow()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Nothing after this point can be trusted, the rows of the pending batch aren't saved
+			report.Aborted = true
+			report.Failed += len(numbers)
+			report.Errors = append(report.Errors, models.ImportRowError{Errors: map[string]string{"File": err.Error()}})
+			return report, nil
+		}
+		report.Rows++
+		if !row.unreadable {
+			// Every problem of the row is reported at once, the parse errors are more precise than the validation ones
+			v := validator.New()
+			if validate(v, row.item); !v.Valid() && row.errors == nil {
+				row.errors = v.Errors
+			} else if !v.Valid() {
+				for field, message := range v.Errors {
+					if _, ok := row.errors[field]; !ok {
+						row.errors[field] = message
+					}
+				}
+			}
+		}
+		if row.errors != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, models.ImportRowError{Row: row.number, Errors: row.errors})
+			continue
+		}
+		batch, numbers = append(batch, row.item), append(numbers, row.number)
+		if options.BatchSize > 0 && len(batch) >= options.BatchSize {
+			flush()
+		}
+	}
+	flush()
+	return report, nil
+}
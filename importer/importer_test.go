@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/validator"
+)
+
+func TestImportCoffeeShops(t *testing.T) {
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	if _, err := repo.CreateCoffeeShop(ctx, &models.CoffeeShop{Name: "Café Madrid", Address: "Av. Juárez 264", Rating: 4, Location: types.Point{20.6747, -103.349}}); err != nil {
+		t.Fatal(err)
+	}
+	// About 20 meters north of the existing coffee shop
+	moved := `[{"name": "café madrid", "address": "Av. Juárez 266", "rating": 4, "location": [20.6749, -103.349]}]`
+	tests := []struct {
+		name    string
+		content string
+		options Options
+		report  models.ImportReport
+	}{
+		{"dry run", moved, Options{DryRun: true, Radius: DEFAULT_RADIUS}, models.ImportReport{DryRun: true, Rows: 1, Updated: 1}},
+		{"radius 0 only matches the same location", moved, Options{DryRun: true}, models.ImportReport{DryRun: true, Rows: 1, Created: 1}},
+		{"without location", `[{"name": "Café Palermo", "address": "Av. Vallarta 1500", "rating": 4}]`, Options{Radius: DEFAULT_RADIUS}, models.ImportReport{Rows: 1, Failed: 1}},
+		{"within the radius", moved, Options{Radius: DEFAULT_RADIUS}, models.ImportReport{Rows: 1, Updated: 1}},
+	}
+	for _, test := range tests {
+		report, err := ImportCoffeeShops(ctx, repo, strings.NewReader(test.content), FORMAT_JSON, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.DryRun != test.report.DryRun || report.Rows != test.report.Rows || report.Created != test.report.Created || report.Updated != test.report.Updated || report.Failed != test.report.Failed {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.report, *report)
+		}
+	}
+	shops, err := repo.GetCoffeeShops(ctx, 0, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 1 || shops[0].Address != "Av. Juárez 266" {
+		t.Errorf("expected only the existing coffee shop to be updated, got %d coffee shops", len(shops))
+	}
+	if _, err = ImportCoffeeShops(ctx, repo, strings.NewReader(moved), "xml", Options{}); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("expected an invalid file for an unknown format, got %v", err)
+	}
+}
+
+func TestImportRowsInBatches(t *testing.T) {
+	content := "brand,species,origin,weight\n" +
+		"Café Chiapas,Ar,Chiapas,250\n" +
+		"Café Veracruz,Ar,Veracruz,heavy\n" +
+		"Café Oaxaca,Ar,Oaxaca,500\n" +
+		"Café Puebla,Ar,Puebla,1000\n"
+	report, err := ImportCoffeeBags(context.Background(), database.NewMemoryRepository(), strings.NewReader(content), FORMAT_CSV, Options{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The invalid row doesn't stop the import, and it's reported with its line
+	if report.Rows != 4 || report.Created != 3 || report.Failed != 1 || len(report.Errors) != 1 || report.Errors[0].Row != 3 {
+		t.Errorf("unexpected report %+v", *report)
+	}
+	if _, err = ImportCoffeeBags(context.Background(), database.NewMemoryRepository(), strings.NewReader("{}"), FORMAT_GEOJSON, Options{}); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("expected coffee bags to reject GeoJSON, got %v", err)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		options Options
+		valid   bool
+	}{
+		{Options{}, true},
+		{Options{BatchSize: 100, Radius: MAX_RADIUS}, true},
+		{Options{BatchSize: -1}, false},
+		{Options{Radius: -1}, false},
+		{Options{Radius: MAX_RADIUS + 1}, false},
+	}
+	for _, test := range tests {
+		v := validator.New()
+		if test.options.Validate(v); v.Valid() != test.valid {
+			t.Errorf("%+v: expected valid %t, got the errors %v", test.options, test.valid, v.Errors)
+		}
+	}
+}
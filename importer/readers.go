@@ -0,0 +1,307 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+)
+
+// Columns of the csv files and whether they're required, the header can list them in any order and case
+var SHOP_COLUMNS = map[string]bool{
+	"name":      true,
+	"address":   true,
+	"latitude":  true,
+	"longitude": true,
+	"city":      false,
+	"roaster":   false,
+	"rating":    false,
+}
+
+var BAG_COLUMNS = map[string]bool{
+	"brand":         true,
+	"species":       true,
+	"origin":        true,
+	"roast":         false,
+	"process":       false,
+	"altitude":      false,
+	"variety":       false,
+	"tasting_notes": false,
+	"weight":        false,
+	"price":         false,
+}
+
+// Separates the tasting notes inside their csv column
+const TASTING_NOTES_SEPARATOR = ";"
+
+// Spreadsheets often save a byte order mark before the header
+const BYTE_ORDER_MARK = "\ufeff"
+
+// Reads the header, then a row per record. Records are converted with fromRecord, which gets the fields by column
+func csvReader[T any](reader io.Reader, columns map[string]bool, fromRecord func(fields map[string]string) (T, map[string]string)) (rowReader[T], error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: the csv header can't be read: %v", ErrInvalidFile, err)
+	}
+	found := make(map[string]bool)
+	var problems []string
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, BYTE_ORDER_MARK)))
+		header[i] = column
+		if _, ok := columns[column]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown column %q", column))
+		} else if found[column] {
+			problems = append(problems, fmt.Sprintf("repeated column %q", column))
+		}
+		found[column] = true
+	}
+	for column, required := range columns {
+		if required && !found[column] {
+			problems = append(problems, fmt.Sprintf("missing column %q", column))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFile, strings.Join(problems, ", "))
+	}
+	return func() (*row[T], error) {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		line, _ := csvReader.FieldPos(0)
+		// A record with the wrong number of fields doesn't stop the reader, unlike broken quotes
+		if errors.Is(err, csv.ErrFieldCount) {
+			return &row[T]{number: line, errors: map[string]string{"Row": fmt.Sprintf("Expected %d fields, got %d", len(header), len(record))}, unreadable: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]string, len(header))
+		for i, column := range header {
+			fields[column] = strings.TrimSpace(record[i])
+		}
+		item, rowErrors := fromRecord(fields)
+		return &row[T]{number: line, item: item, errors: rowErrors}, nil
+	}, nil
+}
+
+func shopFromRecord(fields map[string]string) (*models.CoffeeShop, map[string]string) {
+	rowErrors := make(map[string]string)
+	shop := &models.CoffeeShop{Name: fields["name"], Address: fields["address"], City: fields["city"]}
+	if fields["latitude"] == "" || fields["longitude"] == "" {
+		rowErrors["Location"] = "Latitude and longitude are required"
+	} else {
+		shop.Location[0] = parseFloat(rowErrors, "Location", fields["latitude"], "Latitude and longitude must be numbers")
+		shop.Location[1] = parseFloat(rowErrors, "Location", fields["longitude"], "Latitude and longitude must be numbers")
+	}
+	if fields["rating"] != "" {
+		shop.Rating = float32(parseFloat(rowErrors, "Rating", fields["rating"], "Rating must be a floating number between 0 and 5.0"))
+	}
+	if fields["roaster"] != "" {
+		roaster, err := strconv.ParseBool(fields["roaster"])
+		if err != nil {
+			rowErrors["Roaster"] = "Roaster must be true or false"
+		}
+		shop.Roaster = roaster
+	}
+	if len(rowErrors) == 0 {
+		return shop, nil
+	}
+	return shop, rowErrors
+}
+
+func bagFromRecord(fields map[string]string) (*models.CoffeeBag, map[string]string) {
+	rowErrors := make(map[string]string)
+	coffeeBag := &models.CoffeeBag{
+		Brand:   fields["brand"],
+		Species: choiceCode(database.COFFEE_SPECIES, fields["species"]),
+		Origin:  choiceCode(database.STATE_CHOICES, fields["origin"]),
+		Roast:   choiceCode(database.ROAST_LEVELS, fields["roast"]),
+		Process: choiceCode(database.COFFEE_PROCESSES, fields["process"]),
+		Variety: fields["variety"],
+	}
+	if fields["altitude"] != "" {
+		altitude := parseInt(rowErrors, "Altitude", fields["altitude"], "Altitude must be an integer between 0 and 5000 meters")
+		coffeeBag.Altitude = &altitude
+	}
+	if fields["weight"] != "" {
+		weight := parseInt(rowErrors, "Weight", fields["weight"], "Weight must be an integer between 1 and 10000 grams")
+		coffeeBag.Weight = &weight
+	}
+	if fields["price"] != "" {
+		price := parseFloat(rowErrors, "Price", fields["price"], "Price must be a number between 0 and 999999.99 MXN")
+		coffeeBag.Price = &price
+	}
+	if fields["tasting_notes"] != "" {
+		for _, note := range strings.Split(fields["tasting_notes"], TASTING_NOTES_SEPARATOR) {
+			coffeeBag.TastingNotes = append(coffeeBag.TastingNotes, strings.TrimSpace(note))
+		}
+	}
+	if len(rowErrors) == 0 {
+		return coffeeBag, nil
+	}
+	return coffeeBag, rowErrors
+}
+
+// Files can use the codes, like Ar, or the names the API shows, like Arábiga
+func choiceCode(choices map[string]string, value string) string {
+	if _, ok := choices[value]; ok {
+		return value
+	}
+	return database.ChoiceCode(choices, value)
+}
+
+// Empty values are errors too, optional columns are only parsed when they have a value
+func parseFloat(rowErrors map[string]string, field string, value string, message string) float64 {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		rowErrors[field] = message
+	}
+	return number
+}
+
+func parseInt(rowErrors map[string]string, field string, value string, message string) int {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		rowErrors[field] = message
+	}
+	return number
+}
+
+type feature struct {
+	Type     string `json:"type"`
+	Geometry *struct {
+		Type string `json:"type"`
+		// Longitude first, like every GeoJSON position
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		Name    string  `json:"name"`
+		Address string  `json:"address"`
+		City    string  `json:"city"`
+		Roaster bool    `json:"roaster"`
+		Rating  float32 `json:"rating"`
+	} `json:"properties"`
+}
+
+// Reads the features of a FeatureCollection one at a time, the members after the features are ignored
+func geoJSONShopReader(reader io.Reader) (rowReader[*models.CoffeeShop], error) {
+	decoder := json.NewDecoder(reader)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, fmt.Errorf("%w: the GeoJSON must be a FeatureCollection: %v", ErrInvalidFile, err)
+	}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: the GeoJSON must be a FeatureCollection: %v", ErrInvalidFile, err)
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: the GeoJSON FeatureCollection doesn't have features", ErrInvalidFile)
+		}
+		if key == "features" {
+			break
+		}
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		if key == "type" && string(value) != `"FeatureCollection"` {
+			return nil, fmt.Errorf("%w: the GeoJSON must be a FeatureCollection, got %s", ErrInvalidFile, value)
+		}
+	}
+	if err := expectDelim(decoder, '['); err != nil {
+		return nil, fmt.Errorf("%w: the features must be an array: %v", ErrInvalidFile, err)
+	}
+	number := 0
+	return func() (*row[*models.CoffeeShop], error) {
+		if !decoder.More() {
+			return nil, io.EOF
+		}
+		number++
+		featureRow, err := decodeItem[feature](decoder, number)
+		if err != nil {
+			return nil, err
+		}
+		if featureRow.unreadable {
+			return &row[*models.CoffeeShop]{number: number, errors: featureRow.errors, unreadable: true}, nil
+		}
+		shopFeature := featureRow.item
+		shop := &models.CoffeeShop{
+			Name:    shopFeature.Properties.Name,
+			Address: shopFeature.Properties.Address,
+			City:    shopFeature.Properties.City,
+			Roaster: shopFeature.Properties.Roaster,
+			Rating:  shopFeature.Properties.Rating,
+		}
+		geometry := shopFeature.Geometry
+		if shopFeature.Type != "Feature" || geometry == nil || geometry.Type != "Point" || len(geometry.Coordinates) < 2 {
+			return &row[*models.CoffeeShop]{number: number, item: shop, errors: map[string]string{"Location": "Every feature must have a Point geometry"}}, nil
+		}
+		shop.Location = types.Point{geometry.Coordinates[1], geometry.Coordinates[0]}
+		return &row[*models.CoffeeShop]{number: number, item: shop}, nil
+	}, nil
+}
+
+// Reads the items of a json array one at a time, like the files written by coffeectl export
+func jsonReader[T any](reader io.Reader) (rowReader[T], error) {
+	decoder := json.NewDecoder(reader)
+	if err := expectDelim(decoder, '['); err != nil {
+		return nil, fmt.Errorf("%w: the json must be an array: %v", ErrInvalidFile, err)
+	}
+	number := 0
+	return func() (*row[T], error) {
+		if !decoder.More() {
+			return nil, io.EOF
+		}
+		number++
+		return decodeItem[T](decoder, number)
+	}, nil
+}
+
+// The item is read completely before converting it, so an item with a field of the wrong type is reported and
+// the rest of the file can still be read
+func decodeItem[T any](decoder *json.Decoder, number int) (*row[T], error) {
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	var item T
+	if bytes.Equal(raw, []byte("null")) {
+		return &row[T]{number: number, errors: map[string]string{"Row": "Must be a json object, got null"}, unreadable: true}, nil
+	}
+	var typeError *json.UnmarshalTypeError
+	err := json.Unmarshal(raw, &item)
+	switch {
+	case errors.As(err, &typeError) && typeError.Field == "":
+		return &row[T]{number: number, errors: map[string]string{"Row": "Must be a json object, got " + typeError.Value}, unreadable: true}, nil
+	case errors.As(err, &typeError):
+		return &row[T]{number: number, errors: map[string]string{typeError.Field: fmt.Sprintf("Must be a json %s, got %s", typeError.Type, typeError.Value)}, unreadable: true}, nil
+	case err != nil:
+		return &row[T]{number: number, errors: map[string]string{"Row": err.Error()}, unreadable: true}, nil
+	}
+	return &row[T]{number: number, item: item}, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+)
+
+// Read every row, the error is the one that stopped the reader
+func readAll[T any](readRow rowReader[T]) ([]*row[T], error) {
+	var rows []*row[T]
+	for {
+		row, err := readRow()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestCsvShopReader(t *testing.T) {
+	const header = "name,address,latitude,longitude,roaster,rating\n"
+	tests := []struct {
+		name     string
+		record   string
+		location types.Point
+		rating   float32
+		errors   map[string]string
+	}{
+		{"valid", "Café Madrid,Av. Juárez 264,20.6747,-103.349,true,4.5", types.Point{20.6747, -103.349}, 4.5, nil},
+		{"optional columns empty", "Café Madrid,Av. Juárez 264, 20.6747 , -103.349,,", types.Point{20.6747, -103.349}, 0, nil},
+		{"empty latitude", "Café Madrid,Av. Juárez 264,,-103.349,,", types.Point{}, 0, map[string]string{"Location": "Latitude and longitude are required"}},
+		{"empty longitude", "Café Madrid,Av. Juárez 264,20.6747,,,", types.Point{}, 0, map[string]string{"Location": "Latitude and longitude are required"}},
+		{"invalid latitude", "Café Madrid,Av. Juárez 264,north,-103.349,,", types.Point{0, -103.349}, 0, map[string]string{"Location": "Latitude and longitude must be numbers"}},
+		{"invalid roaster and rating", "Café Madrid,Av. Juárez 264,20.6747,-103.349,maybe,good", types.Point{20.6747, -103.349}, 0, map[string]string{
+			"Roaster": "Roaster must be true or false",
+			"Rating":  "Rating must be a floating number between 0 and 5.0",
+		}},
+	}
+	for _, test := range tests {
+		readRow, err := csvReader(strings.NewReader(header+test.record+"\n"), SHOP_COLUMNS, shopFromRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := readAll(readRow)
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("%s: expected a row, got %d rows and %v", test.name, len(rows), err)
+		}
+		shop := rows[0].item
+		if rows[0].number != 2 || shop.Name != "Café Madrid" || shop.Location != test.location || shop.Rating != test.rating {
+			t.Errorf("%s: unexpected row %d %+v", test.name, rows[0].number, shop)
+		}
+		if !reflect.DeepEqual(rows[0].errors, test.errors) {
+			t.Errorf("%s: expected the errors %v, got %v", test.name, test.errors, rows[0].errors)
+		}
+	}
+}
+
+func TestCsvBagReader(t *testing.T) {
+	content := BYTE_ORDER_MARK + "Brand, Species ,Origin,Tasting_Notes,Weight,Price\n" +
+		"Café Chiapas,Arábiga,Chiapas,Chocolate; Nuez,250,189.5\n" +
+		"Café Veracruz,Ar,Ver,,heavy,\n" +
+		"Café Oaxaca,Ar\n"
+	readRow, err := csvReader(strings.NewReader(content), BAG_COLUMNS, bagFromRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readAll(readRow)
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d and %v", len(rows), err)
+	}
+	// The header is case insensitive, can have a byte order mark and the display names are read as codes
+	coffeeBag := rows[0].item
+	if rows[0].errors != nil || coffeeBag.Species != "Ar" || coffeeBag.Origin != "07" || *coffeeBag.Weight != 250 || *coffeeBag.Price != 189.5 || !reflect.DeepEqual([]string(coffeeBag.TastingNotes), []string{"Chocolate", "Nuez"}) {
+		t.Errorf("unexpected row %+v with errors %v", coffeeBag, rows[0].errors)
+	}
+	if expected := map[string]string{"Weight": "Weight must be an integer between 1 and 10000 grams"}; !reflect.DeepEqual(rows[1].errors, expected) || rows[1].item.Price != nil {
+		t.Errorf("expected the errors %v, got %v", expected, rows[1].errors)
+	}
+	// A record with missing fields is reported and the reader goes on
+	if rows[2].number != 4 || !rows[2].unreadable || rows[2].errors["Row"] != "Expected 6 fields, got 2" {
+		t.Errorf("unexpected row %d %v", rows[2].number, rows[2].errors)
+	}
+}
+
+func TestCsvReaderRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		error   string
+	}{
+		{"empty", "", "the csv header can't be read"},
+		{"missing column", "name,address,latitude\n", `missing column "longitude"`},
+		{"unknown and repeated columns", "name,address,latitude,longitude,name,phone\n", `repeated column "name", unknown column "phone"`},
+	}
+	for _, test := range tests {
+		_, err := csvReader(strings.NewReader(test.content), SHOP_COLUMNS, shopFromRecord)
+		if !errors.Is(err, ErrInvalidFile) || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: expected an invalid file with %q, got %v", test.name, test.error, err)
+		}
+	}
+	// Broken quotes stop the reader, the rows after them can't be told apart
+	readRow, err := csvReader(strings.NewReader("name,address,latitude,longitude\nCafé,\"Juárez,1,2\n"), SHOP_COLUMNS, shopFromRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := readAll(readRow); err == nil || len(rows) != 0 {
+		t.Errorf("expected the reader to stop, got %d rows and %v", len(rows), err)
+	}
+}
+
+func TestGeoJSONShopReader(t *testing.T) {
+	tests := []struct {
+		name       string
+		feature    string
+		location   types.Point
+		errors     map[string]string
+		unreadable bool
+	}{
+		{"valid", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-103.349, 20.6747]}, "properties": {"name": "Café Madrid", "rating": 4.5}}`, types.Point{20.6747, -103.349}, nil, false},
+		{"without geometry", `{"type": "Feature", "properties": {"name": "Café Madrid"}}`, types.Point{}, map[string]string{"Location": "Every feature must have a Point geometry"}, false},
+		{"not a point", `{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[-103.349, 20.6747], [-103.35, 20.67]]}, "properties": {"name": "Café Madrid"}}`, types.Point{}, nil, true},
+		{"single coordinate", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-103.349]}, "properties": {"name": "Café Madrid"}}`, types.Point{}, map[string]string{"Location": "Every feature must have a Point geometry"}, false},
+		{"not a feature", `{"type": "Point", "geometry": {"type": "Point", "coordinates": [-103.349, 20.6747]}, "properties": {"name": "Café Madrid"}}`, types.Point{}, map[string]string{"Location": "Every feature must have a Point geometry"}, false},
+		{"null", `null`, types.Point{}, map[string]string{"Row": "Must be a json object, got null"}, true},
+		{"property of the wrong type", `{"type": "Feature", "properties": {"rating": "good"}}`, types.Point{}, nil, true},
+	}
+	for _, test := range tests {
+		content := `{"type": "FeatureCollection", "features": [` + test.feature + `], "bbox": [0, 0, 1, 1]}`
+		readRow, err := geoJSONShopReader(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := readAll(readRow)
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("%s: expected a row, got %d rows and %v", test.name, len(rows), err)
+		}
+		if rows[0].unreadable != test.unreadable || (test.unreadable && len(rows[0].errors) == 0) {
+			t.Errorf("%s: expected unreadable %t, got %t with %v", test.name, test.unreadable, rows[0].unreadable, rows[0].errors)
+		}
+		if test.errors != nil && !reflect.DeepEqual(rows[0].errors, test.errors) {
+			t.Errorf("%s: expected the errors %v, got %v", test.name, test.errors, rows[0].errors)
+		}
+		if !test.unreadable && rows[0].item.Location != test.location {
+			t.Errorf("%s: expected the location %v, got %v", test.name, test.location, rows[0].item.Location)
+		}
+	}
+}
+
+func TestGeoJSONShopReaderRejectsInvalidFiles(t *testing.T) {
+	tests := map[string]string{
+		"not an object":         `[]`,
+		"not a collection":      `{"type": "Feature", "features": []}`,
+		"without features":      `{"type": "FeatureCollection"}`,
+		"features not an array": `{"type": "FeatureCollection", "features": {}}`,
+	}
+	for name, content := range tests {
+		if _, err := geoJSONShopReader(strings.NewReader(content)); !errors.Is(err, ErrInvalidFile) {
+			t.Errorf("%s: expected an invalid file, got %v", name, err)
+		}
+	}
+}
+
+func TestJsonReader(t *testing.T) {
+	content := `[{"name": "Café Madrid", "location": [20.6747, -103.349]}, 1, {"name": 2}, {"name": "Café Palermo"}`
+	readRow, err := jsonReader[*models.CoffeeShop](strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readAll(readRow)
+	// The array isn't closed, the rows before the end are still read
+	if err == nil || len(rows) != 4 {
+		t.Fatalf("expected 4 rows and an error, got %d and %v", len(rows), err)
+	}
+	if rows[0].errors != nil || rows[0].item.Location != (types.Point{20.6747, -103.349}) {
+		t.Errorf("unexpected row %+v with errors %v", rows[0].item, rows[0].errors)
+	}
+	if rows[1].number != 2 || !rows[1].unreadable || rows[1].errors["Row"] != "Must be a json object, got number" {
+		t.Errorf("unexpected row %d %v", rows[1].number, rows[1].errors)
+	}
+	if !rows[2].unreadable || rows[2].errors["name"] != "Must be a json string, got number" {
+		t.Errorf("unexpected errors %v", rows[2].errors)
+	}
+	if rows[3].unreadable || rows[3].item.Name != "Café Palermo" {
+		t.Errorf("unexpected row %+v", rows[3].item)
+	}
+	if _, err = jsonReader[*models.CoffeeShop](strings.NewReader(`{"name": "Café Madrid"}`)); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("expected an invalid file, got %v", err)
+	}
+}
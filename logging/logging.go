@@ -0,0 +1,206 @@
+// Package logging writes leveled logs as json lines, one object per event with the time, level, message and the
+// fields of the event. Emails, tokens and other secrets are redacted before they're written.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Level int
+
+const (
+	LEVEL_DEBUG Level = iota
+	LEVEL_INFO
+	LEVEL_WARN
+	LEVEL_ERROR
+)
+
+var LEVELS = map[string]Level{
+	"debug": LEVEL_DEBUG,
+	"info":  LEVEL_INFO,
+	"warn":  LEVEL_WARN,
+	"error": LEVEL_ERROR,
+}
+
+func (level Level) String() string {
+	for name, value := range LEVELS {
+		if value == level {
+			return name
+		}
+	}
+	return fmt.Sprintf("level(%d)", int(level))
+}
+
+func ParseLevel(name string) (Level, error) {
+	level, ok := LEVELS[strings.ToLower(name)]
+	if !ok {
+		return LEVEL_INFO, fmt.Errorf("unknown log level %q, use debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// Key used for the fields without a key, when a field is passed without its value
+const MISSING_KEY = "!MISSING"
+
+// Destination shared by a logger and the loggers derived from it with With
+type output struct {
+	mu     sync.Mutex
+	writer io.Writer
+	level  Level
+	now    func() time.Time
+}
+
+// Fields are key value pairs, like Info("user logged in", "user_id", id)
+type Logger struct {
+	output *output
+	fields []interface{}
+}
+
+func New(writer io.Writer, level Level) *Logger {
+	return &Logger{output: &output{writer: writer, level: level, now: time.Now}}
+}
+
+var defaultLogger atomic.Value
+
+func init() {
+	defaultLogger.Store(New(os.Stderr, LEVEL_INFO))
+}
+
+// Logger of the code that doesn't have one, like the commands before the configuration is loaded
+func Default() *Logger {
+	return defaultLogger.Load().(*Logger)
+}
+
+// Replace the default logger, once the configuration is loaded
+func SetDefault(logger *Logger) {
+	defaultLogger.Store(logger)
+}
+
+// A logger that writes the fields of l and the given fields in every event
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &Logger{output: l.output, fields: fields}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.output.level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.Log(LEVEL_DEBUG, msg, keyvals...)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.Log(LEVEL_INFO, msg, keyvals...)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.Log(LEVEL_WARN, msg, keyvals...)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.Log(LEVEL_ERROR, msg, keyvals...)
+}
+
+// Log at the error level and stop the program
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.Log(LEVEL_ERROR, msg, keyvals...)
+	os.Exit(1)
+}
+
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeValue(&line, l.output.now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeValue(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeValue(&line, redactString(msg))
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	for i := 0; i < len(fields); i += 2 {
+		key, value := MISSING_KEY, fields[i]
+		if i+1 < len(fields) {
+			key, value = fmt.Sprint(fields[i]), fields[i+1]
+		}
+		line.WriteByte(',')
+		writeValue(&line, key)
+		line.WriteByte(':')
+		writeValue(&line, redact(key, value))
+	}
+	line.WriteString("}\n")
+	l.output.mu.Lock()
+	defer l.output.mu.Unlock()
+	l.output.writer.Write(line.Bytes())
+}
+
+// Values that can't be encoded, like channels, are written as text
+func writeValue(line *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	line.Write(encoded)
+}
+
+// A *log.Logger that writes every line as an event with the given level, for code that needs the standard logger,
+// like http.Server.ErrorLog
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(&stdWriter{logger: l, level: level}, "", 0)
+}
+
+type stdWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (writer *stdWriter) Write(p []byte) (int, error) {
+	writer.logger.Log(writer.level, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+type contextKey struct{}
+
+// The logger of a request. It's shared by every handler and middleware that gets the context, so the fields added
+// with AddFields are also written by the middleware that created it
+type scope struct {
+	mu     sync.Mutex
+	logger *Logger
+}
+
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &scope{logger: logger})
+}
+
+// The logger of the request, or the default logger outside of one
+func FromContext(ctx context.Context) *Logger {
+	if scope, ok := ctx.Value(contextKey{}).(*scope); ok {
+		scope.mu.Lock()
+		defer scope.mu.Unlock()
+		return scope.logger
+	}
+	return Default()
+}
+
+// Add fields to every event logged with the logger of the context from now on, like the user id once the request is
+// authenticated. It does nothing outside of a request
+func AddFields(ctx context.Context, keyvals ...interface{}) {
+	if scope, ok := ctx.Value(contextKey{}).(*scope); ok {
+		scope.mu.Lock()
+		defer scope.mu.Unlock()
+		scope.logger = scope.logger.With(keyvals...)
+	}
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const REDACTED = "[REDACTED]"
+
+// Fields whose key contains any of these words are never written, at any depth of the structs and maps logged
+var SENSITIVE_KEYS = []string{"password", "token", "secret", "authorization", "cookie"}
+
+var (
+	emailPattern  = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+)
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range SENSITIVE_KEYS {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Emails keep their first character and their domain, enough to tell users apart without identifying them. Tokens
+// found inside any text are removed
+func redactString(text string) string {
+	text = jwtPattern.ReplaceAllString(text, REDACTED)
+	text = bearerPattern.ReplaceAllString(text, "${1}"+REDACTED)
+	return emailPattern.ReplaceAllString(text, "${1}***@${2}")
+}
+
+// The value of a field as it's written, errors and other text are redacted and durations are written in milliseconds
+func redact(key string, value interface{}) interface{} {
+	if isSensitive(key) {
+		return REDACTED
+	}
+	switch value := value.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return value
+	case string:
+		return redactString(value)
+	case error:
+		return redactString(value.Error())
+	case time.Duration:
+		return float64(value) / float64(time.Millisecond)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	case json.Marshaler, fmt.Stringer:
+		// Types that choose how they're shown, like config.Secret, are written the way they choose
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return redactString(fmt.Sprint(value))
+		}
+		return redactJSON(encoded)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return redactString(fmt.Sprintf("%+v", value))
+		}
+		return redactJSON(encoded)
+	}
+}
+
+// Structs, maps and slices are written as json, their sensitive keys are redacted at any depth, like the password
+// of a request inside another struct
+func redactJSON(encoded []byte) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return json.RawMessage(redactString(string(encoded)))
+	}
+	return redactTree(value)
+}
+
+func redactTree(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if isSensitive(key) {
+				value[key] = REDACTED
+			} else {
+				value[key] = redactTree(field)
+			}
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactTree(item)
+		}
+		return value
+	case string:
+		return redactString(value)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import "database/sql"
+
+// Prefix of the metrics of the API
+const NAMESPACE = "coffee_api"
+
+// Results of the logins
+const (
+	LOGIN_SUCCESS = "success"
+	LOGIN_FAILURE = "failure"
+)
+
+// Metrics of the API, the pool and websocket gauges are added once the repository and the hub exist
+type Metrics struct {
+	Registry        *Registry
+	Requests        *CounterVec
+	RequestDuration *HistogramVec
+	RateLimited     *CounterVec
+	Logins          *CounterVec
+}
+
+func New() *Metrics {
+	registry := NewRegistry()
+	return &Metrics{
+		Registry:        registry,
+		Requests:        registry.NewCounterVec(NAMESPACE+"_http_requests_total", "Requests answered, by method, route and status.", "method", "route", "status"),
+		RequestDuration: registry.NewHistogramVec(NAMESPACE+"_http_request_duration_seconds", "Time to answer the requests, by method and route.", DEFAULT_BUCKETS, "method", "route"),
+		RateLimited:     registry.NewCounterVec(NAMESPACE+"_http_rate_limited_requests_total", "Requests rejected by the rate limiter."),
+		Logins:          registry.NewCounterVec(NAMESPACE+"_logins_total", "Login attempts, by result.", "result"),
+	}
+}
+
+// Gauges and counters of a database pool, read from sql.DB.Stats on every scrape
+func (metrics *Metrics) RegisterDBStats(stats func() sql.DBStats) {
+	registry := metrics.Registry
+	registry.NewGaugeFunc(NAMESPACE+"_db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+		return float64(stats().MaxOpenConnections)
+	})
+	registry.NewGaugeFunc(NAMESPACE+"_db_open_connections", "Connections to the database, in use or idle.", func() float64 {
+		return float64(stats().OpenConnections)
+	})
+	registry.NewGaugeFunc(NAMESPACE+"_db_in_use_connections", "Connections to the database in use.", func() float64 {
+		return float64(stats().InUse)
+	})
+	registry.NewGaugeFunc(NAMESPACE+"_db_idle_connections", "Idle connections to the database.", func() float64 {
+		return float64(stats().Idle)
+	})
+	registry.NewCounterFunc(NAMESPACE+"_db_wait_count_total", "Times a query waited for a free connection.", func() float64 {
+		return float64(stats().WaitCount)
+	})
+	registry.NewCounterFunc(NAMESPACE+"_db_wait_duration_seconds_total", "Time the queries waited for a free connection.", func() float64 {
+		return stats().WaitDuration.Seconds()
+	})
+	registry.NewCounterFunc(NAMESPACE+"_db_max_idle_closed_total", "Connections closed because the pool had too many idle connections.", func() float64 {
+		return float64(stats().MaxIdleClosed)
+	})
+	registry.NewCounterFunc(NAMESPACE+"_db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.", func() float64 {
+		return float64(stats().MaxLifetimeClosed)
+	})
+}
+
+// Gauge of the clients connected to the websocket hub
+func (metrics *Metrics) RegisterWebSocketClients(clients func() int) {
+	metrics.Registry.NewGaugeFunc(NAMESPACE+"_websocket_clients", "Clients connected to the websocket hub.", func() float64 {
+		return float64(clients())
+	})
+}
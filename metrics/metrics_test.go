@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesTheTextFormat(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("requests_total", "Requests.\nBy route.", "route")
+	registry.NewCounterVec("rejected_total", "Rejected requests.")
+	latency := registry.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	registry.NewGaugeFunc("clients", "Clients.", func() float64 { return 3 })
+	requests.Inc(`/a "quoted" \ route`)
+	requests.Add(2, "/b")
+	requests.Add(-1, "/b")
+	latency.Observe(0.05, "/b")
+	latency.Observe(0.1, "/b")
+	latency.Observe(5, "/b")
+	expected := `# HELP clients Clients.
+# TYPE clients gauge
+clients 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/b",le="0.1"} 2
+latency_seconds_bucket{route="/b",le="1"} 2
+latency_seconds_bucket{route="/b",le="+Inf"} 3
+latency_seconds_sum{route="/b"} 5.15
+latency_seconds_count{route="/b"} 3
+# HELP rejected_total Rejected requests.
+# TYPE rejected_total counter
+rejected_total 0
+# HELP requests_total Requests.\nBy route.
+# TYPE requests_total counter
+requests_total{route="/a \"quoted\" \\ route"} 1
+requests_total{route="/b"} 2
+`
+	var output strings.Builder
+	written, err := registry.WriteTo(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, output.String())
+	}
+	if written != int64(len(expected)) {
+		t.Errorf("expected %d bytes written, got %d", len(expected), written)
+	}
+}
+
+func TestRegistryHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounterVec("logins_total", "Logins.", "result").Inc("success")
+	w := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := w.Header().Get("Content-Type"); contentType != CONTENT_TYPE {
+		t.Errorf("expected the content type %q, got %q", CONTENT_TYPE, contentType)
+	}
+	if !strings.Contains(w.Body.String(), `logins_total{result="success"} 1`) {
+		t.Errorf("expected the login to be counted, got\n%s", w.Body.String())
+	}
+}
+
+func TestRegisteringANameTwicePanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounterVec("requests_total", "Requests.")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected the second registration to panic")
+		}
+	}()
+	registry.NewGaugeFunc("requests_total", "Requests.", func() float64 { return 0 })
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A value that only goes up, with a series for every combination of label values
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+func (registry *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{desc: desc{metricName: name, help: help, labels: labels}, series: make(map[string]float64)}
+	registry.register(counter)
+	return counter
+}
+
+func (counter *CounterVec) Inc(values ...string) {
+	counter.Add(1, values...)
+}
+
+// Negative values are ignored, a counter never goes down
+func (counter *CounterVec) Add(value float64, values ...string) {
+	if value < 0 {
+		return
+	}
+	key := counter.key(values)
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	counter.series[key] += value
+}
+
+// Value of a series, 0 when it wasn't counted yet
+func (counter *CounterVec) Value(values ...string) float64 {
+	key := counter.key(values)
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return counter.series[key]
+}
+
+func (counter *CounterVec) write(w *bufio.Writer) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	counter.writeHeader(w, "counter")
+	// A counter without labels is always written, even before it's counted
+	if len(counter.labels) == 0 && len(counter.series) == 0 {
+		fmt.Fprintf(w, "%s 0\n", counter.metricName)
+	}
+	for _, key := range sortedKeys(counter.series) {
+		fmt.Fprintf(w, "%s%s %s\n", counter.metricName, counter.formatLabels(labelValues(key, len(counter.labels))), formatFloat(counter.series[key]))
+	}
+}
+
+// Counts the observations in buckets by their upper bound, plus their sum and count
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	// Observations of each bucket alone, they're accumulated when written
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// The buckets are sorted, the +Inf bucket is always added
+func (registry *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	histogramVec := &HistogramVec{desc: desc{metricName: name, help: help, labels: labels}, buckets: sorted, series: make(map[string]*histogram)}
+	registry.register(histogramVec)
+	return histogramVec
+}
+
+func (histogramVec *HistogramVec) Observe(value float64, values ...string) {
+	key := histogramVec.key(values)
+	histogramVec.mu.Lock()
+	defer histogramVec.mu.Unlock()
+	series, ok := histogramVec.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(histogramVec.buckets))}
+		histogramVec.series[key] = series
+	}
+	// Values above the last bucket only count for +Inf
+	if i := sort.SearchFloat64s(histogramVec.buckets, value); i < len(histogramVec.buckets) {
+		series.counts[i]++
+	}
+	series.sum += value
+	series.count++
+}
+
+func (histogramVec *HistogramVec) write(w *bufio.Writer) {
+	histogramVec.mu.Lock()
+	defer histogramVec.mu.Unlock()
+	histogramVec.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(histogramVec.series) {
+		series, values := histogramVec.series[key], labelValues(key, len(histogramVec.labels))
+		var cumulative uint64
+		for i, bound := range histogramVec.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", histogramVec.metricName, histogramVec.formatLabels(values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", histogramVec.metricName, histogramVec.formatLabels(values, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", histogramVec.metricName, histogramVec.formatLabels(values), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", histogramVec.metricName, histogramVec.formatLabels(values), series.count)
+	}
+}
+
+// A value read when the metrics are scraped, like the connections of a pool
+type valueFunc struct {
+	desc
+	kind  string
+	value func() float64
+}
+
+func (registry *Registry) NewGaugeFunc(name string, help string, value func() float64) {
+	registry.register(&valueFunc{desc: desc{metricName: name, help: help}, kind: "gauge", value: value})
+}
+
+// The value must only go up, like the counters kept by sql.DB
+func (registry *Registry) NewCounterFunc(name string, help string, value func() float64) {
+	registry.register(&valueFunc{desc: desc{metricName: name, help: help}, kind: "counter", value: value})
+}
+
+func (metric *valueFunc) write(w *bufio.Writer) {
+	metric.writeHeader(w, metric.kind)
+	fmt.Fprintf(w, "%s %s\n", metric.metricName, formatFloat(metric.value()))
+}
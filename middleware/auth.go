@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/EduardoZepeda/go-coffee-api/types"
 	"github.com/EduardoZepeda/go-coffee-api/utils"
 )
@@ -49,12 +50,13 @@ func AuthenticatedOrReadOnly(app *application.App) func(h http.Handler) http.Han
 				next.ServeHTTP(w, r)
 				return
 			}
-			userId, err := utils.GetDataFromToken(r, "userId")
+			userId, err := utils.GetDataFromToken(r, app.Config.JWTSecret.Value(), "userId")
 			if err != nil {
-				app.Logger.Println(err.Error())
+				logging.FromContext(r.Context()).Warn("invalid token", "error", err)
 				app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
 				return
 			}
+			logging.AddFields(r.Context(), "user_id", userId)
 			ctx := context.WithValue(r.Context(), "userId", userId)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -67,9 +69,9 @@ func IsStaffOrReadOnly(app *application.App) func(h http.Handler) http.Handler {
 				next.ServeHTTP(w, r)
 				return
 			}
-			isStaff, err := utils.GetDataFromToken(r, "isStaff")
+			isStaff, err := utils.GetDataFromToken(r, app.Config.JWTSecret.Value(), "isStaff")
 			if err != nil {
-				app.Logger.Println(err)
+				logging.FromContext(r.Context()).Warn("invalid token", "error", err)
 				app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusUnauthorized)
 				return
 			}
@@ -84,12 +86,13 @@ func IsStaffOrReadOnly(app *application.App) func(h http.Handler) http.Handler {
 func AuthenticatedOnly(app *application.App) func(h http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userId, err := utils.GetDataFromToken(r, "userId")
+			userId, err := utils.GetDataFromToken(r, app.Config.JWTSecret.Value(), "userId")
 			if err != nil {
-				app.Logger.Println(err)
+				logging.FromContext(r.Context()).Warn("invalid token", "error", err)
 				app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusBadRequest)
 				return
 			}
+			logging.AddFields(r.Context(), "user_id", userId)
 			ctx := context.WithValue(r.Context(), "userId", userId)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
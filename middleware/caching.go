@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+)
+
+// Cache-Control policies of the read endpoints
+const (
+	// Catalog data is the same for everyone, so shared caches can keep it for a minute
+	PUBLIC_CACHE = "public, max-age=60"
+	// Data of the authenticated user, only the client can keep it and it must revalidate it every time
+	PRIVATE_CACHE = "private, no-cache"
+)
+
+// Keeps the response in memory so its ETag can be calculated before anything is sent
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(statusCode int) {
+	bw.statusCode = statusCode
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if bw.statusCode == 0 {
+		bw.statusCode = http.StatusOK
+	}
+	return bw.body.Write(b)
+}
+
+// Tag successful GET responses with an ETag and the given Cache-Control policy, and answer with a 304 Not Modified
+// when the client already has the same representation.
+// The ETag is a hash of the body. When the handler already set a version ETag, the hash is appended to the version,
+// so If-Match keeps working and the fields calculated on each request, like is_open, still change the ETag.
+func ConditionalGet(app *application.App, cacheControl string) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			bw := &bufferedResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(bw, r)
+			if bw.statusCode == 0 {
+				bw.statusCode = http.StatusOK
+			}
+			header := w.Header()
+			if bw.statusCode == http.StatusOK {
+				header.Set("Cache-Control", cacheControl)
+				if strings.HasPrefix(cacheControl, "private") {
+					header.Add("Vary", "Authorization")
+				}
+				sum := sha256.Sum256(bw.body.Bytes())
+				hash := hex.EncodeToString(sum[:8])
+				etag := `"` + hash + `"`
+				if version := header.Get("ETag"); version != "" {
+					etag = strings.TrimSuffix(version, `"`) + "-" + hash + `"`
+				}
+				header.Set("ETag", etag)
+				if notModified(r, etag, header.Get("Last-Modified")) {
+					// A 304 has no body, so the headers describing it are dropped
+					header.Del("Content-Type")
+					header.Del("Content-Length")
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+			}
+			w.WriteHeader(bw.statusCode)
+			if _, err := w.Write(bw.body.Bytes()); err != nil {
+				logging.FromContext(r.Context()).Error("writing the cached response failed", "error", err)
+			}
+		})
+	}
+}
+
+// Evaluate If-None-Match and If-Modified-Since as described in RFC 7232. If-Modified-Since is ignored when
+// If-None-Match is present, because the ETag is the more precise validator
+func notModified(r *http.Request, etag string, lastModified string) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// Weak comparison, the W/ prefix is irrelevant for GET requests
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
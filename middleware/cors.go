@@ -4,12 +4,15 @@ import (
 	"net/http"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/tracing"
 )
 
 func CorsAllowAll(app *application.App) func(http http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
+			// Browsers only let the scripts read the headers listed here
+			w.Header().Set("Access-Control-Expose-Headers", application.REQUEST_ID_HEADER+", "+tracing.TRACEPARENT_HEADER)
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/tracing"
+)
+
+// Remembers the status written by the handlers, the writers of websockets and streamed responses still work through it
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.statusCode == 0 {
+		sr.statusCode = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.statusCode == 0 {
+		sr.statusCode = http.StatusOK
+	}
+	written, err := sr.ResponseWriter.Write(b)
+	sr.bytes += written
+	return written, err
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer can't be hijacked")
+	}
+	// The connection is switched to another protocol, like websockets
+	sr.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Put a logger with the request id, method and route in the context of the request, and write an access log line
+// once the request is answered. Failed requests are logged as errors
+func LogRequests(app *application.App) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			logger := app.Logger.With("request_id", GetRequestId(r.Context()), "method", r.Method, "route", routeTemplate(r))
+			if span := tracing.SpanFromContext(r.Context()); span != nil {
+				logger = logger.With("trace_id", span.SpanContext().TraceId.String())
+			}
+			ctx := logging.NewContext(r.Context(), logger)
+			sr := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(sr, r.WithContext(ctx))
+			if sr.statusCode == 0 {
+				sr.statusCode = http.StatusOK
+			}
+			level := logging.LEVEL_INFO
+			if sr.statusCode >= http.StatusInternalServerError {
+				level = logging.LEVEL_ERROR
+			}
+			// The logger of the context has the fields added by the handlers, like the user id
+			logging.FromContext(ctx).Log(level, "request completed",
+				"path", r.URL.Path,
+				"status", sr.statusCode,
+				"latency_ms", float64(time.Since(start).Microseconds())/1000,
+				"bytes", sr.bytes,
+				"remote_address", r.RemoteAddr,
+				"user_agent", r.UserAgent(),
+			)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/utils"
+	"github.com/gorilla/mux"
+)
+
+// Count the requests and their latency by route. Routes are the templates, like /api/v1/coffee-shops/{id:[0-9]+},
+// so a series isn't created for every id
+func CollectMetrics(app *application.App) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			route := routeTemplate(r)
+			sr := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(sr, r)
+			if sr.statusCode == 0 {
+				sr.statusCode = http.StatusOK
+			}
+			app.Metrics.Requests.Inc(r.Method, route, strconv.Itoa(sr.statusCode))
+			app.Metrics.RequestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+		})
+	}
+}
+
+// Route of the requests that didn't match one with a template. The path isn't used, every scanner probing random
+// paths would create new series
+const UNMATCHED_ROUTE = "unmatched"
+
+// Template of the matched route, or UNMATCHED_ROUTE
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return UNMATCHED_ROUTE
+}
+
+// Only staff users, or the scrapers that send METRICS_TOKEN as their bearer token, can read the metrics
+func StaffOrMetricsToken(app *application.App) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := app.Config.MetricsToken.Value(); token != "" {
+				if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1 {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			isStaff, err := utils.GetDataFromToken(r, app.Config.JWTSecret.Value(), "isStaff")
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("invalid token", "error", err)
+				app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusUnauthorized)
+				return
+			}
+			if isStaff, ok := isStaff.(bool); !ok || !isStaff {
+				app.Respond(w, types.ApiError{Message: "You don't have permission to access this view"}, http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,7 +3,6 @@ package middleware
 import (
 	"net"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
@@ -39,33 +38,27 @@ func RateLimit(app *application.App) func(h http.Handler) http.Handler {
 	}()
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			var ip string
-			var err error
-			if os.Getenv("MODE") == "dev" {
-				// The following code works allow to handle ip addresses that include the port, ideal for localhost
-				ip, _, err = net.SplitHostPort(r.RemoteAddr)
-				if err != nil {
-					app.Logger.Println(err)
-					app.Respond(w, types.ApiError{Message: err.Error()}, http.StatusInternalServerError)
-				}
-			} else {
-				// ParseIP doesn't allow the port to be included in the url, therefore, if we're in production we use ParseIP instead
-				parsedIp := net.ParseIP(r.RemoteAddr)
-				if parsedIp == nil {
-					app.Respond(w, types.ApiError{Message: "Couldn't parse your ip address"}, http.StatusInternalServerError)
-					return
-				}
-				ip = parsedIp.String()
+			// Vercel sends only the ip of the client, a standalone server sends the ip and the port
+			host := r.RemoteAddr
+			if splitHost, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				host = splitHost
+			}
+			parsedIp := net.ParseIP(host)
+			if parsedIp == nil {
+				app.Respond(w, types.ApiError{Message: "Couldn't parse your ip address"}, http.StatusInternalServerError)
+				return
 			}
+			ip := parsedIp.String()
 			mu.Lock()
 			if _, found := clients[ip]; !found {
 				// If the ip doesn't exist, add it to the black list
-				clients[ip] = &client{limiter: rate.NewLimiter(2, 4)}
+				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(app.Config.RateLimit.Requests), app.Config.RateLimit.Burst)}
 			}
 			// Update the last request for the client.
 			clients[ip].lastRequest = time.Now()
 			if !clients[ip].limiter.Allow() {
 				mu.Unlock()
+				app.Metrics.RateLimited.Inc()
 				app.Respond(w, types.ApiError{Message: "You're making too much requests. Please wait some time before trying again."}, http.StatusTooManyRequests)
 				return
 			}
@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"net/http"
+	"runtime/debug"
 
 	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/EduardoZepeda/go-coffee-api/types"
 )
 
@@ -17,7 +19,7 @@ func RecoverFromPanic(app *application.App) func(h http.Handler) http.Handler {
 					// close the current connection
 					w.Header().Set("Connection", "close")
 					// Send an error response to the user
-					app.Logger.Println(err)
+					logging.FromContext(r.Context()).Error("recovered from a panic", "panic", err, "stack", string(debug.Stack()))
 					app.Respond(w, types.ApiError{Message: "Closed connection"}, http.StatusInternalServerError)
 				}
 			}()
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+)
+
+// Ids sent by clients and proxies are kept when they're short and can't break the logs, otherwise a new one is used
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIdKey struct{}
+
+// Id of the request, empty outside of one
+func GetRequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+func newRequestId() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Accept the X-Request-ID of the request or generate one, put it in the context and send it back in the response
+// header. app.Respond also adds it to the errors, so a user can report it
+func RequestId(app *application.App) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestId := r.Header.Get(application.REQUEST_ID_HEADER)
+			if !validRequestId.MatchString(requestId) {
+				requestId = newRequestId()
+			}
+			w.Header().Set(application.REQUEST_ID_HEADER, requestId)
+			ctx := context.WithValue(r.Context(), requestIdKey{}, requestId)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
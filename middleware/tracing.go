@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/tracing"
+)
+
+// Start the span of the request, continuing the trace of the traceparent header when there's one. The spans of the
+// middlewares, the handler and the queries are its children. The response has the traceparent of the span, so clients
+// can find the trace of a request
+func Trace(app *application.App) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if remote, ok := tracing.Extract(r.Header); ok {
+				ctx = tracing.ContextWithRemoteSpanContext(ctx, remote)
+			}
+			route := routeTemplate(r)
+			ctx, span := tracing.Start(ctx, r.Method+" "+route, "kind", "server", "http.method", r.Method, "http.route", route, "http.target", r.URL.Path)
+			defer span.End()
+			tracing.Inject(ctx, w.Header())
+			sr := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(sr, r.WithContext(ctx))
+			if sr.statusCode == 0 {
+				sr.statusCode = http.StatusOK
+			}
+			span.SetAttributes("http.status_code", sr.statusCode, "request_id", w.Header().Get(application.REQUEST_ID_HEADER))
+			if sr.statusCode >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("%d %s", sr.statusCode, http.StatusText(sr.statusCode)))
+			}
+		})
+	}
+}
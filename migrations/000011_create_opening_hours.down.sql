@@ -0,0 +1,5 @@
+BEGIN;
+DROP FUNCTION IF EXISTS shop_is_open(bigint, timestamp with time zone);
+DROP TABLE IF EXISTS "shops_specialhours" CASCADE;
+DROP TABLE IF EXISTS "shops_openinghours" CASCADE;
+COMMIT;
@@ -0,0 +1,39 @@
+BEGIN;
+--
+-- Create model OpeningHours
+--
+CREATE TABLE "shops_openinghours" ("id" bigserial NOT NULL PRIMARY KEY, "weekday" smallint NOT NULL CHECK ("weekday" >= 0 AND "weekday" <= 6), "opens" time NOT NULL, "closes" time NOT NULL, "shop_id" bigint NOT NULL);
+ALTER TABLE "shops_openinghours" ADD CONSTRAINT "shops_openinghours_shop_id_fk_shops_shop_id" FOREIGN KEY ("shop_id") REFERENCES "shops_shop" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX "shops_openinghours_shop_id_weekday" ON "shops_openinghours" ("shop_id", "weekday");
+--
+-- Create model SpecialHours, used for holidays and special closures. They replace the weekly hours of that date
+--
+CREATE TABLE "shops_specialhours" ("id" bigserial NOT NULL PRIMARY KEY, "date" date NOT NULL, "closed" boolean NOT NULL, "opens" time NULL, "closes" time NULL, "description" varchar(100) NOT NULL DEFAULT '', "shop_id" bigint NOT NULL);
+ALTER TABLE "shops_specialhours" ADD CONSTRAINT "shops_specialhours_shop_id_fk_shops_shop_id" FOREIGN KEY ("shop_id") REFERENCES "shops_shop" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX "shops_specialhours_shop_id_date" ON "shops_specialhours" ("shop_id", "date");
+--
+-- Check if a shop is open at a given moment. Hours are stored in America/Mexico_City local time,
+-- intervals whose closing time is lower or equal than its opening time end the following day.
+--
+CREATE OR REPLACE FUNCTION shop_is_open(target_shop_id bigint, target_time timestamp with time zone) RETURNS boolean AS $$
+DECLARE
+    local_time timestamp := target_time AT TIME ZONE 'America/Mexico_City';
+    day date;
+BEGIN
+    FOREACH day IN ARRAY ARRAY[local_time::date - 1, local_time::date] LOOP
+        IF EXISTS (SELECT 1 FROM shops_specialhours WHERE shop_id = target_shop_id AND date = day) THEN
+            IF EXISTS (SELECT 1 FROM shops_specialhours WHERE shop_id = target_shop_id AND date = day AND NOT closed
+                AND local_time >= day + opens
+                AND local_time < day + closes + CASE WHEN closes <= opens THEN interval '1 day' ELSE interval '0' END) THEN
+                RETURN true;
+            END IF;
+        ELSIF EXISTS (SELECT 1 FROM shops_openinghours WHERE shop_id = target_shop_id AND weekday = EXTRACT(DOW FROM day)
+            AND local_time >= day + opens
+            AND local_time < day + closes + CASE WHEN closes <= opens THEN interval '1 day' ELSE interval '0' END) THEN
+            RETURN true;
+        END IF;
+    END LOOP;
+    RETURN false;
+END;
+$$ LANGUAGE plpgsql STABLE;
+COMMIT;
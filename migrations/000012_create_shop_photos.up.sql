@@ -0,0 +1,8 @@
+BEGIN;
+--
+-- Create model ShopPhoto
+--
+CREATE TABLE "shops_shopphoto" ("id" bigserial NOT NULL PRIMARY KEY, "image" varchar(100) NOT NULL, "created_date" timestamp with time zone NOT NULL, "shop_id" bigint NOT NULL);
+ALTER TABLE "shops_shopphoto" ADD CONSTRAINT "shops_shopphoto_shop_id_fk_shops_shop_id" FOREIGN KEY ("shop_id") REFERENCES "shops_shop" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+CREATE INDEX "shops_shopphoto_shop_id" ON "shops_shopphoto" ("shop_id");
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "price";
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "weight";
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "tasting_notes";
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "variety";
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "altitude";
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "process";
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "roast";
+COMMIT;
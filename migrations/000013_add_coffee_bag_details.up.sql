@@ -0,0 +1,13 @@
+BEGIN;
+--
+-- Add roast, process, altitude, variety, tasting notes, weight and price to coffee bags.
+-- Every new column is nullable or has a default value, so the existing coffee bags remain valid
+--
+ALTER TABLE "shops_coffeebag" ADD COLUMN "roast" varchar(2) NULL;
+ALTER TABLE "shops_coffeebag" ADD COLUMN "process" varchar(2) NULL;
+ALTER TABLE "shops_coffeebag" ADD COLUMN "altitude" integer NULL CHECK ("altitude" >= 0);
+ALTER TABLE "shops_coffeebag" ADD COLUMN "variety" varchar(100) NOT NULL DEFAULT '';
+ALTER TABLE "shops_coffeebag" ADD COLUMN "tasting_notes" varchar(50)[] NOT NULL DEFAULT '{}';
+ALTER TABLE "shops_coffeebag" ADD COLUMN "weight" integer NULL CHECK ("weight" > 0);
+ALTER TABLE "shops_coffeebag" ADD COLUMN "price" numeric(8, 2) NULL CHECK ("price" >= 0);
+COMMIT;
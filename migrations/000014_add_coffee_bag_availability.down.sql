@@ -0,0 +1,7 @@
+BEGIN;
+ALTER TABLE "shops_coffeebag_coffee_shop" DROP COLUMN IF EXISTS "updated_at";
+ALTER TABLE "shops_coffeebag_coffee_shop" DROP COLUMN IF EXISTS "roast_date";
+ALTER TABLE "shops_coffeebag_coffee_shop" DROP COLUMN IF EXISTS "stock_status";
+ALTER TABLE "shops_coffeebag_coffee_shop" DROP COLUMN IF EXISTS "size";
+ALTER TABLE "shops_coffeebag_coffee_shop" DROP COLUMN IF EXISTS "price";
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+--
+-- Add price, size, stock status, roast date and last update to the coffee bags sold by each coffee shop.
+-- Every new column is nullable or has a default value, so the existing relationships remain valid
+--
+ALTER TABLE "shops_coffeebag_coffee_shop" ADD COLUMN "price" numeric(8, 2) NULL CHECK ("price" >= 0);
+ALTER TABLE "shops_coffeebag_coffee_shop" ADD COLUMN "size" integer NULL CHECK ("size" > 0);
+ALTER TABLE "shops_coffeebag_coffee_shop" ADD COLUMN "stock_status" varchar(2) NOT NULL DEFAULT 'IS';
+ALTER TABLE "shops_coffeebag_coffee_shop" ADD COLUMN "roast_date" date NULL;
+ALTER TABLE "shops_coffeebag_coffee_shop" ADD COLUMN "updated_at" timestamp with time zone NOT NULL DEFAULT current_timestamp;
+COMMIT;
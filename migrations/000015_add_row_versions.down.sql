@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE "accounts_user" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "shops_coffeebag" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "shops_shop" DROP COLUMN IF EXISTS "version";
+COMMIT;
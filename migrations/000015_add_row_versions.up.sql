@@ -0,0 +1,9 @@
+BEGIN;
+--
+-- Add a version to coffee shops, coffee bags and users. It's increased on every update and exposed as the ETag
+-- of the resource, writes are only applied when the version sent in If-Match is still the current one
+--
+ALTER TABLE "shops_shop" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+ALTER TABLE "shops_coffeebag" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+ALTER TABLE "accounts_user" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+COMMIT;
@@ -0,0 +1,28 @@
+BEGIN;
+--
+-- Deleting a coffee shop, a coffee bag or an user also deletes the rows that reference it: likes, products,
+-- follows, reviews and feed actions. Before this, the foreign keys created by Django rejected those deletes
+--
+ALTER TABLE "shops_shop_likes" DROP CONSTRAINT "shops_shop_likes_shop_id_c364c364_fk_shops_shop_id";
+ALTER TABLE "shops_shop_likes" ADD CONSTRAINT "shops_shop_likes_shop_id_c364c364_fk_shops_shop_id" FOREIGN KEY ("shop_id") REFERENCES "shops_shop" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "shops_shop_likes" DROP CONSTRAINT "shops_shop_likes_user_id_6f0a5822_fk_accounts_user_id";
+ALTER TABLE "shops_shop_likes" ADD CONSTRAINT "shops_shop_likes_user_id_6f0a5822_fk_accounts_user_id" FOREIGN KEY ("user_id") REFERENCES "accounts_user" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "shops_coffeebag_coffee_shop" DROP CONSTRAINT "shops_coffeebag_coff_coffeebag_id_f7e31f2a_fk_shops_cof";
+ALTER TABLE "shops_coffeebag_coffee_shop" ADD CONSTRAINT "shops_coffeebag_coff_coffeebag_id_f7e31f2a_fk_shops_cof" FOREIGN KEY ("coffeebag_id") REFERENCES "shops_coffeebag" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "shops_coffeebag_coffee_shop" DROP CONSTRAINT "shops_coffeebag_coffee_shop_shop_id_3f6bc214_fk_shops_shop_id";
+ALTER TABLE "shops_coffeebag_coffee_shop" ADD CONSTRAINT "shops_coffeebag_coffee_shop_shop_id_3f6bc214_fk_shops_shop_id" FOREIGN KEY ("shop_id") REFERENCES "shops_shop" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "accounts_contact" DROP CONSTRAINT "accounts_contact_user_from_id_d88fc381_fk_accounts_user_id";
+ALTER TABLE "accounts_contact" ADD CONSTRAINT "accounts_contact_user_from_id_d88fc381_fk_accounts_user_id" FOREIGN KEY ("user_from_id") REFERENCES "accounts_user" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "accounts_contact" DROP CONSTRAINT "accounts_contact_user_to_id_16d11cce_fk_accounts_user_id";
+ALTER TABLE "accounts_contact" ADD CONSTRAINT "accounts_contact_user_to_id_16d11cce_fk_accounts_user_id" FOREIGN KEY ("user_to_id") REFERENCES "accounts_user" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "feeds_action" DROP CONSTRAINT "feeds_action_user_id_05157ef6_fk_accounts_user_id";
+ALTER TABLE "feeds_action" ADD CONSTRAINT "feeds_action_user_id_05157ef6_fk_accounts_user_id" FOREIGN KEY ("user_id") REFERENCES "accounts_user" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "reviews_review" DROP CONSTRAINT "reviews_review_shop_id_35a6a830_fk_shops_shop_id";
+ALTER TABLE "reviews_review" ADD CONSTRAINT "reviews_review_shop_id_35a6a830_fk_shops_shop_id" FOREIGN KEY ("shop_id") REFERENCES "shops_shop" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "reviews_review" DROP CONSTRAINT "reviews_review_user_id_875caff2_fk_accounts_user_id";
+ALTER TABLE "reviews_review" ADD CONSTRAINT "reviews_review_user_id_875caff2_fk_accounts_user_id" FOREIGN KEY ("user_id") REFERENCES "accounts_user" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "accounts_user_groups" DROP CONSTRAINT "accounts_user_groups_user_id_52b62117_fk_accounts_user_id";
+ALTER TABLE "accounts_user_groups" ADD CONSTRAINT "accounts_user_groups_user_id_52b62117_fk_accounts_user_id" FOREIGN KEY ("user_id") REFERENCES "accounts_user" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE "accounts_user_user_permissions" DROP CONSTRAINT "accounts_user_user_p_user_id_e4f0a161_fk_accounts_";
+ALTER TABLE "accounts_user_user_permissions" ADD CONSTRAINT "accounts_user_user_p_user_id_e4f0a161_fk_accounts_" FOREIGN KEY ("user_id") REFERENCES "accounts_user" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+COMMIT;
@@ -0,0 +1,89 @@
+// Package migrations embeds the sql migrations of the database, so the binary can run them without the source tree.
+// Files follow the golang-migrate naming: <version>_<name>.up.sql and <version>_<name>.down.sql
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Read the migrations of fsys sorted by version, both the up and down files are required
+func Load(fsys fs.FS) ([]*Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint]*Migration)
+	for _, file := range files {
+		base, direction, ok := cutDirection(file)
+		if !ok {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", file)
+		}
+		versionText, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(versionText, 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number", file)
+		}
+		statements, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: name}
+			byVersion[uint(version)] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(statements)
+		} else {
+			migration.Down = string(statements)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func cutDirection(file string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		suffix := "." + direction + ".sql"
+		if strings.HasSuffix(file, suffix) {
+			return strings.TrimSuffix(file, suffix), direction, true
+		}
+	}
+	return "", "", false
+}
+
+// Version of the last embedded migration, the schema the code expects
+func Latest() (uint, error) {
+	migrations, err := Load(FS)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_add_index.up.sql":      file("CREATE INDEX;"),
+		"000010_add_index.down.sql":    file("DROP INDEX;"),
+		"000002_create_table.up.sql":   file("CREATE TABLE;"),
+		"000002_create_table.down.sql": file("DROP TABLE;"),
+		"README.md":                    file("only the sql files are migrations"),
+	}
+	loaded, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sorted by version, and gaps between versions are allowed like in golang-migrate
+	expected := []Migration{
+		{Version: 2, Name: "create_table", Up: "CREATE TABLE;", Down: "DROP TABLE;"},
+		{Version: 10, Name: "add_index", Up: "CREATE INDEX;", Down: "DROP INDEX;"},
+	}
+	if len(loaded) != len(expected) {
+		t.Fatalf("expected %d migrations, got %d", len(expected), len(loaded))
+	}
+	for i, migration := range loaded {
+		if *migration != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], *migration)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		fsys  fstest.MapFS
+		error string
+	}{
+		{"without direction", fstest.MapFS{"000001_create.sql": file("")}, "must end in .up.sql or .down.sql"},
+		{"version zero", fstest.MapFS{"000000_create.up.sql": file(""), "000000_create.down.sql": file("")}, "positive version number"},
+		{"without version", fstest.MapFS{"create.up.sql": file(""), "create.down.sql": file("")}, "positive version number"},
+		{"duplicated version", fstest.MapFS{"000001_create.up.sql": file("CREATE"), "000001_other.down.sql": file("DROP")}, "have the same version"},
+		{"without down", fstest.MapFS{"000001_create.up.sql": file("CREATE")}, "needs both an up and a down file"},
+		{"without up", fstest.MapFS{"000001_create.down.sql": file("DROP")}, "needs both an up and a down file"},
+	}
+	for _, test := range tests {
+		_, err := Load(test.fsys)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.error, err)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := Load(FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The embedded migrations are numbered one after the other, a gap is likely a missing file
+	for i, migration := range loaded {
+		if migration.Version != uint(i+1) {
+			t.Fatalf("expected migration %d, got %d_%s", i+1, migration.Version, migration.Name)
+		}
+	}
+	latest, err := Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != uint(len(loaded)) {
+		t.Errorf("expected the latest version to be %d, got %d", len(loaded), latest)
+	}
+}
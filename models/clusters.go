@@ -0,0 +1,21 @@
+package models
+
+import "github.com/EduardoZepeda/go-coffee-api/types"
+
+type BoundingBox struct {
+	MinLongitude float64 `db:"min_longitude" json:"minLongitude"`
+	MinLatitude  float64 `db:"min_latitude" json:"minLatitude"`
+	MaxLongitude float64 `db:"max_longitude" json:"maxLongitude"`
+	MaxLatitude  float64 `db:"max_latitude" json:"maxLatitude"`
+}
+
+type CoffeeShopClustersRequest struct {
+	BoundingBox
+	Zoom uint64
+}
+
+type CoffeeShopCluster struct {
+	Centroid    types.Point `db:"centroid" json:"centroid"`
+	Count       uint64      `db:"count" json:"count"`
+	BoundingBox `json:"boundingBox"`
+}
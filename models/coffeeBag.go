@@ -1,13 +1,57 @@
 package models
 
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
 type CoffeeBag struct {
-	ID      string `json:"id,omitempty" swaggerignore:"true"`
-	Brand   string `json:"brand,omitempty"`
-	Origin  string `json:"origin,omitempty"`
-	Species string `json:"species,omitempty"`
+	ID      string `db:"id" json:"id,omitempty" swaggerignore:"true"`
+	Brand   string `db:"brand" json:"brand,omitempty"`
+	Origin  string `db:"origin" json:"origin,omitempty"`
+	Species string `db:"species" json:"species,omitempty"`
+	Roast   string `db:"roast" json:"roast,omitempty"`
+	Process string `db:"process" json:"process,omitempty"`
+	// Meters above sea level
+	Altitude     *int           `db:"altitude" json:"altitude,omitempty"`
+	Variety      string         `db:"variety" json:"variety,omitempty"`
+	TastingNotes pq.StringArray `db:"tasting_notes" json:"tastingNotes,omitempty" swaggertype:"array,string"`
+	// Grams
+	Weight *int `db:"weight" json:"weight,omitempty"`
+	// Mexican pesos
+	Price *float64 `db:"price" json:"price,omitempty"`
+	// Increased on every update, it's sent as the ETag header instead of the body
+	Version uint64 `db:"version" json:"-"`
+	// Only present when the coffee bags are listed by coffee shop
+	Availability *CoffeeBagAvailability `db:"availability" json:"availability,omitempty" swaggerignore:"true"`
+}
+
+// Price, size and stock of a coffee bag at a given coffee shop
+type CoffeeBagAvailability struct {
+	CoffeeBagId  string `db:"coffeebag_id" json:"-"`
+	CoffeeShopId string `db:"shop_id" json:"-"`
+	// Mexican pesos
+	Price *float64 `db:"price" json:"price,omitempty"`
+	// Grams
+	Size        *int   `db:"size" json:"size,omitempty"`
+	StockStatus string `db:"stock_status" json:"stockStatus,omitempty"`
+	// YYYY-MM-DD
+	RoastDate string    `db:"roast_date" json:"roastDate,omitempty"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt,omitempty" swaggerignore:"true"`
 }
 
 type CoffeeBagsList struct {
+	Species string
+	Origin  string
+	Roast   string
+	Process string
+	// Brand prefix and free text search on the brand
+	Brand  string
+	Search string
+	// Only coffee bags sold by a coffee shop in this city
+	City string
+	Sort string
 	Pagination
 }
 
@@ -15,3 +59,10 @@ type CoffeeBagByShopId struct {
 	CoffeeShopId string
 	Pagination
 }
+
+type CoffeeShopsByCoffeeBagId struct {
+	CoffeeBagId string
+	// Optional, when present the coffee shops are sorted by distance
+	Coordinates *UserCoordinates
+	Pagination
+}
@@ -4,4 +4,22 @@ type HealtcheckResponse struct {
 	Version     string
 	Status      string
 	Environment string
+	// Only present when the repository is cached
+	Cache *CacheStats `json:"Cache,omitempty"`
+	// Migration the database is at, omitted when it can't be read
+	Schema *SchemaVersion `json:"Schema,omitempty"`
+}
+
+// Dirty is set when the last migration failed halfway
+type SchemaVersion struct {
+	Version uint
+	Dirty   bool
+}
+
+// Hits, misses and evictions since the cache was created
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
 }
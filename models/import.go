@@ -0,0 +1,26 @@
+package models
+
+// What the import did with each row
+const (
+	IMPORT_CREATED = "created"
+	IMPORT_UPDATED = "updated"
+)
+
+type ImportReport struct {
+	// Nothing was written, the counts are what the import would have done
+	DryRun  bool `json:"dryRun"`
+	Rows    int  `json:"rows"`
+	Created int  `json:"created"`
+	Updated int  `json:"updated"`
+	Failed  int  `json:"failed"`
+	// The file couldn't be read until the end, the rows after the last saved batch weren't imported
+	Aborted bool             `json:"aborted,omitempty"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+type ImportRowError struct {
+	// Line of the csv file, counting the header, or position of the feature or item starting at 1. It's 0 when
+	// the rest of the file couldn't be read
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
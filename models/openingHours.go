@@ -0,0 +1,21 @@
+package models
+
+type OpeningInterval struct {
+	Weekday int    `db:"weekday" json:"weekday"`
+	Opens   string `db:"opens" json:"opens"`
+	Closes  string `db:"closes" json:"closes"`
+}
+
+type SpecialHours struct {
+	Date        string `db:"date" json:"date"`
+	Closed      bool   `db:"closed" json:"closed"`
+	Opens       string `db:"opens" json:"opens,omitempty"`
+	Closes      string `db:"closes" json:"closes,omitempty"`
+	Description string `db:"description" json:"description,omitempty"`
+}
+
+type OpeningHours struct {
+	CoffeeShopId string            `json:"-"`
+	Weekly       []OpeningInterval `json:"weekly"`
+	Special      []SpecialHours    `json:"special"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type ShopPhoto struct {
+	ID           string    `db:"id" json:"id"`
+	CoffeeShopId string    `db:"shop_id" json:"-"`
+	Image        string    `db:"image" json:"-"`
+	URL          string    `db:"-" json:"url"`
+	CreatedDate  time.Time `db:"created_date" json:"created_date"`
+}
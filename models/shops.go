@@ -16,4 +16,14 @@ type CoffeeShop struct {
 	Rating       float32     `db:"rating" json:"rating,omitempty"`
 	CreatedDate  time.Time   `db:"created_date" json:"created_date,omitempty" swaggerignore:"true"`
 	ModifiedDate time.Time   `db:"modified_date" json:"modified_date,omitempty" swaggerignore:"true"`
+	// Increased on every update, it's sent as the ETag header instead of the body
+	Version uint64 `db:"version" json:"-"`
+	// Meters from the user, only present when the user coordinates are known
+	Distance *float64 `db:"distance" json:"distance,omitempty" swaggerignore:"true"`
+	// Calculated from the opening hours of the shop, they're not columns of shops_shop
+	IsOpen       bool          `db:"-" json:"is_open" swaggerignore:"true"`
+	NextOpen     *time.Time    `db:"-" json:"next_open,omitempty" swaggerignore:"true"`
+	NextClose    *time.Time    `db:"-" json:"next_close,omitempty" swaggerignore:"true"`
+	OpeningHours *OpeningHours `db:"-" json:"opening_hours,omitempty" swaggerignore:"true"`
+	Photos       []*ShopPhoto  `db:"-" json:"photos,omitempty" swaggerignore:"true"`
 }
@@ -0,0 +1,14 @@
+package models
+
+// Totals of the catalog and its users, printed by coffeectl stats
+type CatalogStats struct {
+	CoffeeShops  int `db:"coffee_shops" json:"coffeeShops"`
+	Cities       int `db:"cities" json:"cities"`
+	Roasters     int `db:"roasters" json:"roasters"`
+	CoffeeBags   int `db:"coffee_bags" json:"coffeeBags"`
+	Availability int `db:"availability" json:"availability"`
+	Photos       int `db:"photos" json:"photos"`
+	Users        int `db:"users" json:"users"`
+	StaffUsers   int `db:"staff_users" json:"staffUsers"`
+	Likes        int `db:"likes" json:"likes"`
+}
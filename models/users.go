@@ -18,6 +18,8 @@ type UpdateUserRequest struct {
 	LastName  string `db:"LastName" json:"lastName"`
 	Bio       string `db:"Bio" json:"bio"`
 	Username  string `db:"Username" json:"username"`
+	// Expected version of the user, taken from the If-Match header
+	Version uint64 `db:"Version" json:"-"`
 }
 
 type GetUserResponse struct {
@@ -28,6 +30,11 @@ type GetUserResponse struct {
 	LastName  string `db:"last_name" json:"lastName"`
 	IsStaff   string `db:"is_staff" json:"isStaff"`
 	Bio       string `db:"bio" json:"bio"`
+	// Storage key of the picture, only its url is exposed
+	ProfilePicture    string `db:"profile_picture" json:"-"`
+	ProfilePictureURL string `db:"-" json:"profilePicture,omitempty"`
+	// Increased on every update, it's sent as the ETag header instead of the body
+	Version uint64 `db:"version" json:"-"`
 }
 
 type SignUpRequest struct {
@@ -36,6 +43,8 @@ type SignUpRequest struct {
 	PasswordConfirmation string `json:"passwordConfirmation"`
 	HashedPassword       string `json:"hashedPassword" swaggerignore:"true"`
 	Username             string `json:"username"`
+	// Set by coffeectl, users signing up through the API are never staff
+	IsStaff bool `json:"-" swaggerignore:"true"`
 }
 
 type SignUpResponse struct {
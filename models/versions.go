@@ -0,0 +1,7 @@
+package models
+
+import "errors"
+
+// Returned by conditional writes when the version of the row is no longer the expected one. It's defined next to
+// the models so the repository implementations don't depend on the repository package to return it
+var ErrVersionMismatch = errors.New("The resource has been modified since its version was retrieved")
@@ -2,10 +2,14 @@ package parameters
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/schedule"
 )
 
 func GetIntParam(r *http.Request, parameter string, defaultValue uint64) (uint64, error) {
@@ -29,6 +33,30 @@ func GetStringParam(r *http.Request, parameter string, defaultValue string) stri
 	return defaultValue
 }
 
+func GetBoolParam(r *http.Request, parameter string, defaultValue bool) (bool, error) {
+	value := r.URL.Query().Get(parameter)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s must be a boolean. For example: &%s=true", parameter, parameter)
+	}
+	return parsed, nil
+}
+
+func GetFloatParam(r *http.Request, parameter string, defaultValue float64) (float64, error) {
+	value := r.URL.Query().Get(parameter)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s must be a floating number. For example: &%s=50", parameter, parameter)
+	}
+	return parsed, nil
+}
+
 func GetLongitudeAndLatitudeTerms(r *http.Request) (*models.UserCoordinates, error) {
 	if r.URL.Query().Get("longitude") == "" || r.URL.Query().Get("latitude") == "" {
 		return nil, errors.New("Both latitude and longitude must be present as query parameters")
@@ -47,3 +75,55 @@ func GetLongitudeAndLatitudeTerms(r *http.Request) (*models.UserCoordinates, err
 	}
 	return coordinates, nil
 }
+
+func GetBoundingBoxParam(r *http.Request) (*models.BoundingBox, error) {
+	// The bounding box follows the GeoJSON order: minLongitude,minLatitude,maxLongitude,maxLatitude
+	bbox := strings.Split(r.URL.Query().Get("bbox"), ",")
+	if len(bbox) != 4 {
+		return nil, errors.New("bbox must be present as a query parameter in the format: <minLongitude>,<minLatitude>,<maxLongitude>,<maxLatitude>")
+	}
+	var corners [4]float64
+	for i, value := range bbox {
+		corner, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, errors.New("bbox values must be floating numbers. For example: &bbox=-103.5,20.5,-103.2,20.8")
+		}
+		corners[i] = corner
+	}
+	boundingBox := &models.BoundingBox{
+		MinLongitude: corners[0],
+		MinLatitude:  corners[1],
+		MaxLongitude: corners[2],
+		MaxLatitude:  corners[3],
+	}
+	return boundingBox, nil
+}
+
+// Returns the moment used to filter coffee shops by their opening hours, nil if the request doesn't filter by it.
+// open_at takes precedence over open_now, timestamps without an offset are taken as Mexico City's local time
+func GetOpenAtParam(r *http.Request) (*time.Time, error) {
+	openAt := r.URL.Query().Get("open_at")
+	if openAt != "" {
+		t, err := time.Parse(time.RFC3339, openAt)
+		if err != nil {
+			t, err = time.ParseInLocation("2006-01-02T15:04", openAt, schedule.Location)
+		}
+		if err != nil {
+			return nil, errors.New("open_at must be a timestamp. For example: &open_at=2022-10-05T18:30:00-05:00")
+		}
+		return &t, nil
+	}
+	openNow := r.URL.Query().Get("open_now")
+	if openNow == "" {
+		return nil, nil
+	}
+	isOpenNow, err := strconv.ParseBool(openNow)
+	if err != nil {
+		return nil, errors.New("open_now must be a boolean. For example: &open_now=true")
+	}
+	if !isOpenNow {
+		return nil, nil
+	}
+	now := time.Now()
+	return &now, nil
+}
@@ -0,0 +1,39 @@
+package parameters
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+)
+
+func TestGetBoundingBoxParam(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *models.BoundingBox
+	}{
+		{"bbox=-103.5,20.5,-103.2,20.8", &models.BoundingBox{MinLongitude: -103.5, MinLatitude: 20.5, MaxLongitude: -103.2, MaxLatitude: 20.8}},
+		{"bbox=-103.5,%2020.5,%20-103.2,%2020.8", &models.BoundingBox{MinLongitude: -103.5, MinLatitude: 20.5, MaxLongitude: -103.2, MaxLatitude: 20.8}},
+		{"", nil},
+		{"bbox=-103.5,20.5,-103.2", nil},
+		{"bbox=-103.5,20.5,-103.2,20.8,1", nil},
+		{"bbox=-103.5,north,-103.2,20.8", nil},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/coffee-shops/clusters?"+test.query, nil)
+		boundingBox, err := GetBoundingBoxParam(r)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", test.query, boundingBox)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		if *boundingBox != *test.want {
+			t.Errorf("%q: expected %+v, got %+v", test.query, test.want, boundingBox)
+		}
+	}
+}
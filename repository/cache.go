@@ -0,0 +1,352 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+)
+
+// Prefixes of the cache keys, writes invalidate every key starting with the related prefixes
+const (
+	SHOP_LISTS_KEY       = "shops:"
+	SHOP_KEY             = "shop:"
+	OPENING_HOURS_KEY    = "hours:"
+	PHOTOS_KEY           = "photos:"
+	BAG_LISTS_KEY        = "bags:"
+	BAG_KEY              = "bag:"
+	BAGS_BY_SHOP_KEY     = "shopbags:"
+	SHOPS_BY_BAG_KEY     = "bagshops:"
+	DEFAULT_CACHE_SIZE   = 1000
+	DEFAULT_CACHE_TTL    = time.Minute
+	MAX_CACHED_LIST_SIZE = 100
+)
+
+var _ Repository = (*CachedRepository)(nil)
+
+// Repository that keeps the catalog reads (coffee shops, coffee bags, photos and opening hours) of another repository
+// in memory. Users, likes, follows and the feed are personal and always read from the wrapped repository.
+// Cached values are copied before being returned, because handlers complete the models they receive
+type CachedRepository struct {
+	Repository
+	cache *lruCache
+}
+
+func NewCachedRepository(repository Repository, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{Repository: repository, cache: newLRUCache(size, ttl)}
+}
+
+// Repository wrapped by the cache, or the same repository when it isn't cached. The cache is invalidated only by the
+// writes of its own process, the versions checked by If-Match must be read from the wrapped repository
+func Uncached(repository Repository) Repository {
+	if cachedRepository, ok := repository.(*CachedRepository); ok {
+		return cachedRepository.Repository
+	}
+	return repository
+}
+
+func (repo *CachedRepository) Stats() models.CacheStats {
+	return repo.cache.Stats()
+}
+
+func (repo *CachedRepository) GetCoffeeShops(ctx context.Context, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	// Whether a shop is open depends on the time, those lists are never cached
+	if openAt != nil {
+		return repo.Repository.GetCoffeeShops(ctx, page, size, openAt)
+	}
+	key := fmt.Sprintf("%slist:%d:%d", SHOP_LISTS_KEY, page, size)
+	return cachedCoffeeShops(repo.cache, key, func() ([]*models.CoffeeShop, error) {
+		return repo.Repository.GetCoffeeShops(ctx, page, size, openAt)
+	})
+}
+
+func (repo *CachedRepository) GetCoffeeShopById(ctx context.Context, id string) (*models.CoffeeShop, error) {
+	shops, err := cachedCoffeeShops(repo.cache, itemKey(SHOP_KEY, id), func() ([]*models.CoffeeShop, error) {
+		shop, err := repo.Repository.GetCoffeeShopById(ctx, id)
+		return []*models.CoffeeShop{shop}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shops[0], nil
+}
+
+func (repo *CachedRepository) SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	if openAt != nil {
+		return repo.Repository.SearchCoffeeShops(ctx, query, page, size, openAt)
+	}
+	key := fmt.Sprintf("%ssearch:%d:%d:%s", SHOP_LISTS_KEY, page, size, query)
+	return cachedCoffeeShops(repo.cache, key, func() ([]*models.CoffeeShop, error) {
+		return repo.Repository.SearchCoffeeShops(ctx, query, page, size, openAt)
+	})
+}
+
+func (repo *CachedRepository) GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	if openAt != nil {
+		return repo.Repository.GetNearestCoffeeShop(ctx, UserCoordinates, openAt)
+	}
+	key := fmt.Sprintf("%snearest:%v:%v", SHOP_LISTS_KEY, UserCoordinates.Latitude, UserCoordinates.Longitude)
+	return cachedCoffeeShops(repo.cache, key, func() ([]*models.CoffeeShop, error) {
+		return repo.Repository.GetNearestCoffeeShop(ctx, UserCoordinates, openAt)
+	})
+}
+
+func (repo *CachedRepository) GetCoffeeShopClusters(ctx context.Context, clustersRequest *models.CoffeeShopClustersRequest) ([]*models.CoffeeShopCluster, error) {
+	key := fmt.Sprintf("%sclusters:%+v", SHOP_LISTS_KEY, *clustersRequest)
+	generation := repo.cache.Generation()
+	if value, ok := repo.cache.Get(key); ok {
+		return value.([]*models.CoffeeShopCluster), nil
+	}
+	// Clusters are never modified by the handlers, they can be shared
+	clusters, err := repo.Repository.GetCoffeeShopClusters(ctx, clustersRequest)
+	if err == nil {
+		repo.cache.Set(key, clusters, generation)
+	}
+	return clusters, err
+}
+
+func (repo *CachedRepository) CreateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) (string, error) {
+	defer repo.cache.Invalidate(SHOP_LISTS_KEY)
+	return repo.Repository.CreateCoffeeShop(ctx, shopRequest)
+}
+
+// The city of the coffee shop can change, and the coffee bags list is filtered by it
+func (repo *CachedRepository) UpdateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) error {
+	defer repo.cache.Invalidate(SHOP_LISTS_KEY, itemKey(SHOP_KEY, shopRequest.ID), SHOPS_BY_BAG_KEY, BAG_LISTS_KEY)
+	return repo.Repository.UpdateCoffeeShop(ctx, shopRequest)
+}
+
+func (repo *CachedRepository) ImportCoffeeShops(ctx context.Context, shops []*models.CoffeeShop, radius float64, dryRun bool) ([]string, error) {
+	if !dryRun {
+		defer repo.cache.Invalidate(SHOP_LISTS_KEY, SHOP_KEY, SHOPS_BY_BAG_KEY, BAG_LISTS_KEY)
+	}
+	return repo.Repository.ImportCoffeeShops(ctx, shops, radius, dryRun)
+}
+
+func (repo *CachedRepository) DeleteCoffeeShop(ctx context.Context, id string, version uint64) error {
+	defer repo.cache.Invalidate(SHOP_LISTS_KEY, itemKey(SHOP_KEY, id), SHOPS_BY_BAG_KEY, itemKey(BAGS_BY_SHOP_KEY, id), itemKey(OPENING_HOURS_KEY, id), itemKey(PHOTOS_KEY, id), BAG_LISTS_KEY)
+	return repo.Repository.DeleteCoffeeShop(ctx, id, version)
+}
+
+// Opening hours are cached by coffee shop, only the missing ones are read from the wrapped repository
+func (repo *CachedRepository) GetOpeningHours(ctx context.Context, coffeeShopIds []string) (map[string]*models.OpeningHours, error) {
+	generation := repo.cache.Generation()
+	hours := make(map[string]*models.OpeningHours, len(coffeeShopIds))
+	var missing []string
+	for _, id := range coffeeShopIds {
+		if value, ok := repo.cache.Get(itemKey(OPENING_HOURS_KEY, id)); ok {
+			hours[id] = value.(*models.OpeningHours)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return hours, nil
+	}
+	missingHours, err := repo.Repository.GetOpeningHours(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	// Opening hours are never modified by the handlers, they can be shared
+	for id, openingHours := range missingHours {
+		repo.cache.Set(itemKey(OPENING_HOURS_KEY, id), openingHours, generation)
+		hours[id] = openingHours
+	}
+	return hours, nil
+}
+
+func (repo *CachedRepository) UpdateOpeningHours(ctx context.Context, openingHours *models.OpeningHours) error {
+	defer repo.cache.Invalidate(itemKey(OPENING_HOURS_KEY, openingHours.CoffeeShopId), itemKey(SHOP_KEY, openingHours.CoffeeShopId), SHOP_LISTS_KEY)
+	return repo.Repository.UpdateOpeningHours(ctx, openingHours)
+}
+
+// Photos are cached by coffee shop, only the missing ones are read from the wrapped repository
+func (repo *CachedRepository) GetCoffeeShopPhotos(ctx context.Context, coffeeShopIds []string) (map[string][]*models.ShopPhoto, error) {
+	generation := repo.cache.Generation()
+	photos := make(map[string][]*models.ShopPhoto, len(coffeeShopIds))
+	var missing []string
+	for _, id := range coffeeShopIds {
+		if value, ok := repo.cache.Get(itemKey(PHOTOS_KEY, id)); ok {
+			photos[id] = copyShopPhotos(value.([]*models.ShopPhoto))
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return photos, nil
+	}
+	missingPhotos, err := repo.Repository.GetCoffeeShopPhotos(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range missing {
+		// Shops without photos are cached as well
+		repo.cache.Set(itemKey(PHOTOS_KEY, id), copyShopPhotos(missingPhotos[id]), generation)
+		if len(missingPhotos[id]) > 0 {
+			photos[id] = missingPhotos[id]
+		}
+	}
+	return photos, nil
+}
+
+func (repo *CachedRepository) AddCoffeeShopPhoto(ctx context.Context, photo *models.ShopPhoto) (*models.ShopPhoto, error) {
+	defer repo.cache.Invalidate(itemKey(PHOTOS_KEY, photo.CoffeeShopId), itemKey(SHOP_KEY, photo.CoffeeShopId), SHOP_LISTS_KEY)
+	return repo.Repository.AddCoffeeShopPhoto(ctx, photo)
+}
+
+func (repo *CachedRepository) DeleteCoffeeShopPhoto(ctx context.Context, coffeeShopId string, photoId string) (*models.ShopPhoto, error) {
+	defer repo.cache.Invalidate(itemKey(PHOTOS_KEY, coffeeShopId), itemKey(SHOP_KEY, coffeeShopId), SHOP_LISTS_KEY)
+	return repo.Repository.DeleteCoffeeShopPhoto(ctx, coffeeShopId, photoId)
+}
+
+func (repo *CachedRepository) GetCoffeeBags(ctx context.Context, CoffeeBagsList models.CoffeeBagsList) ([]*models.CoffeeBag, error) {
+	key := fmt.Sprintf("%slist:%+v", BAG_LISTS_KEY, CoffeeBagsList)
+	return cachedCoffeeBags(repo.cache, key, func() ([]*models.CoffeeBag, error) {
+		return repo.Repository.GetCoffeeBags(ctx, CoffeeBagsList)
+	})
+}
+
+func (repo *CachedRepository) GetCoffeeBagById(ctx context.Context, coffeeBagId string) (*models.CoffeeBag, error) {
+	coffeeBags, err := cachedCoffeeBags(repo.cache, itemKey(BAG_KEY, coffeeBagId), func() ([]*models.CoffeeBag, error) {
+		coffeeBag, err := repo.Repository.GetCoffeeBagById(ctx, coffeeBagId)
+		return []*models.CoffeeBag{coffeeBag}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coffeeBags[0], nil
+}
+
+func (repo *CachedRepository) CreateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error) {
+	defer repo.cache.Invalidate(BAG_LISTS_KEY)
+	return repo.Repository.CreateCoffeeBag(ctx, coffeeBag)
+}
+
+func (repo *CachedRepository) UpdateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error) {
+	defer repo.cache.Invalidate(BAG_LISTS_KEY, itemKey(BAG_KEY, coffeeBag.ID), BAGS_BY_SHOP_KEY)
+	return repo.Repository.UpdateCoffeeBag(ctx, coffeeBag)
+}
+
+func (repo *CachedRepository) ImportCoffeeBags(ctx context.Context, coffeeBags []*models.CoffeeBag, dryRun bool) ([]string, error) {
+	if !dryRun {
+		defer repo.cache.Invalidate(BAG_LISTS_KEY, BAG_KEY, BAGS_BY_SHOP_KEY)
+	}
+	return repo.Repository.ImportCoffeeBags(ctx, coffeeBags, dryRun)
+}
+
+func (repo *CachedRepository) DeleteCoffeeBag(ctx context.Context, coffeeBagId string, version uint64) error {
+	defer repo.cache.Invalidate(BAG_LISTS_KEY, itemKey(BAG_KEY, coffeeBagId), BAGS_BY_SHOP_KEY, itemKey(SHOPS_BY_BAG_KEY, coffeeBagId))
+	return repo.Repository.DeleteCoffeeBag(ctx, coffeeBagId, version)
+}
+
+func (repo *CachedRepository) GetCoffeeBagByCoffeeShop(ctx context.Context, coffeeShopId *models.CoffeeBagByShopId) ([]*models.CoffeeBag, error) {
+	key := fmt.Sprintf("%s%d:%d", itemKey(BAGS_BY_SHOP_KEY, coffeeShopId.CoffeeShopId), coffeeShopId.Page, coffeeShopId.Size)
+	return cachedCoffeeBags(repo.cache, key, func() ([]*models.CoffeeBag, error) {
+		return repo.Repository.GetCoffeeBagByCoffeeShop(ctx, coffeeShopId)
+	})
+}
+
+func (repo *CachedRepository) GetCoffeeShopsByCoffeeBag(ctx context.Context, coffeeBagId *models.CoffeeShopsByCoffeeBagId) ([]*models.CoffeeShop, error) {
+	coordinates := "none"
+	if coffeeBagId.Coordinates != nil {
+		coordinates = fmt.Sprintf("%v:%v", coffeeBagId.Coordinates.Latitude, coffeeBagId.Coordinates.Longitude)
+	}
+	key := fmt.Sprintf("%s%d:%d:%s", itemKey(SHOPS_BY_BAG_KEY, coffeeBagId.CoffeeBagId), coffeeBagId.Page, coffeeBagId.Size, coordinates)
+	return cachedCoffeeShops(repo.cache, key, func() ([]*models.CoffeeShop, error) {
+		return repo.Repository.GetCoffeeShopsByCoffeeBag(ctx, coffeeBagId)
+	})
+}
+
+func (repo *CachedRepository) AddCoffeeBagToCoffeeShop(ctx context.Context, availability *models.CoffeeBagAvailability) error {
+	defer repo.invalidateAvailability(availability.CoffeeShopId, availability.CoffeeBagId)
+	return repo.Repository.AddCoffeeBagToCoffeeShop(ctx, availability)
+}
+
+func (repo *CachedRepository) UpdateCoffeeBagAvailability(ctx context.Context, availability *models.CoffeeBagAvailability) (*models.CoffeeBagAvailability, error) {
+	defer repo.invalidateAvailability(availability.CoffeeShopId, availability.CoffeeBagId)
+	return repo.Repository.UpdateCoffeeBagAvailability(ctx, availability)
+}
+
+func (repo *CachedRepository) RemoveCoffeeBagFromCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error {
+	defer repo.invalidateAvailability(coffeeShopId, coffeeBagId)
+	return repo.Repository.RemoveCoffeeBagFromCoffeeShop(ctx, coffeeBagId, coffeeShopId)
+}
+
+// The coffee bags list is filtered by the city of the shops selling them, so it changes as well
+func (repo *CachedRepository) invalidateAvailability(coffeeShopId string, coffeeBagId string) {
+	repo.cache.Invalidate(itemKey(BAGS_BY_SHOP_KEY, coffeeShopId), itemKey(SHOPS_BY_BAG_KEY, coffeeBagId), BAG_LISTS_KEY)
+}
+
+// Key of a single item, or prefix of the keys of its lists. The separator at the end prevents the key of the item 1
+// from being a prefix of the key of the item 12
+func itemKey(prefix string, id string) string {
+	return prefix + id + ":"
+}
+
+func cachedCoffeeShops(cache *lruCache, key string, read func() ([]*models.CoffeeShop, error)) ([]*models.CoffeeShop, error) {
+	generation := cache.Generation()
+	if value, ok := cache.Get(key); ok {
+		return copyCoffeeShops(value.([]*models.CoffeeShop)), nil
+	}
+	shops, err := read()
+	// Big pages would take most of the cache
+	if err == nil && len(shops) <= MAX_CACHED_LIST_SIZE {
+		cache.Set(key, copyCoffeeShops(shops), generation)
+	}
+	return shops, err
+}
+
+func cachedCoffeeBags(cache *lruCache, key string, read func() ([]*models.CoffeeBag, error)) ([]*models.CoffeeBag, error) {
+	generation := cache.Generation()
+	if value, ok := cache.Get(key); ok {
+		return copyCoffeeBags(value.([]*models.CoffeeBag)), nil
+	}
+	coffeeBags, err := read()
+	if err == nil && len(coffeeBags) <= MAX_CACHED_LIST_SIZE {
+		cache.Set(key, copyCoffeeBags(coffeeBags), generation)
+	}
+	return coffeeBags, err
+}
+
+func copyCoffeeShops(shops []*models.CoffeeShop) []*models.CoffeeShop {
+	if shops == nil {
+		return nil
+	}
+	copies := make([]*models.CoffeeShop, len(shops))
+	for i, shop := range shops {
+		shopCopy := *shop
+		shopCopy.Photos = copyShopPhotos(shop.Photos)
+		copies[i] = &shopCopy
+	}
+	return copies
+}
+
+func copyCoffeeBags(coffeeBags []*models.CoffeeBag) []*models.CoffeeBag {
+	if coffeeBags == nil {
+		return nil
+	}
+	copies := make([]*models.CoffeeBag, len(coffeeBags))
+	for i, coffeeBag := range coffeeBags {
+		coffeeBagCopy := *coffeeBag
+		coffeeBagCopy.TastingNotes = append(coffeeBag.TastingNotes[:0:0], coffeeBag.TastingNotes...)
+		if coffeeBag.Availability != nil {
+			availability := *coffeeBag.Availability
+			coffeeBagCopy.Availability = &availability
+		}
+		copies[i] = &coffeeBagCopy
+	}
+	return copies
+}
+
+func copyShopPhotos(photos []*models.ShopPhoto) []*models.ShopPhoto {
+	if photos == nil {
+		return nil
+	}
+	copies := make([]*models.ShopPhoto, len(photos))
+	for i, photo := range photos {
+		photoCopy := *photo
+		copies[i] = &photoCopy
+	}
+	return copies
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEvictsTheLeastRecentlyUsed(t *testing.T) {
+	cache := newLRUCache(2, time.Minute)
+	cache.Set("a", 1, cache.Generation())
+	cache.Set("b", 2, cache.Generation())
+	// Reading a makes b the least recently used entry
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Fatalf("expected a to be cached, got %v", value)
+	}
+	cache.Set("c", 3, cache.Generation())
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for key, expected := range map[string]int{"a": 1, "c": 3} {
+		if value, ok := cache.Get(key); !ok || value != expected {
+			t.Errorf("expected %s to be %d, got %v", key, expected, value)
+		}
+	}
+	// Setting an existing key replaces its value without evicting anything
+	cache.Set("a", 10, cache.Generation())
+	if value, _ := cache.Get("a"); value != 10 {
+		t.Errorf("expected a to be replaced, got %v", value)
+	}
+	stats := cache.Stats()
+	if stats.Size != 2 || stats.Evictions != 1 || stats.Hits != 4 || stats.Misses != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	cache := newLRUCache(10, 10*time.Millisecond)
+	cache.Set("a", 1, cache.Generation())
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expected a to expire")
+	}
+	if stats := cache.Stats(); stats.Size != 0 {
+		t.Errorf("expected expired entries to be removed, got %+v", stats)
+	}
+}
+
+func TestLRUCacheInvalidate(t *testing.T) {
+	cache := newLRUCache(10, time.Minute)
+	for _, key := range []string{itemKey(SHOP_KEY, "1"), itemKey(SHOP_KEY, "12"), SHOP_LISTS_KEY + "list:0:10", BAG_LISTS_KEY + "list"} {
+		cache.Set(key, key, cache.Generation())
+	}
+	cache.Invalidate(itemKey(SHOP_KEY, "1"), SHOP_LISTS_KEY)
+	for key, cached := range map[string]bool{
+		itemKey(SHOP_KEY, "1"):       false,
+		itemKey(SHOP_KEY, "12"):      true,
+		SHOP_LISTS_KEY + "list:0:10": false,
+		BAG_LISTS_KEY + "list":       true,
+	} {
+		if _, ok := cache.Get(key); ok != cached {
+			t.Errorf("expected %s to be cached: %t", key, cached)
+		}
+	}
+}
+
+func TestLRUCacheDiscardsValuesReadBeforeAnInvalidation(t *testing.T) {
+	cache := newLRUCache(10, time.Minute)
+	generation := cache.Generation()
+	// A write invalidates the cache while the value is being read from the database
+	cache.Invalidate(SHOP_KEY)
+	cache.Set(itemKey(SHOP_KEY, "1"), "stale", generation)
+	if _, ok := cache.Get(itemKey(SHOP_KEY, "1")); ok {
+		t.Error("expected the stale value to be discarded")
+	}
+	cache.Set(itemKey(SHOP_KEY, "1"), "fresh", cache.Generation())
+	if value, _ := cache.Get(itemKey(SHOP_KEY, "1")); value != "fresh" {
+		t.Errorf("expected the fresh value to be cached, got %v", value)
+	}
+}
@@ -2,24 +2,36 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/EduardoZepeda/go-coffee-api/models"
 	_ "github.com/lib/pq"
 )
 
 type Repository interface {
-	GetCoffeeShops(ctx context.Context, page uint64, size uint64) ([]*models.CoffeeShop, error)
+	GetCoffeeShops(ctx context.Context, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error)
 	GetCoffeeShopById(ctx context.Context, id string) (*models.CoffeeShop, error)
 	CreateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) (string, error)
-	DeleteCoffeeShop(ctx context.Context, id string) error
+	DeleteCoffeeShop(ctx context.Context, id string, version uint64) error
 	UpdateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) error
-	SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64) ([]*models.CoffeeShop, error)
-	GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates) ([]*models.CoffeeShop, error)
+	SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error)
+	GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates, openAt *time.Time) ([]*models.CoffeeShop, error)
+	GetOpeningHours(ctx context.Context, coffeeShopIds []string) (map[string]*models.OpeningHours, error)
+	UpdateOpeningHours(ctx context.Context, openingHours *models.OpeningHours) error
+	GetCoffeeShopPhotos(ctx context.Context, coffeeShopIds []string) (map[string][]*models.ShopPhoto, error)
+	AddCoffeeShopPhoto(ctx context.Context, photo *models.ShopPhoto) (*models.ShopPhoto, error)
+	DeleteCoffeeShopPhoto(ctx context.Context, coffeeShopId string, photoId string) (*models.ShopPhoto, error)
+	ImportCoffeeShops(ctx context.Context, shops []*models.CoffeeShop, radius float64, dryRun bool) ([]string, error)
+	GetCoffeeShopClusters(ctx context.Context, clustersRequest *models.CoffeeShopClustersRequest) ([]*models.CoffeeShopCluster, error)
 	GetUser(ctx context.Context, email string) (*models.User, error)
 	GetUserById(ctx context.Context, id string) (*models.GetUserResponse, error)
 	RegisterUser(ctx context.Context, user *models.SignUpRequest) error
 	UpdateUser(ctx context.Context, user *models.UpdateUserRequest) error
-	DeleteUser(ctx context.Context, id string) error
+	UpdateProfilePicture(ctx context.Context, userId string, image string) error
+	DeleteUser(ctx context.Context, id string, version uint64) error
+	SetUserStaff(ctx context.Context, email string, isStaff bool) error
+	UpdateUserPassword(ctx context.Context, email string, hashedPassword string) error
+	DeleteUserTokens(ctx context.Context, userId string, scope string) (int64, error)
 	UnfollowUser(ctx context.Context, followUnfollowUserRequest *models.FollowUnfollowRequest) error
 	FollowUser(ctx context.Context, followUnfollowUserRequest *models.FollowUnfollowRequest) error
 	GetUserFollowing(ctx context.Context, userId string) ([]*models.GetUserResponse, error)
@@ -28,14 +40,19 @@ type Repository interface {
 	LikeCoffeeShop(ctx context.Context, like *models.LikeUnlikeCoffeeShopRequest) error
 	UnlikeCoffeeShop(ctx context.Context, like *models.LikeUnlikeCoffeeShopRequest) error
 	GetUserFeed(ctx context.Context, id string) ([]*models.Feed, error)
-	GetCoffeeBag(ctx context.Context, CoffeeBagsList models.CoffeeBagsList) ([]*models.CoffeeBag, error)
+	GetCoffeeBags(ctx context.Context, CoffeeBagsList models.CoffeeBagsList) ([]*models.CoffeeBag, error)
 	GetCoffeeBagById(ctx context.Context, coffeeBagId string) (*models.CoffeeBag, error)
 	CreateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error)
 	UpdateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.CoffeeBag, error)
-	DeleteCoffeeBag(ctx context.Context, coffeeShopId string) error
+	DeleteCoffeeBag(ctx context.Context, coffeeBagId string, version uint64) error
+	ImportCoffeeBags(ctx context.Context, coffeeBags []*models.CoffeeBag, dryRun bool) ([]string, error)
 	GetCoffeeBagByCoffeeShop(ctx context.Context, coffeeShopId *models.CoffeeBagByShopId) ([]*models.CoffeeBag, error)
-	AddCoffeeBagToCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error
+	GetCoffeeShopsByCoffeeBag(ctx context.Context, coffeeBagId *models.CoffeeShopsByCoffeeBagId) ([]*models.CoffeeShop, error)
+	AddCoffeeBagToCoffeeShop(ctx context.Context, availability *models.CoffeeBagAvailability) error
+	UpdateCoffeeBagAvailability(ctx context.Context, availability *models.CoffeeBagAvailability) (*models.CoffeeBagAvailability, error)
 	RemoveCoffeeBagFromCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error
+	GetCatalogStats(ctx context.Context) (*models.CatalogStats, error)
+	SchemaVersion(ctx context.Context) (*models.SchemaVersion, error)
 	Close() error
 }
 
@@ -45,8 +62,8 @@ func SetRepository(repository Repository) {
 	implementation = repository
 }
 
-func GetCoffeeShops(ctx context.Context, page uint64, size uint64) ([]*models.CoffeeShop, error) {
-	return implementation.GetCoffeeShops(ctx, page, size)
+func GetCoffeeShops(ctx context.Context, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	return implementation.GetCoffeeShops(ctx, page, size, openAt)
 }
 
 func GetCoffeeShopById(ctx context.Context, id string) (*models.CoffeeShop, error) {
@@ -57,20 +74,48 @@ func CreateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) (stri
 	return implementation.CreateCoffeeShop(ctx, shopRequest)
 }
 
-func DeleteCoffeeShop(ctx context.Context, id string) error {
-	return implementation.DeleteCoffeeShop(ctx, id)
+func DeleteCoffeeShop(ctx context.Context, id string, version uint64) error {
+	return implementation.DeleteCoffeeShop(ctx, id, version)
 }
 
 func UpdateCoffeeShop(ctx context.Context, shopRequest *models.CoffeeShop) error {
 	return implementation.UpdateCoffeeShop(ctx, shopRequest)
 }
 
-func SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64) ([]*models.CoffeeShop, error) {
-	return implementation.SearchCoffeeShops(ctx, query, page, size)
+func SearchCoffeeShops(ctx context.Context, query string, page uint64, size uint64, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	return implementation.SearchCoffeeShops(ctx, query, page, size, openAt)
 }
 
-func GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates) ([]*models.CoffeeShop, error) {
-	return implementation.GetNearestCoffeeShop(ctx, UserCoordinates)
+func GetNearestCoffeeShop(ctx context.Context, UserCoordinates *models.UserCoordinates, openAt *time.Time) ([]*models.CoffeeShop, error) {
+	return implementation.GetNearestCoffeeShop(ctx, UserCoordinates, openAt)
+}
+
+func GetOpeningHours(ctx context.Context, coffeeShopIds []string) (map[string]*models.OpeningHours, error) {
+	return implementation.GetOpeningHours(ctx, coffeeShopIds)
+}
+
+func UpdateOpeningHours(ctx context.Context, openingHours *models.OpeningHours) error {
+	return implementation.UpdateOpeningHours(ctx, openingHours)
+}
+
+func GetCoffeeShopPhotos(ctx context.Context, coffeeShopIds []string) (map[string][]*models.ShopPhoto, error) {
+	return implementation.GetCoffeeShopPhotos(ctx, coffeeShopIds)
+}
+
+func AddCoffeeShopPhoto(ctx context.Context, photo *models.ShopPhoto) (*models.ShopPhoto, error) {
+	return implementation.AddCoffeeShopPhoto(ctx, photo)
+}
+
+func DeleteCoffeeShopPhoto(ctx context.Context, coffeeShopId string, photoId string) (*models.ShopPhoto, error) {
+	return implementation.DeleteCoffeeShopPhoto(ctx, coffeeShopId, photoId)
+}
+
+func ImportCoffeeShops(ctx context.Context, shops []*models.CoffeeShop, radius float64, dryRun bool) ([]string, error) {
+	return implementation.ImportCoffeeShops(ctx, shops, radius, dryRun)
+}
+
+func GetCoffeeShopClusters(ctx context.Context, clustersRequest *models.CoffeeShopClustersRequest) ([]*models.CoffeeShopCluster, error) {
+	return implementation.GetCoffeeShopClusters(ctx, clustersRequest)
 }
 
 func GetUser(ctx context.Context, email string) (*models.User, error) {
@@ -89,8 +134,24 @@ func UpdateUser(ctx context.Context, user *models.UpdateUserRequest) error {
 	return implementation.UpdateUser(ctx, user)
 }
 
-func DeleteUser(ctx context.Context, id string) error {
-	return implementation.DeleteUser(ctx, id)
+func UpdateProfilePicture(ctx context.Context, userId string, image string) error {
+	return implementation.UpdateProfilePicture(ctx, userId, image)
+}
+
+func DeleteUser(ctx context.Context, id string, version uint64) error {
+	return implementation.DeleteUser(ctx, id, version)
+}
+
+func SetUserStaff(ctx context.Context, email string, isStaff bool) error {
+	return implementation.SetUserStaff(ctx, email, isStaff)
+}
+
+func UpdateUserPassword(ctx context.Context, email string, hashedPassword string) error {
+	return implementation.UpdateUserPassword(ctx, email, hashedPassword)
+}
+
+func DeleteUserTokens(ctx context.Context, userId string, scope string) (int64, error) {
+	return implementation.DeleteUserTokens(ctx, userId, scope)
 }
 
 func GetUserFollowing(ctx context.Context, userId string) ([]*models.GetUserResponse, error) {
@@ -125,8 +186,8 @@ func GetUserFeed(ctx context.Context, id string) ([]*models.Feed, error) {
 	return implementation.GetUserFeed(ctx, id)
 }
 
-func GetCoffeeBag(ctx context.Context, CoffeeBagsList models.CoffeeBagsList) ([]*models.CoffeeBag, error) {
-	return implementation.GetCoffeeBag(ctx, CoffeeBagsList)
+func GetCoffeeBags(ctx context.Context, CoffeeBagsList models.CoffeeBagsList) ([]*models.CoffeeBag, error) {
+	return implementation.GetCoffeeBags(ctx, CoffeeBagsList)
 }
 
 func GetCoffeeBagById(ctx context.Context, coffeeBagId string) (*models.CoffeeBag, error) {
@@ -141,22 +202,42 @@ func UpdateCoffeeBag(ctx context.Context, coffeeBag *models.CoffeeBag) (*models.
 	return implementation.UpdateCoffeeBag(ctx, coffeeBag)
 }
 
-func DeleteCoffeeBag(ctx context.Context, coffeeBagId string) error {
-	return implementation.DeleteCoffeeBag(ctx, coffeeBagId)
+func DeleteCoffeeBag(ctx context.Context, coffeeBagId string, version uint64) error {
+	return implementation.DeleteCoffeeBag(ctx, coffeeBagId, version)
+}
+
+func ImportCoffeeBags(ctx context.Context, coffeeBags []*models.CoffeeBag, dryRun bool) ([]string, error) {
+	return implementation.ImportCoffeeBags(ctx, coffeeBags, dryRun)
 }
 
 func GetCoffeeBagByCoffeeShop(ctx context.Context, coffeeShopId *models.CoffeeBagByShopId) ([]*models.CoffeeBag, error) {
 	return implementation.GetCoffeeBagByCoffeeShop(ctx, coffeeShopId)
 }
 
-func AddCoffeeBagToCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error {
-	return implementation.AddCoffeeBagToCoffeeShop(ctx, coffeeBagId, coffeeShopId)
+func GetCoffeeShopsByCoffeeBag(ctx context.Context, coffeeBagId *models.CoffeeShopsByCoffeeBagId) ([]*models.CoffeeShop, error) {
+	return implementation.GetCoffeeShopsByCoffeeBag(ctx, coffeeBagId)
+}
+
+func AddCoffeeBagToCoffeeShop(ctx context.Context, availability *models.CoffeeBagAvailability) error {
+	return implementation.AddCoffeeBagToCoffeeShop(ctx, availability)
+}
+
+func UpdateCoffeeBagAvailability(ctx context.Context, availability *models.CoffeeBagAvailability) (*models.CoffeeBagAvailability, error) {
+	return implementation.UpdateCoffeeBagAvailability(ctx, availability)
 }
 
 func RemoveCoffeeBagFromCoffeeShop(ctx context.Context, coffeeBagId string, coffeeShopId string) error {
 	return implementation.RemoveCoffeeBagFromCoffeeShop(ctx, coffeeBagId, coffeeShopId)
 }
 
+func GetCatalogStats(ctx context.Context) (*models.CatalogStats, error) {
+	return implementation.GetCatalogStats(ctx)
+}
+
+func SchemaVersion(ctx context.Context) (*models.SchemaVersion, error) {
+	return implementation.SchemaVersion(ctx)
+}
+
 func Close() error {
 	return implementation.Close()
 }
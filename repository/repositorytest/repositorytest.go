@@ -0,0 +1,963 @@
+// Package repositorytest is a conformance suite for implementations of repository.Repository. Every backend must
+// pass it, so the handlers can rely on the same pagination, errors and cascades whatever the storage is.
+package repositorytest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/migrations"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/schedule"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+)
+
+// Returns an empty repository. It's called once per test, any cleanup must be registered with t.Cleanup
+type Factory func(t *testing.T) repository.Repository
+
+// An id that no backend hands out during the tests
+const MISSING_ID = "987654321"
+
+// Run the whole suite against the repositories returned by newRepository
+func Run(t *testing.T, newRepository Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo repository.Repository)
+	}{
+		{"CoffeeShopVersions", testCoffeeShopVersions},
+		{"CoffeeShopPagination", testCoffeeShopPagination},
+		{"SearchCoffeeShops", testSearchCoffeeShops},
+		{"NearestCoffeeShops", testNearestCoffeeShops},
+		{"OpenAt", testOpenAt},
+		{"OpeningHours", testOpeningHours},
+		{"CoffeeShopPhotos", testCoffeeShopPhotos},
+		{"CoffeeShopClusters", testCoffeeShopClusters},
+		{"ImportCoffeeShops", testImportCoffeeShops},
+		{"Users", testUsers},
+		{"AdminUsers", testAdminUsers},
+		{"Follows", testFollows},
+		{"Likes", testLikes},
+		{"Feed", testFeed},
+		{"CoffeeBags", testCoffeeBags},
+		{"CoffeeBagFilters", testCoffeeBagFilters},
+		{"CoffeeBagAvailability", testCoffeeBagAvailability},
+		{"ImportCoffeeBags", testImportCoffeeBags},
+		{"DeleteCoffeeShopCascades", testDeleteCoffeeShopCascades},
+		{"DeleteCoffeeBagCascades", testDeleteCoffeeBagCascades},
+		{"DeleteUserCascades", testDeleteUserCascades},
+		{"CatalogStats", testCatalogStats},
+		{"SchemaVersion", testSchemaVersion},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newRepository(t))
+		})
+	}
+}
+
+func testCoffeeShopVersions(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	id := createCoffeeShop(t, repo, "Café Version", 20.67, -103.35)
+	shop, err := repo.GetCoffeeShopById(ctx, id)
+	check(t, err)
+	if shop.Name != "Café Version" || shop.City != "Guadalajara" || shop.Location != (types.Point{20.67, -103.35}) {
+		t.Fatalf("unexpected coffee shop %+v", shop)
+	}
+	if shop.Version != 1 {
+		t.Fatalf("new coffee shops must start at version 1, got %d", shop.Version)
+	}
+	if _, err = repo.GetCoffeeShopById(ctx, MISSING_ID); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing coffee shop, got %v", err)
+	}
+
+	shop.Name = "Café Version 2"
+	check(t, repo.UpdateCoffeeShop(ctx, shop))
+	if shop.Version != 2 {
+		t.Fatalf("the version of the request must be increased after an update, got %d", shop.Version)
+	}
+	stale := *shop
+	stale.Version = 1
+	expectError(t, repo.UpdateCoffeeShop(ctx, &stale), models.ErrVersionMismatch)
+	missing := *shop
+	missing.ID = MISSING_ID
+	expectError(t, repo.UpdateCoffeeShop(ctx, &missing), sql.ErrNoRows)
+	updated, err := repo.GetCoffeeShopById(ctx, id)
+	check(t, err)
+	if updated.Name != "Café Version 2" || updated.Version != 2 {
+		t.Fatalf("unexpected coffee shop after the update %+v", updated)
+	}
+
+	expectError(t, repo.DeleteCoffeeShop(ctx, id, 1), models.ErrVersionMismatch)
+	check(t, repo.DeleteCoffeeShop(ctx, id, 2))
+	expectError(t, repo.DeleteCoffeeShop(ctx, id, 2), sql.ErrNoRows)
+	if _, err = repo.GetCoffeeShopById(ctx, id); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a deleted coffee shop, got %v", err)
+	}
+}
+
+func testCoffeeShopPagination(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, createCoffeeShop(t, repo, "Café", 20.67, -103.35))
+		// Coffee shops are listed by creation date, they can't share it
+		time.Sleep(2 * time.Millisecond)
+	}
+	pages := []struct {
+		page, size uint64
+		expected   []string
+	}{
+		{0, 2, []string{ids[4], ids[3]}},
+		{1, 2, []string{ids[2], ids[1]}},
+		{2, 2, []string{ids[0]}},
+		{3, 2, nil},
+		{0, 5, []string{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+		{0, 0, nil},
+	}
+	for _, page := range pages {
+		shops, err := repo.GetCoffeeShops(ctx, page.page, page.size, nil)
+		check(t, err)
+		expectShopIds(t, shops, page.expected...)
+	}
+}
+
+func testSearchCoffeeShops(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	roaster := createCoffeeShop(t, repo, "Tostadores del Centro", 20.67, -103.35)
+	createCoffeeShop(t, repo, "Café Chapultepec", 20.67, -103.36)
+	shops, err := repo.SearchCoffeeShops(ctx, "tostadores", 0, 10, nil)
+	check(t, err)
+	expectShopIds(t, shops, roaster)
+	shops, err = repo.SearchCoffeeShops(ctx, "tostadores", 1, 10, nil)
+	check(t, err)
+	expectShopIds(t, shops)
+	shops, err = repo.SearchCoffeeShops(ctx, "inexistente", 0, 10, nil)
+	check(t, err)
+	expectShopIds(t, shops)
+}
+
+func testNearestCoffeeShops(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	var ids []string
+	// Each coffee shop is farther than the previous one, only the nearest 10 are returned
+	for i := 0; i < 12; i++ {
+		ids = append(ids, createCoffeeShop(t, repo, "Café", 20.67+float64(i)*0.01, -103.35))
+	}
+	shops, err := repo.GetNearestCoffeeShop(ctx, &models.UserCoordinates{Latitude: 20.67, Longitude: -103.35}, nil)
+	check(t, err)
+	expectShopIds(t, shops, ids[:10]...)
+}
+
+func testOpenAt(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	open := createCoffeeShop(t, repo, "Café Abierto", 20.67, -103.35)
+	createCoffeeShop(t, repo, "Café Sin Horario", 20.67, -103.35)
+	hours := &models.OpeningHours{CoffeeShopId: open}
+	for weekday := 0; weekday < 7; weekday++ {
+		hours.Weekly = append(hours.Weekly, models.OpeningInterval{Weekday: weekday, Opens: "08:00", Closes: "20:00"})
+	}
+	check(t, repo.UpdateOpeningHours(ctx, hours))
+
+	noon := time.Date(2030, time.January, 15, 12, 0, 0, 0, schedule.Location)
+	midnight := time.Date(2030, time.January, 15, 23, 30, 0, 0, schedule.Location)
+	shops, err := repo.GetCoffeeShops(ctx, 0, 10, &noon)
+	check(t, err)
+	expectShopIds(t, shops, open)
+	shops, err = repo.GetCoffeeShops(ctx, 0, 10, &midnight)
+	check(t, err)
+	expectShopIds(t, shops)
+	shops, err = repo.SearchCoffeeShops(ctx, "abierto", 0, 10, &noon)
+	check(t, err)
+	expectShopIds(t, shops, open)
+	shops, err = repo.GetNearestCoffeeShop(ctx, &models.UserCoordinates{Latitude: 20.67, Longitude: -103.35}, &midnight)
+	check(t, err)
+	expectShopIds(t, shops)
+}
+
+func testOpeningHours(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	id := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	withoutHours := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	future := time.Now().In(schedule.Location).AddDate(0, 0, 10).Format(schedule.DATE_LAYOUT)
+	check(t, repo.UpdateOpeningHours(ctx, &models.OpeningHours{
+		CoffeeShopId: id,
+		Weekly: []models.OpeningInterval{
+			{Weekday: 2, Opens: "16:00", Closes: "20:00"},
+			{Weekday: 1, Opens: "08:00", Closes: "14:00"},
+			{Weekday: 2, Opens: "08:00", Closes: "14:00"},
+		},
+		Special: []models.SpecialHours{
+			{Date: "2020-01-01", Closed: true, Description: "Año nuevo"},
+			{Date: future, Opens: "10:00", Closes: "12:00", Description: "Inventario"},
+		},
+	}))
+	hours, err := repo.GetOpeningHours(ctx, []string{id, withoutHours})
+	check(t, err)
+	weekly := hours[id].Weekly
+	if len(weekly) != 3 || weekly[0].Weekday != 1 || weekly[1].Opens != "08:00" || weekly[2].Opens != "16:00" {
+		t.Fatalf("weekly hours must be sorted by weekday and opening time, got %+v", weekly)
+	}
+	special := hours[id].Special
+	if len(special) != 1 || special[0].Date != future || special[0].Opens != "10:00" || special[0].Description != "Inventario" {
+		t.Fatalf("only the upcoming special hours must be returned, got %+v", special)
+	}
+	if hours[withoutHours] == nil || len(hours[withoutHours].Weekly) != 0 || len(hours[withoutHours].Special) != 0 {
+		t.Fatalf("coffee shops without hours must have empty hours, got %+v", hours[withoutHours])
+	}
+
+	// Opening hours are replaced as a whole
+	check(t, repo.UpdateOpeningHours(ctx, &models.OpeningHours{CoffeeShopId: id}))
+	hours, err = repo.GetOpeningHours(ctx, []string{id})
+	check(t, err)
+	if len(hours[id].Weekly) != 0 || len(hours[id].Special) != 0 {
+		t.Fatalf("expected the opening hours to be replaced, got %+v", hours[id])
+	}
+	if err = repo.UpdateOpeningHours(ctx, &models.OpeningHours{CoffeeShopId: MISSING_ID, Weekly: weekly}); err == nil {
+		t.Fatal("expected an error when setting the opening hours of a missing coffee shop")
+	}
+}
+
+func testCoffeeShopPhotos(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	id := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	first, err := repo.AddCoffeeShopPhoto(ctx, &models.ShopPhoto{CoffeeShopId: id, Image: "photos/first.jpg"})
+	check(t, err)
+	time.Sleep(2 * time.Millisecond)
+	second, err := repo.AddCoffeeShopPhoto(ctx, &models.ShopPhoto{CoffeeShopId: id, Image: "photos/second.jpg"})
+	check(t, err)
+	if first.ID == "" || first.CreatedDate.IsZero() {
+		t.Fatalf("the id and creation date of the photo must be set, got %+v", first)
+	}
+	photos, err := repo.GetCoffeeShopPhotos(ctx, []string{id, MISSING_ID})
+	check(t, err)
+	if len(photos[id]) != 2 || photos[id][0].ID != first.ID || photos[id][1].Image != "photos/second.jpg" {
+		t.Fatalf("photos must be sorted by creation date, got %+v", photos[id])
+	}
+	if len(photos[MISSING_ID]) != 0 {
+		t.Fatalf("expected no photos for a missing coffee shop, got %+v", photos[MISSING_ID])
+	}
+
+	if _, err = repo.DeleteCoffeeShopPhoto(ctx, MISSING_ID, first.ID); err != sql.ErrNoRows {
+		t.Fatalf("a photo must only be deleted through its own coffee shop, got %v", err)
+	}
+	deleted, err := repo.DeleteCoffeeShopPhoto(ctx, id, first.ID)
+	check(t, err)
+	if deleted.Image != "photos/first.jpg" {
+		t.Fatalf("the deleted photo must be returned, got %+v", deleted)
+	}
+	if _, err = repo.DeleteCoffeeShopPhoto(ctx, id, first.ID); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a deleted photo, got %v", err)
+	}
+	photos, err = repo.GetCoffeeShopPhotos(ctx, []string{id})
+	check(t, err)
+	if len(photos[id]) != 1 || photos[id][0].ID != second.ID {
+		t.Fatalf("expected only the second photo, got %+v", photos[id])
+	}
+	if _, err = repo.AddCoffeeShopPhoto(ctx, &models.ShopPhoto{CoffeeShopId: MISSING_ID, Image: "photos/missing.jpg"}); err == nil {
+		t.Fatal("expected an error when adding a photo to a missing coffee shop")
+	}
+}
+
+func testCoffeeShopClusters(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		createCoffeeShop(t, repo, "Café Centro", 20.670+float64(i)*0.001, -103.350)
+	}
+	createCoffeeShop(t, repo, "Café Zapopan", 20.720, -103.400)
+	// Outside of the bounding box
+	createCoffeeShop(t, repo, "Café Monterrey", 25.680, -100.310)
+	clusters, err := repo.GetCoffeeShopClusters(ctx, &models.CoffeeShopClustersRequest{
+		Zoom:        12,
+		BoundingBox: models.BoundingBox{MinLatitude: 20, MaxLatitude: 21, MinLongitude: -104, MaxLongitude: -103},
+	})
+	check(t, err)
+	if len(clusters) != 2 || clusters[0].Count != 3 || clusters[1].Count != 1 {
+		t.Fatalf("expected a cluster of 3 coffee shops and another of 1, got %+v", clusters)
+	}
+	centre := clusters[0]
+	if !near(centre.Centroid[0], 20.671) || !near(centre.Centroid[1], -103.350) {
+		t.Fatalf("unexpected centroid %v", centre.Centroid)
+	}
+	if !near(centre.MinLatitude, 20.670) || !near(centre.MaxLatitude, 20.672) || !near(centre.MinLongitude, -103.350) || !near(centre.MaxLongitude, -103.350) {
+		t.Fatalf("unexpected bounding box %+v", centre.BoundingBox)
+	}
+}
+
+func testUsers(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	id := registerUser(t, repo, "barista")
+	user, err := repo.GetUser(ctx, "barista@example.com")
+	check(t, err)
+	if user.Id != id || user.Password != "hashed-barista" || user.IsStaff {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if _, err = repo.GetUser(ctx, "missing@example.com"); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing email, got %v", err)
+	}
+	if _, err = repo.GetUserById(ctx, MISSING_ID); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing user, got %v", err)
+	}
+	duplicates := []*models.SignUpRequest{
+		{Username: "barista", Email: "other@example.com", HashedPassword: "hashed"},
+		{Username: "other", Email: "barista@example.com", HashedPassword: "hashed"},
+	}
+	for _, duplicate := range duplicates {
+		err = repo.RegisterUser(ctx, duplicate)
+		if err == nil || err.Error() != "An user with that username or email address already exists" {
+			t.Fatalf("expected the unique user error for %+v, got %v", duplicate, err)
+		}
+	}
+
+	profile, err := repo.GetUserById(ctx, id)
+	check(t, err)
+	if profile.Username != "barista" || profile.Email != "barista@example.com" || profile.Version != 1 {
+		t.Fatalf("unexpected user %+v", profile)
+	}
+	update := &models.UpdateUserRequest{Id: id, Username: "barista", FirstName: "Ana", LastName: "López", Bio: "Latte art", Version: 1}
+	check(t, repo.UpdateUser(ctx, update))
+	if update.Version != 2 {
+		t.Fatalf("the version of the request must be increased after an update, got %d", update.Version)
+	}
+	update.Version = 1
+	expectError(t, repo.UpdateUser(ctx, update), models.ErrVersionMismatch)
+	check(t, repo.UpdateProfilePicture(ctx, id, "profiles/barista.jpg"))
+	profile, err = repo.GetUserById(ctx, id)
+	check(t, err)
+	if profile.FirstName != "Ana" || profile.Bio != "Latte art" || profile.ProfilePicture != "profiles/barista.jpg" || profile.Version != 3 {
+		t.Fatalf("the profile picture must increase the version as well, got %+v", profile)
+	}
+	expectError(t, repo.UpdateProfilePicture(ctx, MISSING_ID, "profiles/missing.jpg"), sql.ErrNoRows)
+	other := registerUser(t, repo, "roaster")
+	if err = repo.UpdateUser(ctx, &models.UpdateUserRequest{Id: other, Username: "barista", Version: 1}); err == nil {
+		t.Fatal("expected an error when taking the username of another user")
+	}
+
+	expectError(t, repo.DeleteUser(ctx, id, 1), models.ErrVersionMismatch)
+	check(t, repo.DeleteUser(ctx, id, 3))
+	expectError(t, repo.DeleteUser(ctx, id, 3), sql.ErrNoRows)
+	if _, err = repo.GetUser(ctx, "barista@example.com"); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a deleted user, got %v", err)
+	}
+}
+
+func testAdminUsers(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	id := registerUser(t, repo, "manager")
+	check(t, repo.SetUserStaff(ctx, "manager@example.com", true))
+	check(t, repo.UpdateUserPassword(ctx, "manager@example.com", "new-hash"))
+	user, err := repo.GetUser(ctx, "manager@example.com")
+	check(t, err)
+	if !user.IsStaff || user.Password != "new-hash" {
+		t.Fatalf("expected a staff user with the new password, got %+v", user)
+	}
+	profile, err := repo.GetUserById(ctx, id)
+	check(t, err)
+	if profile.Version != 3 {
+		t.Fatalf("promoting and changing the password must increase the version, got %d", profile.Version)
+	}
+	check(t, repo.SetUserStaff(ctx, "manager@example.com", false))
+	if user, err = repo.GetUser(ctx, "manager@example.com"); err != nil || user.IsStaff {
+		t.Fatalf("expected the user to be demoted, got %+v, %v", user, err)
+	}
+	expectError(t, repo.SetUserStaff(ctx, "missing@example.com", true), sql.ErrNoRows)
+	// Staff users can be registered directly
+	check(t, repo.RegisterUser(ctx, &models.SignUpRequest{Username: "director", Email: "director@example.com", HashedPassword: "hashed", IsStaff: true}))
+	if user, err = repo.GetUser(ctx, "director@example.com"); err != nil || !user.IsStaff {
+		t.Fatalf("expected a staff user, got %+v, %v", user, err)
+	}
+	expectError(t, repo.UpdateUserPassword(ctx, "missing@example.com", "hash"), sql.ErrNoRows)
+	deleted, err := repo.DeleteUserTokens(ctx, id, "")
+	check(t, err)
+	if deleted != 0 {
+		t.Fatalf("expected no tokens for a new user, %d were deleted", deleted)
+	}
+}
+
+func testFollows(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	barista, roaster, farmer := registerUser(t, repo, "barista"), registerUser(t, repo, "roaster"), registerUser(t, repo, "farmer")
+	check(t, repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: barista, UserToId: roaster}))
+	check(t, repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: farmer, UserToId: roaster}))
+	err := repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: barista, UserToId: roaster})
+	if err == nil || err.Error() != "You are already following this user" {
+		t.Fatalf("expected the already following error, got %v", err)
+	}
+	if err = repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: barista, UserToId: MISSING_ID}); err == nil {
+		t.Fatal("expected an error when following a missing user")
+	}
+
+	following, err := repo.GetUserFollowing(ctx, barista)
+	check(t, err)
+	expectUsernames(t, following, "roaster")
+	followers, err := repo.GetUserFollowers(ctx, roaster)
+	check(t, err)
+	expectUsernames(t, followers, "barista", "farmer")
+	followers, err = repo.GetUserFollowers(ctx, barista)
+	check(t, err)
+	expectUsernames(t, followers)
+
+	check(t, repo.UnfollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: barista, UserToId: roaster}))
+	// Unfollowing twice is not an error
+	check(t, repo.UnfollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: barista, UserToId: roaster}))
+	following, err = repo.GetUserFollowing(ctx, barista)
+	check(t, err)
+	expectUsernames(t, following)
+	check(t, repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: barista, UserToId: roaster}))
+}
+
+func testLikes(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := registerUser(t, repo, "barista")
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+		check(t, repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: id}))
+		ids = append(ids, id)
+	}
+	err := repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: ids[0]})
+	if err == nil || err.Error() != "You already like that coffee shop. You can't like it twice." {
+		t.Fatalf("expected the double like error, got %v", err)
+	}
+	if err = repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: MISSING_ID}); err == nil {
+		t.Fatal("expected an error when liking a missing coffee shop")
+	}
+
+	liked, err := repo.GetLikedCoffeeShops(ctx, &models.LikesByUserRequest{UserId: user, Pagination: models.Pagination{Page: 0, Size: 2}})
+	check(t, err)
+	expectShopCount(t, liked, 2)
+	liked, err = repo.GetLikedCoffeeShops(ctx, &models.LikesByUserRequest{UserId: user, Pagination: models.Pagination{Page: 1, Size: 2}})
+	check(t, err)
+	expectShopCount(t, liked, 1)
+	liked, err = repo.GetLikedCoffeeShops(ctx, &models.LikesByUserRequest{UserId: user, Pagination: models.Pagination{Page: 2, Size: 2}})
+	check(t, err)
+	expectShopCount(t, liked, 0)
+
+	check(t, repo.UnlikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: ids[0]}))
+	check(t, repo.UnlikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: ids[0]}))
+	liked, err = repo.GetLikedCoffeeShops(ctx, &models.LikesByUserRequest{UserId: user, Pagination: models.Pagination{Page: 0, Size: 10}})
+	check(t, err)
+	expectShopCount(t, liked, 2)
+	check(t, repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: ids[0]}))
+}
+
+// Actions are written by the original Django application, only reading them is part of the contract
+func testFeed(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := registerUser(t, repo, "barista")
+	feed, err := repo.GetUserFeed(ctx, user)
+	check(t, err)
+	if len(feed) != 0 {
+		t.Fatalf("expected an empty feed for a new user, got %+v", feed)
+	}
+	// The actions of the feed are recorded by the Django application, not by the repository
+	other := registerUser(t, repo, "roaster")
+	shop := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	check(t, repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: user, UserToId: other}))
+	check(t, repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: shop}))
+	feed, err = repo.GetUserFeed(ctx, user)
+	check(t, err)
+	if len(feed) != 0 {
+		t.Fatalf("expected follows and likes to not be added to the feed, got %+v", feed)
+	}
+	feed, err = repo.GetUserFeed(ctx, MISSING_ID)
+	check(t, err)
+	if len(feed) != 0 {
+		t.Fatalf("expected an empty feed for a missing user, got %+v", feed)
+	}
+}
+
+func testCoffeeBags(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	altitude, weight, price := 1200, 250, 180.5
+	coffeeBag, err := repo.CreateCoffeeBag(ctx, &models.CoffeeBag{
+		Brand: "Finca Chiapas", Species: "Ar", Origin: "07", Roast: "Me", Process: "Wa",
+		Altitude: &altitude, Variety: "Bourbon", Weight: &weight, Price: &price,
+	})
+	check(t, err)
+	if coffeeBag.ID == "" || coffeeBag.TastingNotes == nil {
+		t.Fatalf("the id must be set and the tasting notes must never be null, got %+v", coffeeBag)
+	}
+	stored, err := repo.GetCoffeeBagById(ctx, coffeeBag.ID)
+	check(t, err)
+	if stored.Species != "Ar" || stored.Origin != "07" || stored.Roast != "Me" || *stored.Altitude != 1200 || *stored.Price != 180.5 || stored.Version != 1 {
+		t.Fatalf("a single coffee bag must keep its codes, got %+v", stored)
+	}
+	if _, err = repo.GetCoffeeBagById(ctx, MISSING_ID); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing coffee bag, got %v", err)
+	}
+	coffeeBags, err := repo.GetCoffeeBags(ctx, models.CoffeeBagsList{Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	if len(coffeeBags) != 1 || coffeeBags[0].Species != "Arábiga" || coffeeBags[0].Origin != "Chiapas" || coffeeBags[0].Roast != "Media" {
+		t.Fatalf("listed coffee bags must show the names of their codes, got %+v", coffeeBags)
+	}
+
+	stored.Variety = "Typica"
+	stored.TastingNotes = []string{"cacao", "nuez"}
+	updated, err := repo.UpdateCoffeeBag(ctx, stored)
+	check(t, err)
+	if updated.Version != 2 {
+		t.Fatalf("the version of the request must be increased after an update, got %d", updated.Version)
+	}
+	stale := *stored
+	stale.Version = 1
+	if _, err = repo.UpdateCoffeeBag(ctx, &stale); err != models.ErrVersionMismatch {
+		t.Fatalf("expected models.ErrVersionMismatch, got %v", err)
+	}
+	missing := *stored
+	missing.ID = MISSING_ID
+	if _, err = repo.UpdateCoffeeBag(ctx, &missing); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing coffee bag, got %v", err)
+	}
+	stored, err = repo.GetCoffeeBagById(ctx, coffeeBag.ID)
+	check(t, err)
+	if stored.Variety != "Typica" || len(stored.TastingNotes) != 2 || stored.TastingNotes[1] != "nuez" {
+		t.Fatalf("unexpected coffee bag after the update %+v", stored)
+	}
+
+	expectError(t, repo.DeleteCoffeeBag(ctx, coffeeBag.ID, 1), models.ErrVersionMismatch)
+	check(t, repo.DeleteCoffeeBag(ctx, coffeeBag.ID, 2))
+	expectError(t, repo.DeleteCoffeeBag(ctx, coffeeBag.ID, 2), sql.ErrNoRows)
+}
+
+func testCoffeeBagFilters(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	cheap, expensive := 150.0, 320.0
+	veracruz := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Veracruz Natural", Species: "Ar", Origin: "30", Process: "Na", Price: &expensive})
+	chiapas := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Chiapas Lavado", Species: "Ar", Origin: "07", Process: "Wa", Price: &cheap})
+	robusta := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Robusta Oaxaca", Species: "Ro", Origin: "20"})
+	shop := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	check(t, repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: robusta, CoffeeShopId: shop}))
+
+	filters := []struct {
+		list     models.CoffeeBagsList
+		expected []string
+	}{
+		{models.CoffeeBagsList{}, []string{veracruz, chiapas, robusta}},
+		{models.CoffeeBagsList{Species: "Ar"}, []string{veracruz, chiapas}},
+		{models.CoffeeBagsList{Origin: "07"}, []string{chiapas}},
+		{models.CoffeeBagsList{Process: "Na"}, []string{veracruz}},
+		{models.CoffeeBagsList{Brand: "chia"}, []string{chiapas}},
+		// The brand is a prefix, not a substring
+		{models.CoffeeBagsList{Brand: "lavado"}, nil},
+		{models.CoffeeBagsList{Search: "oaxaca"}, []string{robusta}},
+		{models.CoffeeBagsList{Search: "natu"}, []string{veracruz}},
+		// Like wildcards are matched literally
+		{models.CoffeeBagsList{Brand: "%"}, nil},
+		{models.CoffeeBagsList{City: "guadalajara"}, []string{robusta}},
+		{models.CoffeeBagsList{City: "Monterrey"}, nil},
+		{models.CoffeeBagsList{Sort: "brand"}, []string{chiapas, robusta, veracruz}},
+		{models.CoffeeBagsList{Sort: "-brand"}, []string{veracruz, robusta, chiapas}},
+		// Coffee bags without a price always go last
+		{models.CoffeeBagsList{Sort: "price"}, []string{chiapas, veracruz, robusta}},
+		{models.CoffeeBagsList{Sort: "-price"}, []string{veracruz, chiapas, robusta}},
+		{models.CoffeeBagsList{Sort: "-id"}, []string{robusta, chiapas, veracruz}},
+		{models.CoffeeBagsList{Sort: "not a column"}, []string{veracruz, chiapas, robusta}},
+		{models.CoffeeBagsList{Pagination: models.Pagination{Page: 1, Size: 2}}, []string{robusta}},
+		{models.CoffeeBagsList{Pagination: models.Pagination{Page: 2, Size: 2}}, nil},
+	}
+	for _, filter := range filters {
+		if filter.list.Size == 0 {
+			filter.list.Size = 10
+		}
+		coffeeBags, err := repo.GetCoffeeBags(ctx, filter.list)
+		check(t, err)
+		var ids []string
+		for _, coffeeBag := range coffeeBags {
+			ids = append(ids, coffeeBag.ID)
+		}
+		if !equalIds(ids, filter.expected) {
+			t.Errorf("expected coffee bags %v for %+v, got %v", filter.expected, filter.list, ids)
+		}
+	}
+
+	// The city filter follows the coffee shops when they move
+	expectCoffeeBagsInCity := func(city string, expected ...string) {
+		t.Helper()
+		coffeeBags, err := repo.GetCoffeeBags(ctx, models.CoffeeBagsList{City: city, Pagination: models.Pagination{Size: 10}})
+		check(t, err)
+		var ids []string
+		for _, coffeeBag := range coffeeBags {
+			ids = append(ids, coffeeBag.ID)
+		}
+		if !equalIds(ids, expected) {
+			t.Errorf("expected coffee bags %v in %s, got %v", expected, city, ids)
+		}
+	}
+	coffeeShop, err := repo.GetCoffeeShopById(ctx, shop)
+	check(t, err)
+	coffeeShop.City = "Monterrey"
+	check(t, repo.UpdateCoffeeShop(ctx, coffeeShop))
+	expectCoffeeBagsInCity("Monterrey", robusta)
+	expectCoffeeBagsInCity("Guadalajara")
+	_, err = repo.ImportCoffeeShops(ctx, []*models.CoffeeShop{{Name: "Café", Address: "Av. Chapultepec 100", City: "Zapopan", Location: types.Point{20.67, -103.35}}}, 50, false)
+	check(t, err)
+	expectCoffeeBagsInCity("Zapopan", robusta)
+	expectCoffeeBagsInCity("Monterrey")
+}
+
+func testCoffeeBagAvailability(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	coffeeBag := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Finca Chiapas", Species: "Ar", Origin: "07"})
+	centre := createCoffeeShop(t, repo, "Café Centro", 20.670, -103.350)
+	zapopan := createCoffeeShop(t, repo, "Café Americana", 20.720, -103.400)
+	price, size := 210.0, 340
+	check(t, repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: centre, Price: &price, Size: &size, RoastDate: "2030-01-10"}))
+	check(t, repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: zapopan, StockStatus: "LS"}))
+	err := repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: centre})
+	if err == nil || err.Error() != "That coffee bag is already registered as a product of that coffee shop" {
+		t.Fatalf("expected the duplicated product error, got %v", err)
+	}
+	if err = repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: MISSING_ID, CoffeeShopId: centre}); err == nil {
+		t.Fatal("expected an error when registering a missing coffee bag")
+	}
+
+	coffeeBags, err := repo.GetCoffeeBagByCoffeeShop(ctx, &models.CoffeeBagByShopId{CoffeeShopId: centre, Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	if len(coffeeBags) != 1 || coffeeBags[0].ID != coffeeBag || coffeeBags[0].Species != "Arábiga" {
+		t.Fatalf("unexpected coffee bags of the coffee shop %+v", coffeeBags)
+	}
+	availability := coffeeBags[0].Availability
+	if availability == nil || *availability.Price != 210 || *availability.Size != 340 || availability.RoastDate != "2030-01-10" || availability.StockStatus != "En existencia" || availability.UpdatedAt.IsZero() {
+		t.Fatalf("products are in stock by default, got %+v", availability)
+	}
+	coffeeBags, err = repo.GetCoffeeBagByCoffeeShop(ctx, &models.CoffeeBagByShopId{CoffeeShopId: centre, Pagination: models.Pagination{Page: 1, Size: 10}})
+	check(t, err)
+	if len(coffeeBags) != 0 {
+		t.Fatalf("expected an empty page, got %+v", coffeeBags)
+	}
+
+	updated, err := repo.UpdateCoffeeBagAvailability(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: zapopan, StockStatus: "OS"})
+	check(t, err)
+	// The update returns the same display name as the reads
+	if updated.StockStatus != "Agotado" || updated.Price != nil || updated.CoffeeShopId != zapopan {
+		t.Fatalf("unexpected availability after the update %+v", updated)
+	}
+	updated, err = repo.UpdateCoffeeBagAvailability(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: zapopan})
+	check(t, err)
+	if updated.StockStatus != "En existencia" {
+		t.Fatalf("an empty stock status must reset it to in stock, got %+v", updated)
+	}
+	if _, err = repo.UpdateCoffeeBagAvailability(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: MISSING_ID}); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing product, got %v", err)
+	}
+
+	shops, err := repo.GetCoffeeShopsByCoffeeBag(ctx, &models.CoffeeShopsByCoffeeBagId{CoffeeBagId: coffeeBag, Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	expectShopIds(t, shops, zapopan, centre)
+	shops, err = repo.GetCoffeeShopsByCoffeeBag(ctx, &models.CoffeeShopsByCoffeeBagId{
+		CoffeeBagId: coffeeBag,
+		Coordinates: &models.UserCoordinates{Latitude: 20.671, Longitude: -103.350},
+		Pagination:  models.Pagination{Size: 10},
+	})
+	check(t, err)
+	expectShopIds(t, shops, centre, zapopan)
+	// 0.001 degrees of latitude are about 111 meters
+	if shops[0].Distance == nil || math.Abs(*shops[0].Distance-111.2) > 1 {
+		t.Fatalf("expected the distance to the coffee shop in meters, got %v", shops[0].Distance)
+	}
+	shops, err = repo.GetCoffeeShopsByCoffeeBag(ctx, &models.CoffeeShopsByCoffeeBagId{CoffeeBagId: coffeeBag, Pagination: models.Pagination{Page: 1, Size: 1}})
+	check(t, err)
+	expectShopIds(t, shops, centre)
+
+	check(t, repo.RemoveCoffeeBagFromCoffeeShop(ctx, coffeeBag, centre))
+	check(t, repo.RemoveCoffeeBagFromCoffeeShop(ctx, coffeeBag, centre))
+	shops, err = repo.GetCoffeeShopsByCoffeeBag(ctx, &models.CoffeeShopsByCoffeeBagId{CoffeeBagId: coffeeBag, Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	expectShopIds(t, shops, zapopan)
+}
+
+func testDeleteCoffeeShopCascades(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	user := registerUser(t, repo, "barista")
+	shop := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	coffeeBag := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Finca Chiapas", Species: "Ar", Origin: "07"})
+	check(t, repo.UpdateOpeningHours(ctx, &models.OpeningHours{CoffeeShopId: shop, Weekly: []models.OpeningInterval{{Weekday: 1, Opens: "08:00", Closes: "20:00"}}}))
+	_, err := repo.AddCoffeeShopPhoto(ctx, &models.ShopPhoto{CoffeeShopId: shop, Image: "photos/shop.jpg"})
+	check(t, err)
+	check(t, repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: user, ShopId: shop}))
+	check(t, repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: shop}))
+
+	check(t, repo.DeleteCoffeeShop(ctx, shop, 1))
+	hours, err := repo.GetOpeningHours(ctx, []string{shop})
+	check(t, err)
+	if len(hours[shop].Weekly) != 0 {
+		t.Fatalf("the opening hours must be deleted with the coffee shop, got %+v", hours[shop])
+	}
+	photos, err := repo.GetCoffeeShopPhotos(ctx, []string{shop})
+	check(t, err)
+	if len(photos[shop]) != 0 {
+		t.Fatalf("the photos must be deleted with the coffee shop, got %+v", photos[shop])
+	}
+	liked, err := repo.GetLikedCoffeeShops(ctx, &models.LikesByUserRequest{UserId: user, Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	expectShopCount(t, liked, 0)
+	shops, err := repo.GetCoffeeShopsByCoffeeBag(ctx, &models.CoffeeShopsByCoffeeBagId{CoffeeBagId: coffeeBag, Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	expectShopCount(t, shops, 0)
+	// The rest of the data is kept
+	if _, err = repo.GetCoffeeBagById(ctx, coffeeBag); err != nil {
+		t.Fatalf("the coffee bag must survive the coffee shop, got %v", err)
+	}
+	if _, err = repo.GetUserById(ctx, user); err != nil {
+		t.Fatalf("the user must survive the coffee shop, got %v", err)
+	}
+}
+
+func testDeleteCoffeeBagCascades(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	shop := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	coffeeBag := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Finca Chiapas", Species: "Ar", Origin: "07"})
+	check(t, repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: coffeeBag, CoffeeShopId: shop}))
+
+	check(t, repo.DeleteCoffeeBag(ctx, coffeeBag, 1))
+	coffeeBags, err := repo.GetCoffeeBagByCoffeeShop(ctx, &models.CoffeeBagByShopId{CoffeeShopId: shop, Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	if len(coffeeBags) != 0 {
+		t.Fatalf("the products must be deleted with the coffee bag, got %+v", coffeeBags)
+	}
+	if _, err = repo.GetCoffeeShopById(ctx, shop); err != nil {
+		t.Fatalf("the coffee shop must survive the coffee bag, got %v", err)
+	}
+}
+
+func testDeleteUserCascades(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	barista, roaster := registerUser(t, repo, "barista"), registerUser(t, repo, "roaster")
+	shop := createCoffeeShop(t, repo, "Café", 20.67, -103.35)
+	check(t, repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: barista, UserToId: roaster}))
+	check(t, repo.FollowUser(ctx, &models.FollowUnfollowRequest{UserFromId: roaster, UserToId: barista}))
+	check(t, repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{UserId: barista, ShopId: shop}))
+
+	check(t, repo.DeleteUser(ctx, barista, 1))
+	followers, err := repo.GetUserFollowers(ctx, roaster)
+	check(t, err)
+	expectUsernames(t, followers)
+	following, err := repo.GetUserFollowing(ctx, roaster)
+	check(t, err)
+	expectUsernames(t, following)
+	liked, err := repo.GetLikedCoffeeShops(ctx, &models.LikesByUserRequest{UserId: barista, Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	expectShopCount(t, liked, 0)
+	// The username and email are free again
+	registerUser(t, repo, "barista")
+	if _, err = repo.GetCoffeeShopById(ctx, shop); err != nil {
+		t.Fatalf("the coffee shop must survive the user, got %v", err)
+	}
+}
+
+func testCatalogStats(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	shopId := createCoffeeShop(t, repo, "Café Palermo", 20.67, -103.35)
+	_, err := repo.CreateCoffeeShop(ctx, &models.CoffeeShop{Name: "Tostador", Address: "Av. Juárez 200", City: "Zapopan", Roaster: true, Location: types.Point{20.72, -103.39}})
+	check(t, err)
+	bagId := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Finca", Species: "Ar", Origin: "07"})
+	check(t, repo.AddCoffeeBagToCoffeeShop(ctx, &models.CoffeeBagAvailability{CoffeeBagId: bagId, CoffeeShopId: shopId}))
+	registerUser(t, repo, "customer")
+	userId := registerUser(t, repo, "owner")
+	check(t, repo.SetUserStaff(ctx, "owner@example.com", true))
+	check(t, repo.LikeCoffeeShop(ctx, &models.LikeUnlikeCoffeeShopRequest{ShopId: shopId, UserId: userId}))
+
+	stats, err := repo.GetCatalogStats(ctx)
+	check(t, err)
+	expected := models.CatalogStats{CoffeeShops: 2, Cities: 2, Roasters: 1, CoffeeBags: 1, Availability: 1, Users: 2, StaffUsers: 1, Likes: 1}
+	if *stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *stats)
+	}
+}
+
+func testImportCoffeeShops(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	existing := createCoffeeShop(t, repo, "Café Palermo", 20.67, -103.35)
+	newShops := func() []*models.CoffeeShop {
+		return []*models.CoffeeShop{
+			// About 11 meters away, with a different case
+			{Name: "CAFÉ PALERMO", Address: "Av. Chapultepec 102", City: "Guadalajara", Rating: 4.8, Location: types.Point{20.6701, -103.35}},
+			// Same name, but about 1 km away
+			{Name: "Café Palermo", Address: "Av. Juárez 200", City: "Guadalajara", Location: types.Point{20.68, -103.35}},
+		}
+	}
+
+	actions, err := repo.ImportCoffeeShops(ctx, newShops(), 50, true)
+	check(t, err)
+	if len(actions) != 2 || actions[0] != models.IMPORT_UPDATED || actions[1] != models.IMPORT_CREATED {
+		t.Fatalf("expected the first coffee shop to be updated and the second one created, got %v", actions)
+	}
+	shops, err := repo.GetCoffeeShops(ctx, 0, 10, nil)
+	check(t, err)
+	expectShopIds(t, shops, existing)
+	if shops[0].Address != "Av. Chapultepec 100" || shops[0].Version != 1 {
+		t.Fatalf("a dry run must not change anything, got %+v", shops[0])
+	}
+
+	imported := newShops()
+	actions, err = repo.ImportCoffeeShops(ctx, imported, 50, false)
+	check(t, err)
+	if len(actions) != 2 || actions[0] != models.IMPORT_UPDATED || actions[1] != models.IMPORT_CREATED {
+		t.Fatalf("expected the first coffee shop to be updated and the second one created, got %v", actions)
+	}
+	if imported[0].ID != existing || imported[1].ID == "" || imported[1].ID == existing {
+		t.Fatalf("the ids of the imported coffee shops must be set, got %q and %q", imported[0].ID, imported[1].ID)
+	}
+	updated, err := repo.GetCoffeeShopById(ctx, existing)
+	check(t, err)
+	if updated.Name != "Café Palermo" || updated.Address != "Av. Chapultepec 102" || updated.Rating != 4.8 || updated.Version != 2 {
+		t.Fatalf("the matched coffee shop must be updated keeping its name, got %+v", updated)
+	}
+	shops, err = repo.GetCoffeeShops(ctx, 0, 10, nil)
+	check(t, err)
+	expectShopCount(t, shops, 2)
+}
+
+func testImportCoffeeBags(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	existing := createCoffeeBag(t, repo, &models.CoffeeBag{Brand: "Finca Chiapas", Species: "Ar", Origin: "07", Process: "Wa", Variety: "Bourbon"})
+	price := 210.0
+	newBags := func() []*models.CoffeeBag {
+		return []*models.CoffeeBag{
+			{Brand: "finca chiapas", Species: "Ar", Origin: "07", Process: "Wa", Variety: "BOURBON", Roast: "Da", TastingNotes: []string{"cacao"}, Price: &price},
+			// A different variety is another coffee bag
+			{Brand: "Finca Chiapas", Species: "Ar", Origin: "07", Process: "Wa", Variety: "Typica"},
+		}
+	}
+
+	actions, err := repo.ImportCoffeeBags(ctx, newBags(), true)
+	check(t, err)
+	if len(actions) != 2 || actions[0] != models.IMPORT_UPDATED || actions[1] != models.IMPORT_CREATED {
+		t.Fatalf("expected the first coffee bag to be updated and the second one created, got %v", actions)
+	}
+	coffeeBags, err := repo.GetCoffeeBags(ctx, models.CoffeeBagsList{Pagination: models.Pagination{Size: 10}})
+	check(t, err)
+	stored, err := repo.GetCoffeeBagById(ctx, existing)
+	check(t, err)
+	if len(coffeeBags) != 1 || stored.Price != nil || stored.Version != 1 {
+		t.Fatalf("a dry run must not change anything, got %d coffee bags and %+v", len(coffeeBags), stored)
+	}
+
+	imported := newBags()
+	actions, err = repo.ImportCoffeeBags(ctx, imported, false)
+	check(t, err)
+	if len(actions) != 2 || actions[0] != models.IMPORT_UPDATED || actions[1] != models.IMPORT_CREATED {
+		t.Fatalf("expected the first coffee bag to be updated and the second one created, got %v", actions)
+	}
+	if imported[0].ID != existing || imported[1].ID == "" || imported[1].ID == existing {
+		t.Fatalf("the ids of the imported coffee bags must be set, got %q and %q", imported[0].ID, imported[1].ID)
+	}
+	updated, err := repo.GetCoffeeBagById(ctx, existing)
+	check(t, err)
+	if updated.Brand != "Finca Chiapas" || updated.Roast != "Da" || updated.Price == nil || *updated.Price != 210 || len(updated.TastingNotes) != 1 || updated.Version != 2 {
+		t.Fatalf("the matched coffee bag must be updated keeping its brand, got %+v", updated)
+	}
+	created, err := repo.GetCoffeeBagById(ctx, imported[1].ID)
+	check(t, err)
+	if created.TastingNotes == nil || created.Version != 1 {
+		t.Fatalf("unexpected imported coffee bag %+v", created)
+	}
+}
+
+// Repositories are tested with every migration applied
+func testSchemaVersion(t *testing.T, repo repository.Repository) {
+	latest, err := migrations.Latest()
+	check(t, err)
+	schemaVersion, err := repo.SchemaVersion(context.Background())
+	check(t, err)
+	if schemaVersion.Version != latest || schemaVersion.Dirty {
+		t.Fatalf("expected the clean version %d, got %+v", latest, schemaVersion)
+	}
+}
+
+func createCoffeeShop(t *testing.T, repo repository.Repository, name string, latitude float64, longitude float64) string {
+	t.Helper()
+	id, err := repo.CreateCoffeeShop(context.Background(), &models.CoffeeShop{
+		Name: name, Address: "Av. Chapultepec 100", City: "Guadalajara", Rating: 4.5, Location: types.Point{latitude, longitude},
+	})
+	check(t, err)
+	return id
+}
+
+func createCoffeeBag(t *testing.T, repo repository.Repository, coffeeBag *models.CoffeeBag) string {
+	t.Helper()
+	created, err := repo.CreateCoffeeBag(context.Background(), coffeeBag)
+	check(t, err)
+	return created.ID
+}
+
+// Register an user with the email <username>@example.com and return its id
+func registerUser(t *testing.T, repo repository.Repository, username string) string {
+	t.Helper()
+	email := username + "@example.com"
+	check(t, repo.RegisterUser(context.Background(), &models.SignUpRequest{Username: username, Email: email, HashedPassword: "hashed-" + username}))
+	user, err := repo.GetUser(context.Background(), email)
+	check(t, err)
+	return user.Id
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectError(t *testing.T, err error, expected error) {
+	t.Helper()
+	if !errors.Is(err, expected) {
+		t.Fatalf("expected error %v, got %v", expected, err)
+	}
+}
+
+func expectShopIds(t *testing.T, shops []*models.CoffeeShop, expected ...string) {
+	t.Helper()
+	var ids []string
+	for _, shop := range shops {
+		ids = append(ids, shop.ID)
+	}
+	if !equalIds(ids, expected) {
+		t.Fatalf("expected coffee shops %v, got %v", expected, ids)
+	}
+}
+
+func expectShopCount(t *testing.T, shops []*models.CoffeeShop, expected int) {
+	t.Helper()
+	if len(shops) != expected {
+		t.Fatalf("expected %d coffee shops, got %d", expected, len(shops))
+	}
+}
+
+// The order of the users isn't part of the contract
+func expectUsernames(t *testing.T, users []*models.GetUserResponse, expected ...string) {
+	t.Helper()
+	found := make(map[string]bool)
+	for _, user := range users {
+		found[user.Username] = true
+	}
+	if len(users) != len(expected) {
+		t.Fatalf("expected users %v, got %d users", expected, len(users))
+	}
+	for _, username := range expected {
+		if !found[username] {
+			t.Fatalf("expected users %v, %s is missing", expected, username)
+		}
+	}
+}
+
+func equalIds(ids []string, expected []string) bool {
+	if len(ids) != len(expected) {
+		return false
+	}
+	for i := range ids {
+		if ids[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func near(value float64, expected float64) bool {
+	return math.Abs(value-expected) < 1e-6
+}
@@ -0,0 +1,131 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/handlers"
+	"github.com/EduardoZepeda/go-coffee-api/middleware"
+	modifiedHttpSwaggo "github.com/EduardoZepeda/go-coffee-api/modifiedswaggo"
+	"github.com/EduardoZepeda/go-coffee-api/storage"
+	"github.com/EduardoZepeda/go-coffee-api/tracing"
+	"github.com/gorilla/mux"
+)
+
+// Routes of the API, shared by the vercel handler and the tests
+func New(app *application.App) *mux.Router {
+	router := mux.NewRouter()
+	// Scraped by Prometheus. It's matched before the rest of the api, so the scrapes aren't rate limited or counted
+	metricsApi := router.Path("/api/v1/metrics").Subrouter()
+	use(metricsApi, middleware.RequestId(app), middleware.StaffOrMetricsToken(app))
+	metricsApi.Handle("", app.Metrics.Registry.Handler()).Methods(http.MethodGet)
+	api := router.PathPrefix("/api/v1").Subrouter()
+	// The span of the request is the parent of the spans of the middlewares and the handler
+	api.Use(middleware.Trace(app))
+	use(api, middleware.RequestId(app), middleware.LogRequests(app), middleware.CollectMetrics(app), middleware.RecoverFromPanic(app), middleware.CorsAllowAll(app), middleware.RateLimit(app))
+	// api.PathPrefix("/ws").Handler(handlers.HandleWebSockets(app))
+	api.PathPrefix("/swagger").Handler(modifiedHttpSwaggo.WrapHandler)
+	// Uploaded files are only served when they're kept in the local filesystem, from the path of MEDIA_URL
+	if localStorage, ok := app.Storage.(*storage.LocalStorage); ok {
+		if prefix := localStorage.Path(); strings.HasPrefix(prefix, "/api/v1/") {
+			api.PathPrefix(strings.TrimPrefix(prefix, "/api/v1")).Handler(localStorage.Handler(prefix)).Methods(http.MethodGet)
+		} else if prefix != "" {
+			router.PathPrefix(prefix).Handler(localStorage.Handler(prefix)).Methods(http.MethodGet)
+		}
+	}
+	api.PathPrefix("/healthcheck").Handler(handlers.Healtcheck(app)).Methods(http.MethodGet)
+	loginRegisterApi := api.PathPrefix("/").Subrouter()
+	use(loginRegisterApi, middleware.AuthenticatedOrReadOnly(app), middleware.ConditionalGet(app, middleware.PUBLIC_CACHE))
+	loginRegisterApi.HandleFunc("/login", handlers.LoginUser(app)).Methods(http.MethodPost)
+	loginRegisterApi.HandleFunc("/signup", handlers.RegisterUser(app)).Methods(http.MethodPost)
+	usersApi := api.PathPrefix("/users").Subrouter()
+	// Profiles can be read by anyone, but they include the email, so only the client can keep them
+	use(usersApi, middleware.AuthenticatedOrReadOnly(app), middleware.ConditionalGet(app, middleware.PRIVATE_CACHE))
+	usersApi.HandleFunc("/{id:[0-9]+}", handlers.GetUser(app)).Methods(http.MethodGet)
+	usersApi.HandleFunc("/{id:[0-9]+}", handlers.UpdateUser(app)).Methods(http.MethodPut)
+	usersApi.HandleFunc("/{id:[0-9]+}", handlers.PatchUser(app)).Methods(http.MethodPatch)
+	usersApi.HandleFunc("/{id:[0-9]+}", handlers.DeleteUser(app)).Methods(http.MethodDelete)
+	usersApi.HandleFunc("/{id:[0-9]+}/profile-picture", handlers.UpdateProfilePicture(app)).Methods(http.MethodPut)
+	usersApi.HandleFunc("/{id:[0-9]+}/profile-picture", handlers.DeleteProfilePicture(app)).Methods(http.MethodDelete)
+	followersAndLikes := api.PathPrefix("/").Subrouter()
+	// Likes and following are only available to authenticated users
+	use(followersAndLikes, middleware.AuthenticatedOnly(app), middleware.ConditionalGet(app, middleware.PRIVATE_CACHE))
+	followersAndLikes.HandleFunc("/following/{id:[0-9]+}", handlers.GetUserFollowingAccounts(app)).Methods(http.MethodGet)
+	followersAndLikes.HandleFunc("/following", handlers.FollowUser(app)).Methods(http.MethodPost)
+	followersAndLikes.HandleFunc("/following/{id:[0-9]+}", handlers.UnfollowUser(app)).Methods(http.MethodDelete)
+	followersAndLikes.HandleFunc("/followers/{id:[0-9]+}", handlers.GetUserFollowers(app)).Methods(http.MethodGet)
+	followersAndLikes.HandleFunc("/likes", handlers.LikeCoffeeShop(app)).Methods(http.MethodPost)
+	followersAndLikes.HandleFunc("/likes", handlers.GetLikedCoffeeShops(app)).Methods(http.MethodGet)
+	followersAndLikes.HandleFunc("/likes/{shop_id:[0-9]+}", handlers.UnlikeCoffeeShop(app)).Methods(http.MethodDelete)
+	// Coffee shops endpoints, this routes are protected, and only staff members can use unsafe methods
+	coffeeShopsApi := api.PathPrefix("/coffee-shops").Subrouter()
+	use(coffeeShopsApi, middleware.IsStaffOrReadOnly(app), middleware.ConditionalGet(app, middleware.PUBLIC_CACHE))
+	coffeeShopsApi.HandleFunc("", handlers.GetCoffeeShops(app)).Methods(http.MethodGet)
+	coffeeShopsApi.HandleFunc("", handlers.CreateCoffeeShop(app)).Methods(http.MethodPost)
+	coffeeShopsApi.HandleFunc("/clusters", handlers.GetCoffeeShopClusters(app)).Methods(http.MethodGet)
+	coffeeShopsApi.HandleFunc("/import", handlers.ImportCoffeeShops(app)).Methods(http.MethodPost)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}", handlers.GetCoffeeShopById(app)).Methods(http.MethodGet)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}", handlers.UpdateCoffeeShop(app)).Methods(http.MethodPut)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}", handlers.PatchCoffeeShop(app)).Methods(http.MethodPatch)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}", handlers.DeleteCoffeeShop(app)).Methods(http.MethodDelete)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/opening-hours", handlers.GetOpeningHours(app)).Methods(http.MethodGet)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/opening-hours", handlers.UpdateOpeningHours(app)).Methods(http.MethodPut)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/photos", handlers.AddCoffeeShopPhoto(app)).Methods(http.MethodPost)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/photos/{photo_id:[0-9]+}", handlers.DeleteCoffeeShopPhoto(app)).Methods(http.MethodDelete)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/coffee-bags", handlers.GetCoffeeBagByCoffeeShop(app)).Methods(http.MethodGet)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/coffee-bags/{coffee_bag_id:[0-9]+}", handlers.AddCoffeeBagToCoffeeShop(app)).Methods(http.MethodPost)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/coffee-bags/{coffee_bag_id:[0-9]+}", handlers.UpdateCoffeeBagAvailability(app)).Methods(http.MethodPut)
+	coffeeShopsApi.HandleFunc("/{id:[0-9]+}/coffee-bags/{coffee_bag_id:[0-9]+}", handlers.DeleteCoffeeBagFromCoffeeShop(app)).Methods(http.MethodDelete)
+
+	// Coffee bags endpoints, this routes are protected, and only staff members can use unsafe methods
+	coffeeBagsApi := api.PathPrefix("/coffee-bags").Subrouter()
+	use(coffeeBagsApi, middleware.IsStaffOrReadOnly(app), middleware.ConditionalGet(app, middleware.PUBLIC_CACHE))
+	coffeeBagsApi.HandleFunc("", handlers.CreateCoffeeBag(app)).Methods(http.MethodPost)
+	coffeeBagsApi.HandleFunc("", handlers.GetCoffeeBags(app)).Methods(http.MethodGet)
+	coffeeBagsApi.HandleFunc("/import", handlers.ImportCoffeeBags(app)).Methods(http.MethodPost)
+	coffeeBagsApi.HandleFunc("/{id:[0-9]+}", handlers.GetCoffeeBagById(app)).Methods(http.MethodGet)
+	coffeeBagsApi.HandleFunc("/{id:[0-9]+}", handlers.UpdateCoffeeBag(app)).Methods(http.MethodPut)
+	coffeeBagsApi.HandleFunc("/{id:[0-9]+}", handlers.PatchCoffeeBag(app)).Methods(http.MethodPatch)
+	coffeeBagsApi.HandleFunc("/{id:[0-9]+}", handlers.DeleteCoffeeBag(app)).Methods(http.MethodDelete)
+	coffeeBagsApi.HandleFunc("/{id:[0-9]+}/coffee-shops", handlers.GetCoffeeShopsByCoffeeBag(app)).Methods(http.MethodGet)
+
+	// Feed for user, only authenticated users can access it
+	feedApi := api.PathPrefix("/feed").Subrouter()
+	use(feedApi, middleware.AuthenticatedOnly(app), middleware.ConditionalGet(app, middleware.PRIVATE_CACHE))
+	feedApi.HandleFunc("", handlers.GetUserFeed(app)).Methods(http.MethodGet)
+	// The middlewares only run for matched routes, the rest are counted as a single route
+	router.NotFoundHandler = middleware.CollectMetrics(app)(http.NotFoundHandler())
+	// Every handler runs in a span named after it, like handlers.GetUserFeed
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if handler := route.GetHandler(); handler != nil {
+			route.Handler(tracing.Handler(funcName(handler), handler))
+		}
+		return nil
+	})
+	return router
+}
+
+// Add the middlewares to the router, each one in a span named after it, like middleware.AuthenticatedOnly
+func use(router *mux.Router, middlewares ...mux.MiddlewareFunc) {
+	for _, m := range middlewares {
+		router.Use(tracing.Middleware(funcName(m), m))
+	}
+}
+
+// Package and name of the function that built a handler or a middleware, without the path of the package or the
+// names of the closures, like handlers.GetUserFeed for handlers.GetUserFeed.func1
+func funcName(fn interface{}) string {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return value.Type().String()
+	}
+	name := runtime.FuncForPC(value.Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, ".func"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
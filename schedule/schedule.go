@@ -0,0 +1,159 @@
+package schedule
+
+import (
+	"sort"
+	"time"
+
+	// Embed the timezone database, serverless environments don't always include it
+	_ "time/tzdata"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+)
+
+const TIMEZONE string = "America/Mexico_City"
+const TIME_LAYOUT string = "15:04"
+const DATE_LAYOUT string = "2006-01-02"
+
+// Number of days searched when looking for the next opening or closing time
+const LOOKAHEAD_DAYS int = 14
+
+// Opening hours are always stored and evaluated in Mexico City's local time (America/Mexico_City)
+var Location *time.Location
+
+func init() {
+	var err error
+	Location, err = time.LoadLocation(TIMEZONE)
+	if err != nil {
+		panic(err)
+	}
+}
+
+type period struct {
+	start time.Time
+	end   time.Time
+}
+
+// Build a period from a date and two "15:04" strings. Periods whose closing time is lower or equal
+// than the opening time end the following day, e.g. 18:00 - 02:00
+func newPeriod(day time.Time, opens string, closes string) (period, bool) {
+	opensAt, err := time.Parse(TIME_LAYOUT, opens)
+	if err != nil {
+		return period{}, false
+	}
+	closesAt, err := time.Parse(TIME_LAYOUT, closes)
+	if err != nil {
+		return period{}, false
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), opensAt.Hour(), opensAt.Minute(), 0, 0, Location)
+	end := time.Date(day.Year(), day.Month(), day.Day(), closesAt.Hour(), closesAt.Minute(), 0, 0, Location)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return period{start: start, end: end}, true
+}
+
+// Special hours replace the weekly hours of the date they belong to
+func periodsOn(hours *models.OpeningHours, day time.Time) []period {
+	var periods []period
+	date := day.Format(DATE_LAYOUT)
+	hasSpecialHours := false
+	for _, special := range hours.Special {
+		if special.Date != date {
+			continue
+		}
+		hasSpecialHours = true
+		if special.Closed {
+			continue
+		}
+		if p, ok := newPeriod(day, special.Opens, special.Closes); ok {
+			periods = append(periods, p)
+		}
+	}
+	if hasSpecialHours {
+		return periods
+	}
+	for _, interval := range hours.Weekly {
+		if time.Weekday(interval.Weekday) != day.Weekday() {
+			continue
+		}
+		if p, ok := newPeriod(day, interval.Opens, interval.Closes); ok {
+			periods = append(periods, p)
+		}
+	}
+	return periods
+}
+
+// Sorted and merged periods from the day before t, to catch overnight hours, up to the lookahead limit
+func periodsAround(hours *models.OpeningHours, t time.Time) []period {
+	local := t.In(Location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, Location)
+	var periods []period
+	for i := -1; i <= LOOKAHEAD_DAYS; i++ {
+		periods = append(periods, periodsOn(hours, today.AddDate(0, 0, i))...)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].start.Before(periods[j].start)
+	})
+	var merged []period
+	for _, p := range periods {
+		last := len(merged) - 1
+		if last >= 0 && !p.start.After(merged[last].end) {
+			if p.end.After(merged[last].end) {
+				merged[last].end = p.end
+			}
+			continue
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// Status returns whether a shop is open at t and its next opening and closing times.
+// When the shop is open, nextClose is the end of the current period.
+func Status(hours *models.OpeningHours, t time.Time) (isOpen bool, nextOpen *time.Time, nextClose *time.Time) {
+	if hours == nil {
+		return false, nil, nil
+	}
+	for _, p := range periodsAround(hours, t) {
+		if p.end.Before(t) || p.end.Equal(t) {
+			continue
+		}
+		if !p.start.After(t) {
+			isOpen = true
+			end := p.end
+			nextClose = &end
+			continue
+		}
+		start, end := p.start, p.end
+		nextOpen = &start
+		if nextClose == nil {
+			nextClose = &end
+		}
+		break
+	}
+	return isOpen, nextOpen, nextClose
+}
+
+func IsOpen(hours *models.OpeningHours, t time.Time) bool {
+	isOpen, _, _ := Status(hours, t)
+	return isOpen
+}
+
+// LastChange returns the last time, up to t, when the shop opened or closed, which is when the status returned by
+// Status last changed. When the shop didn't open or close in the periods searched, the start of the search is
+// returned, which is later than the real change. Shops without opening hours never change
+func LastChange(hours *models.OpeningHours, t time.Time) time.Time {
+	if hours == nil {
+		return time.Time{}
+	}
+	local := t.In(Location)
+	lastChange := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, Location).AddDate(0, 0, -1)
+	for _, p := range periodsAround(hours, t) {
+		for _, change := range []time.Time{p.start, p.end} {
+			if !change.After(t) && change.After(lastChange) {
+				lastChange = change
+			}
+		}
+	}
+	return lastChange
+}
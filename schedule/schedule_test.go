@@ -0,0 +1,110 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+)
+
+func at(month time.Month, day int, hour int, minute int) time.Time {
+	return time.Date(2023, month, day, hour, minute, 0, 0, Location)
+}
+
+func TestStatus(t *testing.T) {
+	// March 1st of 2023 is a Wednesday
+	hours := &models.OpeningHours{
+		Weekly: []models.OpeningInterval{
+			{Weekday: 3, Opens: "08:00", Closes: "14:00"},
+			{Weekday: 3, Opens: "16:00", Closes: "20:00"},
+			{Weekday: 5, Opens: "20:00", Closes: "02:00"},
+		},
+		Special: []models.SpecialHours{
+			{Date: "2023-03-08", Closed: true},
+			{Date: "2023-03-15", Opens: "10:00", Closes: "12:00"},
+		},
+	}
+	tests := []struct {
+		name      string
+		t         time.Time
+		isOpen    bool
+		nextOpen  time.Time
+		nextClose time.Time
+	}{
+		{"open in the morning", at(3, 1, 9, 0), true, at(3, 1, 16, 0), at(3, 1, 14, 0)},
+		{"closed between two periods", at(3, 1, 15, 0), false, at(3, 1, 16, 0), at(3, 1, 20, 0)},
+		{"opens at the opening time", at(3, 1, 16, 0), true, at(3, 3, 20, 0), at(3, 1, 20, 0)},
+		{"closed at the closing time", at(3, 1, 20, 0), false, at(3, 3, 20, 0), at(3, 4, 2, 0)},
+		{"open after midnight", at(3, 4, 1, 0), true, at(3, 10, 20, 0), at(3, 4, 2, 0)},
+		{"closed on holidays", at(3, 8, 9, 0), false, at(3, 10, 20, 0), at(3, 11, 2, 0)},
+		{"special hours replace the weekly ones", at(3, 15, 9, 0), false, at(3, 15, 10, 0), at(3, 15, 12, 0)},
+		{"open in special hours", at(3, 15, 11, 0), true, at(3, 17, 20, 0), at(3, 15, 12, 0)},
+		{"in another timezone", time.Date(2023, 3, 1, 15, 0, 0, 0, time.UTC), true, at(3, 1, 16, 0), at(3, 1, 14, 0)},
+	}
+	for _, test := range tests {
+		isOpen, nextOpen, nextClose := Status(hours, test.t)
+		if isOpen != test.isOpen {
+			t.Errorf("%s: expected open to be %t, got %t", test.name, test.isOpen, isOpen)
+		}
+		if nextOpen == nil || !nextOpen.Equal(test.nextOpen) {
+			t.Errorf("%s: expected to open next at %s, got %v", test.name, test.nextOpen, nextOpen)
+		}
+		if nextClose == nil || !nextClose.Equal(test.nextClose) {
+			t.Errorf("%s: expected to close next at %s, got %v", test.name, test.nextClose, nextClose)
+		}
+	}
+}
+
+func TestStatusMergesContiguousPeriods(t *testing.T) {
+	hours := &models.OpeningHours{Weekly: []models.OpeningInterval{
+		{Weekday: 3, Opens: "08:00", Closes: "12:00"},
+		{Weekday: 3, Opens: "12:00", Closes: "18:00"},
+	}}
+	isOpen, nextOpen, nextClose := Status(hours, at(3, 1, 10, 0))
+	if !isOpen || nextClose == nil || !nextClose.Equal(at(3, 1, 18, 0)) {
+		t.Errorf("expected to be open until 18:00, got %t until %v", isOpen, nextClose)
+	}
+	if nextOpen == nil || !nextOpen.Equal(at(3, 8, 8, 0)) {
+		t.Errorf("expected to open next week, got %v", nextOpen)
+	}
+}
+
+func TestStatusWithoutOpeningHours(t *testing.T) {
+	for _, hours := range []*models.OpeningHours{nil, {}} {
+		isOpen, nextOpen, nextClose := Status(hours, at(3, 1, 10, 0))
+		if isOpen || nextOpen != nil || nextClose != nil {
+			t.Errorf("expected %+v to be always closed, got %t, %v and %v", hours, isOpen, nextOpen, nextClose)
+		}
+	}
+}
+
+func TestLastChange(t *testing.T) {
+	hours := &models.OpeningHours{
+		Weekly: []models.OpeningInterval{
+			{Weekday: 3, Opens: "08:00", Closes: "14:00"},
+			{Weekday: 5, Opens: "20:00", Closes: "02:00"},
+		},
+		Special: []models.SpecialHours{{Date: "2023-03-08", Closed: true}},
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"while open", at(3, 1, 9, 0), at(3, 1, 8, 0)},
+		{"at the opening time", at(3, 1, 8, 0), at(3, 1, 8, 0)},
+		{"after closing", at(3, 1, 15, 0), at(3, 1, 14, 0)},
+		{"after midnight", at(3, 4, 1, 0), at(3, 3, 20, 0)},
+		{"after an overnight period", at(3, 4, 9, 0), at(3, 4, 2, 0)},
+		// Nothing changed since the day before, its start is later than the real change
+		{"closed for days", at(3, 8, 9, 0), at(3, 7, 0, 0)},
+	}
+	for _, test := range tests {
+		if got := LastChange(hours, test.t); !got.Equal(test.want) {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+	if got := LastChange(nil, at(3, 1, 9, 0)); !got.IsZero() {
+		t.Errorf("expected shops without opening hours to never change, got %s", got)
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage saves uploaded files under a key, a slash separated relative path such as shops/1/photo.jpg.
+// Only the keys are stored in the database, URLs are generated by the storage backend.
+type Storage interface {
+	Save(ctx context.Context, key string, content io.Reader) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+var ErrInvalidKey = errors.New("Storage keys must be relative paths without parent directory references")
+
+var ErrDisabled = errors.New("Uploads are disabled")
+
+// LocalStorage keeps the files in a directory of the local filesystem
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStorage(root string, baseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{Root: root, BaseURL: strings.TrimSuffix(baseURL, "/") + "/"}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	cleanKey := path.Clean("/" + key)[1:]
+	if cleanKey == "" || cleanKey != key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleanKey)), nil
+}
+
+func (s *LocalStorage) Save(ctx context.Context, key string, content io.Reader) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, content); err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return err
+	}
+	return file.Close()
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return s.BaseURL + key
+}
+
+// Url path the files are served from, empty when they're served by another host
+func (s *LocalStorage) Path() string {
+	u, err := url.Parse(s.BaseURL)
+	if err != nil || u.Host != "" {
+		return ""
+	}
+	return u.Path
+}
+
+// Handler serves the stored files, prefix is the part of the url path that precedes the keys
+func (s *LocalStorage) Handler(prefix string) http.Handler {
+	return http.StripPrefix(prefix, http.FileServer(filesOnly{http.Dir(s.Root)}))
+}
+
+// Directories are reported as missing, so their content is never listed
+type filesOnly struct {
+	http.FileSystem
+}
+
+func (fs filesOnly) Open(name string) (http.File, error) {
+	file, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// DisabledStorage is used when no storage is available, like a read-only filesystem. Files can't be saved,
+// but the urls of the ones saved before still work
+type DisabledStorage struct {
+	BaseURL string
+}
+
+func (s DisabledStorage) Save(ctx context.Context, key string, content io.Reader) error {
+	return ErrDisabled
+}
+
+func (s DisabledStorage) Delete(ctx context.Context, key string) error {
+	return ErrDisabled
+}
+
+func (s DisabledStorage) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+}
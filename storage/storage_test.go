@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewLocalStorage(t.TempDir(), "/api/v1/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Save(ctx, "shops/1/photo.jpg", strings.NewReader("photo")); err != nil {
+		t.Fatal(err)
+	}
+	if url := s.URL("shops/1/photo.jpg"); url != "/api/v1/media/shops/1/photo.jpg" {
+		t.Errorf("expected the url to be under the base url, got %q", url)
+	}
+	for _, key := range []string{"", "../photo.jpg", "shops/../../photo.jpg", "/shops/1/photo.jpg"} {
+		if err = s.Save(ctx, key, strings.NewReader("photo")); err != ErrInvalidKey {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+	if err = s.Delete(ctx, "shops/1/photo.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(s.Root, "shops", "1", "photo.jpg")); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be deleted, got %v", err)
+	}
+	// Deleting a missing file isn't an error
+	if err = s.Delete(ctx, "shops/1/photo.jpg"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLocalStorageHandler(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "/api/v1/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Save(context.Background(), "shops/1/photo.jpg", strings.NewReader("photo")); err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler(s.Path())
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/media/shops/1/photo.jpg", http.StatusOK},
+		{"/api/v1/media/shops/1/missing.jpg", http.StatusNotFound},
+		// Directories aren't listed
+		{"/api/v1/media/", http.StatusNotFound},
+		{"/api/v1/media/shops/", http.StatusNotFound},
+		{"/api/v1/media/shops/1", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.path, test.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestLocalStoragePath(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/media/":                "/api/v1/media/",
+		"/media":                        "/media/",
+		"https://cdn.example.org/media": "",
+	}
+	for baseURL, path := range tests {
+		s, err := NewLocalStorage(t.TempDir(), baseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Path() != path {
+			t.Errorf("%s: expected the path %q, got %q", baseURL, path, s.Path())
+		}
+	}
+}
+
+func TestDisabledStorage(t *testing.T) {
+	s := DisabledStorage{BaseURL: "/api/v1/media"}
+	if err := s.Save(context.Background(), "shops/1/photo.jpg", strings.NewReader("photo")); err != ErrDisabled {
+		t.Errorf("expected ErrDisabled, got %v", err)
+	}
+	// The files saved before are still served by someone else
+	if url := s.URL("shops/1/photo.jpg"); url != "/api/v1/media/shops/1/photo.jpg" {
+		t.Errorf("expected the url to be under the base url, got %q", url)
+	}
+}
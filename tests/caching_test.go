@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	"github.com/EduardoZepeda/go-coffee-api/middleware"
+	"github.com/EduardoZepeda/go-coffee-api/router"
+)
+
+func TestConditionalGet(t *testing.T) {
+	app := newApp(t)
+	app.Config.RateLimit = config.RateLimitConfig{Requests: 100, Burst: 100}
+	handler := router.New(app)
+	serve := func(method string, path string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.RemoteAddr = CLIENT_ADDR
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	first := serve(http.MethodGet, "/api/v1/coffee-shops/1", nil, "")
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `"1-`) || lastModified == "" {
+		t.Fatalf("expected the coffee shop with a version ETag and Last-Modified, got %d with %q and %q", first.Code, etag, lastModified)
+	}
+	if cacheControl := first.Header().Get("Cache-Control"); cacheControl != middleware.PUBLIC_CACHE {
+		t.Errorf("expected the Cache-Control %q, got %q", middleware.PUBLIC_CACHE, cacheControl)
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := modified.Add(-time.Second).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"same ETag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"ETag in a list", map[string]string{"If-None-Match": `"1-0000000000000000", ` + etag}, http.StatusNotModified},
+		{"weak ETag", map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+		{"any ETag", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"other ETags", map[string]string{"If-None-Match": `"1-0000000000000000", "2"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": before}, http.StatusOK},
+		{"If-None-Match takes precedence", map[string]string{"If-None-Match": `"2"`, "If-Modified-Since": lastModified}, http.StatusOK},
+		{"both validators", map[string]string{"If-None-Match": etag, "If-Modified-Since": lastModified}, http.StatusNotModified},
+	}
+	for _, test := range tests {
+		w := serve(http.MethodGet, "/api/v1/coffee-shops/1", test.headers, "")
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, w.Code)
+			continue
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Errorf("%s: expected the ETag %s, got %q", test.name, etag, w.Header().Get("ETag"))
+		}
+		if test.status == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("Content-Type") != "") {
+			t.Errorf("%s: expected a 304 without body, got %q with the Content-Type %q", test.name, w.Body.String(), w.Header().Get("Content-Type"))
+		}
+		if test.status == http.StatusOK && w.Body.String() != first.Body.String() {
+			t.Errorf("%s: expected the coffee shop, got %s", test.name, w.Body.String())
+		}
+	}
+	// A write changes the ETag, the previous one no longer matches
+	patched := serve(http.MethodPatch, "/api/v1/coffee-shops/1", map[string]string{"Authorization": bearerToken(t, app, "1", true), "If-Match": etag}, `{"rating": 5}`)
+	if patched.Code != http.StatusOK {
+		t.Fatalf("expected the patch to succeed, got %d: %s", patched.Code, patched.Body.String())
+	}
+	w := serve(http.MethodGet, "/api/v1/coffee-shops/1", map[string]string{"If-None-Match": etag}, "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("ETag"), `"2-`) {
+		t.Errorf("expected the patched coffee shop with a new ETag, got %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+	// Users are cached only by the client
+	w = serve(http.MethodGet, "/api/v1/users/2", nil, "")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != middleware.PRIVATE_CACHE || w.Header().Get("Vary") != "Authorization" {
+		t.Errorf("expected the user with the Cache-Control %q, got %d with %q and Vary %q", middleware.PRIVATE_CACHE, w.Code, w.Header().Get("Cache-Control"), w.Header().Get("Vary"))
+	}
+}
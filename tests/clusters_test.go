@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/handlers"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+)
+
+func TestCoffeeShopClusters(t *testing.T) {
+	handler := handlers.GetCoffeeShopClusters(newApp(t))
+	get := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/coffee-shops/clusters?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	// Every coffee shop of the app is in the same place, in Guadalajara
+	w := get("bbox=-104,20,-103,21&zoom=3")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var clusters []models.CoffeeShopCluster
+	if err := json.Unmarshal(w.Body.Bytes(), &clusters); err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || clusters[0].Count != 20 {
+		t.Fatalf("expected a cluster with the 20 coffee shops, got %+v", clusters)
+	}
+	cluster := clusters[0]
+	if cluster.MinLatitude != 20.67 || cluster.MaxLatitude != 20.67 || cluster.MinLongitude != -103.35 || cluster.MaxLongitude != -103.35 {
+		t.Errorf("expected the bounding box of the cluster to be the location of the coffee shops, got %+v", cluster.BoundingBox)
+	}
+	if w = get("bbox=-100,20,-99,21&zoom=3"); w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("expected an empty list outside of Guadalajara, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, query := range []string{"zoom=3", "bbox=-104,20,-103,21", "bbox=-104,20,-103,21&zoom=23", "bbox=-103,20,-104,21&zoom=3"} {
+		if w = get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
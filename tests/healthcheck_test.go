@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/handlers"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+)
+
+// Counts the reads of the schema version, failing the first one
+type schemaVersionRepository struct {
+	repository.Repository
+	reads int
+}
+
+func (repo *schemaVersionRepository) SchemaVersion(ctx context.Context) (*models.SchemaVersion, error) {
+	repo.reads++
+	if repo.reads == 1 {
+		return nil, errors.New("connection refused")
+	}
+	return &models.SchemaVersion{Version: 16}, nil
+}
+
+func TestHealthcheckCachesTheSchemaVersion(t *testing.T) {
+	app := newApp(t)
+	repo := &schemaVersionRepository{Repository: app.Repo}
+	app.Repo = repo
+	healthcheck := handlers.Healtcheck(app)
+	for i, expected := range []uint{0, 16, 16, 16} {
+		w := httptest.NewRecorder()
+		healthcheck(w, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var response models.HealtcheckResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		// The server stays up when the database can't be read
+		if expected == 0 && response.Schema != nil {
+			t.Errorf("request %d: expected no schema after a failed read, got %+v", i, response.Schema)
+		}
+		if expected != 0 && (response.Schema == nil || response.Schema.Version != expected) {
+			t.Errorf("request %d: expected schema version %d, got %+v", i, expected, response.Schema)
+		}
+	}
+	// The failed read isn't kept, the first successful one is reused
+	if repo.reads != 2 {
+		t.Errorf("expected the schema version to be read twice, got %d reads", repo.reads)
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/handlers"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/gorilla/mux"
+)
+
+func TestImport(t *testing.T) {
+	app := newApp(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/coffee-shops/import", handlers.ImportCoffeeShops(app)).Methods(http.MethodPost)
+	router.HandleFunc("/coffee-bags/import", handlers.ImportCoffeeBags(app)).Methods(http.MethodPost)
+	shopsCsv := "name,address,latitude,longitude,city\n" +
+		"Café 1,Av. Chapultepec 102,20.67,-103.35,Guadalajara\n" +
+		"Café Palermo,Av. Vallarta 1500,20.674,-103.37,Guadalajara\n" +
+		"Café Roto,Calle 1,,-103.37,Guadalajara\n"
+	geoJSON := `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-103.38, 20.68]}, "properties": {"name": "Café Colomos", "address": "Av. Patria 100"}}]}`
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		report      *models.ImportReport
+		error       string
+	}{
+		{"without format", "/coffee-shops/import", "", shopsCsv, http.StatusBadRequest, nil, "Send the file as text/csv, application/geo+json or application/json, or set the format query parameter"},
+		{"unknown format", "/coffee-shops/import?format=xml", "text/csv", shopsCsv, http.StatusBadRequest, nil, "format must be csv, geojson or json"},
+		{"invalid radius", "/coffee-shops/import?radius=5000", "text/csv", shopsCsv, http.StatusBadRequest, nil, ""},
+		{"invalid file", "/coffee-shops/import", "text/csv; charset=utf-8", "name,city\n", http.StatusBadRequest, nil, "invalid file: missing column \"address\", missing column \"latitude\", missing column \"longitude\""},
+		{"dry run", "/coffee-shops/import?dry_run=true", "application/geo+json", geoJSON, http.StatusOK, &models.ImportReport{DryRun: true, Rows: 1, Created: 1}, ""},
+		{"csv", "/coffee-shops/import", "text/csv", shopsCsv, http.StatusOK, &models.ImportReport{Rows: 3, Created: 1, Updated: 1, Failed: 1}, ""},
+		{"format parameter", "/coffee-shops/import?format=csv&batch_size=1", "application/octet-stream", shopsCsv, http.StatusOK, &models.ImportReport{Rows: 3, Updated: 2, Failed: 1}, ""},
+		{"unreadable file", "/coffee-shops/import", "text/csv", "name,address,latitude,longitude\nCafé,\"Juárez,1,2\n", http.StatusBadRequest, &models.ImportReport{Aborted: true}, ""},
+		{"bags as GeoJSON", "/coffee-bags/import", "application/geo+json", geoJSON, http.StatusBadRequest, nil, "invalid file: coffee bags don't have a location, use csv or json"},
+		{"bags", "/coffee-bags/import", "application/json", `[{"brand": "Café Chiapas", "species": "Ar", "origin": "07"}]`, http.StatusOK, &models.ImportReport{Rows: 1, Created: 1}, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if test.report != nil {
+			var report models.ImportReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if report.DryRun != test.report.DryRun || report.Aborted != test.report.Aborted || report.Rows != test.report.Rows || report.Created != test.report.Created || report.Updated != test.report.Updated || report.Failed != test.report.Failed {
+				t.Errorf("%s: expected %+v, got %+v", test.name, *test.report, report)
+			}
+			continue
+		}
+		var apiError types.ApiError
+		if err := json.NewDecoder(w.Body).Decode(&apiError); err != nil {
+			t.Fatal(err)
+		}
+		if apiError.Message != test.error {
+			t.Errorf("%s: expected the error %q, got %q", test.name, test.error, apiError.Message)
+		}
+		// Invalid options are reported by field
+		if test.error == "" && (apiError.Errors == nil || (*apiError.Errors)["radius"] == "") {
+			t.Errorf("%s: expected the radius error, got %+v", test.name, apiError)
+		}
+	}
+}
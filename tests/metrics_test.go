@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/router"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestMetricsNeedStaffOrTheMetricsToken(t *testing.T) {
+	app := newApp(t)
+	app.Config.MetricsToken = "scraper-token"
+	handler := router.New(app)
+	sign := func(isStaff bool) string {
+		claims := models.AppClaims{UserId: "1", IsStaff: isStaff, StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(app.Config.JWTSecret.Value()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	get := func(path string, authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = CLIENT_ADDR
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	// Paths that don't match a route share a single series
+	get("/api/v1/wp-login.php", "")
+	get("/api/v1/coffee-shops/1", "")
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"without a token", "", http.StatusUnauthorized},
+		{"wrong metrics token", "Bearer other-token", http.StatusUnauthorized},
+		{"not staff", sign(false), http.StatusUnauthorized},
+		{"staff", sign(true), http.StatusOK},
+		{"metrics token", "Bearer scraper-token", http.StatusOK},
+	}
+	for _, test := range tests {
+		w := get("/api/v1/metrics", test.authorization)
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, w.Code)
+		}
+	}
+	body := get("/api/v1/metrics", "Bearer scraper-token").Body.String()
+	if !strings.Contains(body, `route="unmatched"`) || strings.Contains(body, "wp-login.php") {
+		t.Errorf("expected the unmatched paths to be counted as one route, got\n%s", body)
+	}
+	if !strings.Contains(body, `route="/api/v1/coffee-shops/{id:[0-9]+}"`) {
+		t.Errorf("expected the matched routes to be counted by template, got\n%s", body)
+	}
+	// The scrapes aren't counted, nor the unauthorized attempts
+	if strings.Contains(body, "/api/v1/metrics") {
+		t.Errorf("expected the metrics route not to be counted, got\n%s", body)
+	}
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/handlers"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/gorilla/mux"
+)
+
+func TestOpeningHours(t *testing.T) {
+	app := newApp(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/coffee-shops", handlers.GetCoffeeShops(app))
+	router.HandleFunc("/coffee-shops/{id:[0-9]+}", handlers.GetCoffeeShopById(app))
+	router.HandleFunc("/coffee-shops/{id:[0-9]+}/opening-hours", handlers.GetOpeningHours(app))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	if w := get("/coffee-shops/1/opening-hours"); w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := get("/coffee-shops/1000/opening-hours"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing coffee shop, got %d: %s", w.Code, w.Body.String())
+	}
+	// Only detail responses include the schedule, even when the list has a single coffee shop
+	var coffeeShops []models.CoffeeShop
+	w := get("/coffee-shops?size=1")
+	if err := json.Unmarshal(w.Body.Bytes(), &coffeeShops); err != nil {
+		t.Fatal(err)
+	}
+	if len(coffeeShops) != 1 || coffeeShops[0].OpeningHours != nil {
+		t.Errorf("expected a coffee shop without opening hours, got %s", w.Body.String())
+	}
+	var coffeeShop models.CoffeeShop
+	w = get("/coffee-shops/1")
+	if err := json.Unmarshal(w.Body.Bytes(), &coffeeShop); err != nil {
+		t.Fatal(err)
+	}
+	if coffeeShop.OpeningHours == nil {
+		t.Errorf("expected the coffee shop with its opening hours, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/handlers"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/gorilla/mux"
+)
+
+func TestMergePatchCoffeeShop(t *testing.T) {
+	app := newApp(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/coffee-shops/{id:[0-9]+}", handlers.PatchCoffeeShop(app)).Methods(http.MethodPatch)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		error       string
+	}{
+		{"unknown field", "application/merge-patch+json", `{"rating": 5, "owner": "Anya"}`, http.StatusBadRequest, handlers.ErrInvalidMergePatch.Error()},
+		{"not an object", "application/merge-patch+json", `[{"rating": 5}]`, http.StatusBadRequest, handlers.ErrInvalidMergePatch.Error()},
+		{"invalid json", "application/merge-patch+json", `{"rating": }`, http.StatusBadRequest, handlers.ErrInvalidMergePatch.Error()},
+		{"wrong content type", "text/plain", `{"rating": 5}`, http.StatusBadRequest, "Content-Type must be application/merge-patch+json or application/json"},
+		{"removed required field", "application/merge-patch+json", `{"name": null}`, http.StatusBadRequest, ""},
+		{"one field", "application/merge-patch+json", `{"rating": 5}`, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/coffee-shops/1", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		r.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if test.status == http.StatusOK {
+			continue
+		}
+		var apiError types.ApiError
+		if err := json.NewDecoder(w.Body).Decode(&apiError); err != nil {
+			t.Fatal(err)
+		}
+		if apiError.Message != test.error {
+			t.Errorf("%s: expected the error %q, got %q", test.name, test.error, apiError.Message)
+		}
+	}
+	// Only the patched field changes in the stored row, and the rejected patches didn't write anything
+	shop, err := app.Repo.GetCoffeeShopById(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := models.CoffeeShop{Name: "Café 1", Address: "Av. Chapultepec 100", City: "Guadalajara", Location: types.Point{20.67, -103.35}, Rating: 5, Version: 2}
+	if shop.Name != expected.Name || shop.Address != expected.Address || shop.City != expected.City || shop.Roaster || shop.Location != expected.Location || shop.Rating != expected.Rating || shop.Version != expected.Version {
+		t.Errorf("expected the stored coffee shop %+v, got %+v", expected, *shop)
+	}
+}
@@ -0,0 +1,385 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/config"
+	"github.com/EduardoZepeda/go-coffee-api/database"
+	"github.com/EduardoZepeda/go-coffee-api/logging"
+	"github.com/EduardoZepeda/go-coffee-api/metrics"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/router"
+	"github.com/EduardoZepeda/go-coffee-api/storage"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/EduardoZepeda/go-coffee-api/utils"
+)
+
+const COLLECTION = "goCoffeeAPI.postman_collection.json"
+
+// Address of the client sending the requests, from the range reserved for documentation
+const CLIENT_ADDR = "192.0.2.1:1234"
+
+// Only the parts of a Postman v2.1 collection used by the runner
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item"`
+	Event   []postmanEvent  `json:"event"`
+	Request *postmanRequest `json:"request"`
+}
+
+type postmanEvent struct {
+	Listen string `json:"listen"`
+	Script struct {
+		Exec []string `json:"exec"`
+	} `json:"script"`
+}
+
+type postmanRequest struct {
+	Method string `json:"method"`
+	Header []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"header"`
+	Body *struct {
+		Raw string `json:"raw"`
+	} `json:"body"`
+	URL postmanURL `json:"url"`
+}
+
+// Postman exports the url either as a string or as an object with the raw url
+type postmanURL string
+
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*u = postmanURL(raw)
+		return nil
+	}
+	var object struct {
+		Raw string `json:"raw"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	*u = postmanURL(object.Raw)
+	return nil
+}
+
+type postmanCollection struct {
+	Item     []postmanItem `json:"item"`
+	Variable []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"variable"`
+}
+
+// The test scripts are javascript, only the assertions used by the collection are understood. Any other line that
+// asserts something or sets a variable fails the test, so a new assertion is never ignored silently
+var (
+	statusAssertion   = regexp.MustCompile(`pm\.response\.to\.have\.status\((\d+)\)`)
+	oneOfAssertion    = regexp.MustCompile(`pm\.expect\(pm\.response\.code\)\.to\.be\.oneOf\(\[([\d,\s]+)\]\)`)
+	includeAssertion  = regexp.MustCompile(`pm\.expect\(pm\.response\.text\(\)\)\.to\.include\("([^"]*)"\)`)
+	eqlAssertion      = regexp.MustCompile(`pm\.expect\(jsonData\.(\w+)\)\.to\.eql\((.+)\)`)
+	jsonVariable      = regexp.MustCompile(`pm\.collectionVariables\.set\("(\w+)", (?:"([^"]*)" \+ )?jsonData\.(\w+)\)`)
+	headerVariable    = regexp.MustCompile(`pm\.collectionVariables\.set\("(\w+)", pm\.response\.headers\.get\("([\w-]+)"\)\)`)
+	schemaVariable    = regexp.MustCompile(`^\s*var (\w+) = ({.*});?\s*$`)
+	schemaAssertion   = regexp.MustCompile(`pm\.response\.to\.have\.jsonSchema\((\w+)\)`)
+	scriptStatement   = regexp.MustCompile(`pm\.expect|pm\.response\.to|collectionVariables\.set`)
+	variableReference = regexp.MustCompile(`{{([^{}]+)}}`)
+)
+
+// Runs every request of the Postman collection, in order, against the router with an in-memory repository
+func TestPostmanCollection(t *testing.T) {
+	file, err := os.ReadFile(COLLECTION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var collection postmanCollection
+	if err = json.Unmarshal(file, &collection); err != nil {
+		t.Fatal(err)
+	}
+	variables := make(map[string]string)
+	for _, variable := range collection.Variable {
+		variables[variable.Key] = variable.Value
+	}
+	app := newApp(t)
+	// The collection is sent by a single client, faster than the default limit allows. It's still rate limited
+	app.Config.RateLimit = config.RateLimitConfig{Requests: 100, Burst: 100}
+	handler := router.New(app)
+	requests := 0
+	var run func(items []postmanItem, prefix string)
+	run = func(items []postmanItem, prefix string) {
+		for _, item := range items {
+			if item.Request == nil {
+				run(item.Item, prefix+item.Name+"/")
+				continue
+			}
+			requests++
+			name := prefix + item.Name
+			response := send(t, handler, item.Request, variables, CLIENT_ADDR)
+			// The schemas are local variables of the test script
+			schemas := make(map[string]map[string]interface{})
+			for _, event := range item.Event {
+				if event.Listen == "test" {
+					for _, line := range event.Script.Exec {
+						if err := evaluate(line, response, variables, schemas); err != nil {
+							t.Errorf("%s: %v", name, err)
+						}
+					}
+				}
+			}
+			// Requests without assertions must still be handled
+			if response.Code >= http.StatusInternalServerError {
+				t.Errorf("%s: unexpected status %d: %s", name, response.Code, response.Body.String())
+			}
+		}
+	}
+	run(collection.Item, "")
+	if requests == 0 {
+		t.Fatal("the collection doesn't have any request")
+	}
+}
+
+func send(t *testing.T, handler http.Handler, request *postmanRequest, variables map[string]string, remoteAddr string) *httptest.ResponseRecorder {
+	t.Helper()
+	requestURL, err := url.Parse(substitute(string(request.URL), variables))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body io.Reader
+	if request.Body != nil {
+		body = strings.NewReader(substitute(request.Body.Raw, variables))
+	}
+	// Only the path and the query are kept, the host of the collection is the local server
+	r := httptest.NewRequest(request.Method, requestURL.RequestURI(), body)
+	r.RemoteAddr = remoteAddr
+	for _, header := range request.Header {
+		r.Header.Set(header.Key, substitute(header.Value, variables))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// Replace {{name}} with the value of the variable, unknown variables are left as they are, like Postman does
+func substitute(text string, variables map[string]string) string {
+	return variableReference.ReplaceAllStringFunc(text, func(reference string) string {
+		if value, ok := variables[strings.Trim(reference, "{}")]; ok {
+			return value
+		}
+		return reference
+	})
+}
+
+func evaluate(line string, response *httptest.ResponseRecorder, variables map[string]string, schemas map[string]map[string]interface{}) error {
+	if match := statusAssertion.FindStringSubmatch(line); match != nil {
+		if strconv.Itoa(response.Code) != match[1] {
+			return fmt.Errorf("expected status %s, got %d: %s", match[1], response.Code, response.Body.String())
+		}
+		return nil
+	}
+	if match := oneOfAssertion.FindStringSubmatch(line); match != nil {
+		for _, status := range strings.Split(match[1], ",") {
+			if strings.TrimSpace(status) == strconv.Itoa(response.Code) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of the statuses %s, got %d: %s", match[1], response.Code, response.Body.String())
+	}
+	if match := includeAssertion.FindStringSubmatch(line); match != nil {
+		if !strings.Contains(response.Body.String(), match[1]) {
+			return fmt.Errorf("expected the body to include %q, got %s", match[1], response.Body.String())
+		}
+		return nil
+	}
+	if match := eqlAssertion.FindStringSubmatch(line); match != nil {
+		var expected interface{}
+		if err := json.Unmarshal([]byte(match[2]), &expected); err != nil {
+			return fmt.Errorf("unsupported value in %q", strings.TrimSpace(line))
+		}
+		value, err := jsonField(response, match[1])
+		if err != nil {
+			return err
+		}
+		if fmt.Sprint(value) != fmt.Sprint(expected) {
+			return fmt.Errorf("expected %s to be %v, got %v", match[1], expected, value)
+		}
+		return nil
+	}
+	if match := jsonVariable.FindStringSubmatch(line); match != nil {
+		value, err := jsonField(response, match[3])
+		if err != nil {
+			return err
+		}
+		variables[match[1]] = match[2] + fmt.Sprint(value)
+		return nil
+	}
+	if match := headerVariable.FindStringSubmatch(line); match != nil {
+		variables[match[1]] = response.Header().Get(match[2])
+		return nil
+	}
+	if match := schemaVariable.FindStringSubmatch(line); match != nil {
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(match[2]), &schema); err != nil {
+			return fmt.Errorf("the schema %s must be written as json in a single line: %v", match[1], err)
+		}
+		schemas[match[1]] = schema
+		return nil
+	}
+	if match := schemaAssertion.FindStringSubmatch(line); match != nil {
+		schema, ok := schemas[match[1]]
+		if !ok {
+			return fmt.Errorf("unknown schema %s", match[1])
+		}
+		var body interface{}
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+			return fmt.Errorf("the body isn't valid json: %s", response.Body.String())
+		}
+		if err := matchSchema(schema, body, "body"); err != nil {
+			return fmt.Errorf("%v: %s", err, response.Body.String())
+		}
+		return nil
+	}
+	if scriptStatement.MatchString(line) {
+		return fmt.Errorf("unsupported statement %q", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// Read a field of the json object in the body, length is the number of elements of an array like in javascript
+func jsonField(response *httptest.ResponseRecorder, field string) (interface{}, error) {
+	var body interface{}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		return nil, fmt.Errorf("the body isn't valid json: %s", response.Body.String())
+	}
+	switch value := body.(type) {
+	case []interface{}:
+		if field == "length" {
+			return float64(len(value)), nil
+		}
+	case map[string]interface{}:
+		if fieldValue, ok := value[field]; ok {
+			return fieldValue, nil
+		}
+	}
+	return nil, fmt.Errorf("the body doesn't have a %s field: %s", field, response.Body.String())
+}
+
+// Check a json value against the subset of JSON Schema used by the collection: type, required, properties and items
+func matchSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if expected, ok := schema["type"].(string); ok && jsonType(value) != expected {
+		// Every json number is a float64, integers are numbers without a fractional part
+		if !(expected == "number" && jsonType(value) == "integer") {
+			return fmt.Errorf("expected %s to be of type %s, got %s", path, expected, jsonType(value))
+		}
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, field := range required {
+				if _, ok := value[fmt.Sprint(field)]; !ok {
+					return fmt.Errorf("expected %s to have the field %v", path, field)
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for field, fieldSchema := range properties {
+			fieldValue, ok := value[field]
+			if !ok {
+				continue
+			}
+			if err := matchSchema(fieldSchema.(map[string]interface{}), fieldValue, path+"."+field); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				if err := matchSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// The users and coffee shops the collection expects: a staff user with id 1, a regular user, the users 3, 6 and 31
+// and more than a page of coffee shops, including the coffee shop 14
+func newApp(t *testing.T) *application.App {
+	t.Helper()
+	ctx := context.Background()
+	repo := database.NewMemoryRepository()
+	users := []models.SignUpRequest{
+		{Username: "admin", Email: "admin@example.org", Password: "Stalker88"},
+		{Username: "Anya", Email: "anya_waku_waku@hotmail.com", Password: "WakuWaku"},
+	}
+	for i := len(users) + 1; i <= 31; i++ {
+		users = append(users, models.SignUpRequest{Username: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.org", i), Password: "password"})
+	}
+	for _, user := range users {
+		hashedPassword, err := utils.GenerateDjangoHashedPassword(user.Password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.HashedPassword = hashedPassword
+		if err = repo.RegisterUser(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 20; i++ {
+		shop := &models.CoffeeShop{Name: fmt.Sprintf("Café %d", i), Address: "Av. Chapultepec 100", City: "Guadalajara", Rating: 4.5, Location: types.Point{20.67, -103.35}}
+		if _, err := repo.CreateCoffeeShop(ctx, shop); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Users can't be made staff through the API
+	if err := repo.SetUserStaff(ctx, "admin@example.org", true); err != nil {
+		t.Fatal(err)
+	}
+	mediaStorage, err := storage.NewLocalStorage(t.TempDir(), "/api/v1/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.JWTSecret = "postman-collection-secret"
+	return &application.App{
+		Config:  cfg,
+		Repo:    repo,
+		Logger:  logging.New(io.Discard, logging.LEVEL_ERROR),
+		Storage: mediaStorage,
+		Metrics: metrics.New(),
+	}
+}
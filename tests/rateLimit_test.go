@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/router"
+)
+
+func TestRateLimit(t *testing.T) {
+	app := newApp(t)
+	handler := router.New(app)
+	get := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/coffee-shops", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < app.Config.RateLimit.Burst; i++ {
+		if status := get(CLIENT_ADDR); status != http.StatusOK {
+			t.Fatalf("expected the request %d to be allowed, got status %d", i+1, status)
+		}
+	}
+	if status := get(CLIENT_ADDR); status != http.StatusTooManyRequests {
+		t.Errorf("expected the requests above the burst to be limited, got status %d", status)
+	}
+	// Other clients have their own limit
+	if status := get("192.0.2.2:1234"); status != http.StatusOK {
+		t.Errorf("expected another client to be allowed, got status %d", status)
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/router"
+	"github.com/EduardoZepeda/go-coffee-api/tracing"
+)
+
+// A request makes a span for itself, every middleware, the handler and the response, in the trace of its traceparent
+func TestRequestsAreTraced(t *testing.T) {
+	previous := tracing.GetExporter()
+	exporter := tracing.NewMemoryExporter()
+	tracing.SetExporter(exporter)
+	t.Cleanup(func() { tracing.SetExporter(previous) })
+	handler := router.New(newApp(t))
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/coffee-shops", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set(tracing.TRACEPARENT_HEADER, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	spans := make(map[string]tracing.SpanData)
+	for _, span := range exporter.Spans() {
+		if span.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected every span to be part of the trace of the traceparent, got %+v", span)
+		}
+		spans[span.Name] = span
+	}
+	// Each span is the parent of the next one
+	parents := []string{
+		"GET /api/v1/coffee-shops",
+		"middleware.RequestId",
+		"middleware.LogRequests",
+		"middleware.CollectMetrics",
+		"middleware.RecoverFromPanic",
+		"middleware.CorsAllowAll",
+		"middleware.RateLimit",
+		"middleware.IsStaffOrReadOnly",
+		"middleware.ConditionalGet",
+		"handlers.GetCoffeeShops",
+		"application.Respond",
+	}
+	if server := spans[parents[0]]; server.ParentId != "00f067aa0ba902b7" || server.Attributes["http.route"] != "/api/v1/coffee-shops" {
+		t.Errorf("expected the request span to continue the trace of the traceparent, got %+v", server)
+	}
+	// The response points to the request span, and browsers can read it
+	if expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + spans[parents[0]].SpanId + "-01"; w.Header().Get(tracing.TRACEPARENT_HEADER) != expected {
+		t.Errorf("expected the traceparent %s, got %q", expected, w.Header().Get(tracing.TRACEPARENT_HEADER))
+	}
+	if expose := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(expose, tracing.TRACEPARENT_HEADER) {
+		t.Errorf("expected the traceparent to be exposed to browsers, got %q", expose)
+	}
+	for i := 1; i < len(parents); i++ {
+		span, ok := spans[parents[i]]
+		if !ok {
+			t.Errorf("expected a %s span, got %d spans", parents[i], len(spans))
+			continue
+		}
+		if span.ParentId != spans[parents[i-1]].SpanId {
+			t.Errorf("expected %s to be a child of %s", parents[i], parents[i-1])
+		}
+	}
+}
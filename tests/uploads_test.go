@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EduardoZepeda/go-coffee-api/application"
+	"github.com/EduardoZepeda/go-coffee-api/images"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/router"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Storage that keeps the saved keys, to check which images were deleted
+type memoryStorage map[string]bool
+
+func (storage memoryStorage) Save(ctx context.Context, key string, content io.Reader) error {
+	storage[key] = true
+	return nil
+}
+
+func (storage memoryStorage) Delete(ctx context.Context, key string) error {
+	delete(storage, key)
+	return nil
+}
+
+func (storage memoryStorage) URL(key string) string {
+	return "/api/v1/media/" + key
+}
+
+// Authorization header with a token of the user, signed with the secret of the app
+func bearerToken(t *testing.T, app *application.App, userId string, isStaff bool) string {
+	t.Helper()
+	claims := models.AppClaims{UserId: userId, IsStaff: isStaff, StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(app.Config.JWTSecret.Value()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+func TestProfilePictureChangesTheETag(t *testing.T) {
+	app := newApp(t)
+	app.Storage = memoryStorage{}
+	handler := router.New(app)
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "picture.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(picture.Bytes())
+	form.Close()
+	tests := []struct {
+		method      string
+		body        io.Reader
+		contentType string
+		status      int
+		etag        string
+	}{
+		{http.MethodPut, &body, form.FormDataContentType(), http.StatusOK, `"2"`},
+		{http.MethodDelete, nil, "", http.StatusNoContent, `"3"`},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/api/v1/users/2/profile-picture", test.body)
+		r.RemoteAddr = CLIENT_ADDR
+		r.Header.Set("Authorization", bearerToken(t, app, "2", false))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status || w.Header().Get("ETag") != test.etag {
+			t.Fatalf("%s: expected status %d with the ETag %s, got %d with %q: %s", test.method, test.status, test.etag, w.Code, w.Header().Get("ETag"), w.Body.String())
+		}
+		// The response is the user as it was stored
+		if test.method == http.MethodPut && !strings.Contains(w.Body.String(), `"profilePicture":"/api/v1/media/users/2/`) {
+			t.Errorf("expected the new profile picture, got %s", w.Body.String())
+		}
+	}
+}
+
+func TestDeletesRemoveTheImages(t *testing.T) {
+	app := newApp(t)
+	ctx := context.Background()
+	mediaStorage := memoryStorage{}
+	app.Storage = mediaStorage
+	save := func(key string) {
+		for _, imageKey := range images.Keys(key) {
+			mediaStorage[imageKey] = true
+		}
+	}
+	// The images of the coffee shop 2 and the user 1 must be kept
+	photos := map[string]string{"coffee-shops/1/front.jpg": "1", "coffee-shops/1/bar.jpg": "1", "coffee-shops/2/front.jpg": "2"}
+	for key, shop := range photos {
+		if _, err := app.Repo.AddCoffeeShopPhoto(ctx, &models.ShopPhoto{CoffeeShopId: shop, Image: key}); err != nil {
+			t.Fatal(err)
+		}
+		save(key)
+	}
+	pictures := map[string]string{"users/1/picture.png": "1", "users/2/picture.png": "2"}
+	for key, user := range pictures {
+		if err := app.Repo.UpdateProfilePicture(ctx, user, key); err != nil {
+			t.Fatal(err)
+		}
+		save(key)
+	}
+	handler := router.New(app)
+	// The admin is the user 1, Anya the user 2
+	for path, authorization := range map[string]string{"/api/v1/coffee-shops/1": bearerToken(t, app, "1", true), "/api/v1/users/2": bearerToken(t, app, "2", false)} {
+		r := httptest.NewRequest(http.MethodDelete, path, nil)
+		r.RemoteAddr = CLIENT_ADDR
+		r.Header.Set("Authorization", authorization)
+		r.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected status %d, got %d: %s", path, http.StatusNoContent, w.Code, w.Body.String())
+		}
+	}
+	var kept []string
+	for key := range mediaStorage {
+		kept = append(kept, key)
+	}
+	expected := append(images.Keys("coffee-shops/2/front.jpg"), images.Keys("users/1/picture.png")...)
+	sort.Strings(kept)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(kept, expected) {
+		t.Errorf("expected the images\n%v\ngot\n%v", expected, kept)
+	}
+}
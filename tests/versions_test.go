@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EduardoZepeda/go-coffee-api/handlers"
+	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/repository"
+	"github.com/EduardoZepeda/go-coffee-api/types"
+	"github.com/gorilla/mux"
+)
+
+func TestIfMatch(t *testing.T) {
+	app := newApp(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/coffee-shops/{id:[0-9]+}", handlers.UpdateCoffeeShop(app)).Methods(http.MethodPut)
+	router.HandleFunc("/coffee-shops/{id:[0-9]+}", handlers.PatchCoffeeShop(app)).Methods(http.MethodPatch)
+	router.HandleFunc("/coffee-shops/{id:[0-9]+}", handlers.DeleteCoffeeShop(app)).Methods(http.MethodDelete)
+	body := `{"name": "Café 1", "address": "Av. Chapultepec 100", "city": "Guadalajara", "rating": 4, "location": [20.67, -103.35]}`
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		ifMatch string
+		body    string
+		status  int
+		etag    string
+	}{
+		{"missing header", http.MethodPut, "/coffee-shops/1", "", body, http.StatusPreconditionRequired, ""},
+		{"malformed header", http.MethodPut, "/coffee-shops/1", "1", body, http.StatusPreconditionFailed, ""},
+		{"current version", http.MethodPut, "/coffee-shops/1", `"1"`, body, http.StatusOK, `"2"`},
+		{"stale version", http.MethodPut, "/coffee-shops/1", `"1"`, body, http.StatusPreconditionFailed, ""},
+		{"any version", http.MethodPut, "/coffee-shops/1", "*", body, http.StatusOK, `"3"`},
+		{"any version of a missing shop", http.MethodPut, "/coffee-shops/1000", "*", body, http.StatusNotFound, ""},
+		{"patch any version", http.MethodPatch, "/coffee-shops/1", "*", `{"rating": 5}`, http.StatusOK, `"4"`},
+		{"patch a stale version", http.MethodPatch, "/coffee-shops/1", `"3"`, `{"rating": 3}`, http.StatusPreconditionFailed, ""},
+		{"delete any version of a missing shop", http.MethodDelete, "/coffee-shops/1000", "*", "", http.StatusNotFound, ""},
+		{"delete any version", http.MethodDelete, "/coffee-shops/1", "*", "", http.StatusNoContent, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.ifMatch != "" {
+			r.Header.Set("If-Match", test.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.status, w.Code, w.Body.String())
+		}
+		if test.etag != "" && w.Header().Get("ETag") != test.etag {
+			t.Errorf("%s: expected the ETag %s, got %q", test.name, test.etag, w.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestIfMatchReadsTheUncachedVersion(t *testing.T) {
+	app := newApp(t)
+	wrapped := app.Repo
+	app.Repo = repository.NewCachedRepository(wrapped, repository.DEFAULT_CACHE_SIZE, repository.DEFAULT_CACHE_TTL)
+	router := mux.NewRouter()
+	router.HandleFunc("/coffee-shops/{id:[0-9]+}", handlers.PatchCoffeeShop(app)).Methods(http.MethodPatch)
+	ctx := context.Background()
+	if _, err := app.Repo.GetCoffeeShopById(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	// Another instance updates the coffee shop, the cache of this one still has the first version
+	shop := &models.CoffeeShop{ID: "1", Name: "Café Uno", Address: "Av. Chapultepec 100", City: "Guadalajara", Rating: 4, Location: types.Point{20.67, -103.35}, Version: 1}
+	if err := wrapped.UpdateCoffeeShop(ctx, shop); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPatch, "/coffee-shops/1", strings.NewReader(`{"rating": 5}`))
+	r.Header.Set("If-Match", `"2"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Fatalf("expected the patch of the second version, got %d with the ETag %q: %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"name":"Café Uno"`) {
+		t.Errorf("expected the patch to be merged over the second version, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Drops every span, the default until the configuration picks an exporter
+type NoopExporter struct{}
+
+func (NoopExporter) ExportSpan(span SpanData) {}
+
+// Writes every span as a json line, like the logs, for local runs
+type WriterExporter struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func NewWriterExporter(writer io.Writer) *WriterExporter {
+	return &WriterExporter{writer: writer}
+}
+
+func (exporter *WriterExporter) ExportSpan(span SpanData) {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.writer.Write(append(line, '\n'))
+}
+
+// Keeps the spans in memory, in the order they ended, for the tests
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+func (exporter *MemoryExporter) ExportSpan(span SpanData) {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.spans = append(exporter.spans, span)
+}
+
+func (exporter *MemoryExporter) Spans() []SpanData {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	return append([]SpanData{}, exporter.spans...)
+}
+
+func (exporter *MemoryExporter) Reset() {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	exporter.spans = nil
+}
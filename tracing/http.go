@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Wrap a middleware in a span with the given name. The span covers the middleware and everything it calls, so the
+// time spent by the middleware alone is the span minus its child
+func Middleware(name string, middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		handler := middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if SpanFromContext(r.Context()) == nil {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			ctx, span := Start(r.Context(), name, "kind", "middleware")
+			defer span.End()
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Wrap a handler in a span with the given name. The response writer carries the context of the span, so the code
+// that only gets the writer, like application.App.Respond, can add its own spans with WriterContext
+func Handler(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if SpanFromContext(r.Context()) == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		ctx, span := Start(r.Context(), name, "kind", "handler")
+		defer span.End()
+		handler.ServeHTTP(&responseWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer can't be hijacked")
+	}
+	return hijacker.Hijack()
+}
+
+// Context of the handler that got the writer, false when the handler isn't traced
+func WriterContext(w http.ResponseWriter) (context.Context, bool) {
+	rw, ok := w.(*responseWriter)
+	if !ok {
+		return nil, false
+	}
+	return rw.ctx, true
+}
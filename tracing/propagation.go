@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Header of the W3C Trace Context, version-traceid-parentid-flags like
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+const TRACEPARENT_HEADER = "traceparent"
+
+const sampledFlag = 0x01
+
+// Read the traceparent header. Versions other than 00 are read like 00, as the specification asks
+func Extract(header http.Header) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(header.Get(TRACEPARENT_HEADER)), "-")
+	if len(parts) < 4 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	var version, flags [1]byte
+	if !decodeHex(version[:], parts[0]) || !decodeHex(sc.TraceId[:], parts[1]) || !decodeHex(sc.SpanId[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&sampledFlag != 0
+	return sc, sc.IsValid()
+}
+
+// Lowercase hex of exactly the length of the id
+func decodeHex(id []byte, text string) bool {
+	if len(text) != hex.EncodedLen(len(id)) || strings.ToLower(text) != text {
+		return false
+	}
+	_, err := hex.Decode(id, []byte(text))
+	return err == nil
+}
+
+// Write the traceparent header of the span of the context, so the service called next continues the trace
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(TRACEPARENT_HEADER, Traceparent(span.SpanContext()))
+}
+
+func Traceparent(sc SpanContext) string {
+	var flags byte
+	if sc.Sampled {
+		flags = sampledFlag
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceId, sc.SpanId, flags)
+}
@@ -0,0 +1,185 @@
+// Package tracing records the spans of a request, like the middlewares, the handler and every query, in the style of
+// OpenTelemetry. The trace is continued from the W3C traceparent header of the request, and the finished spans are
+// sent to an Exporter, which writes them to stdout or keeps them in memory.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type TraceId [16]byte
+
+type SpanId [8]byte
+
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceId) IsValid() bool {
+	return id != TraceId{}
+}
+
+func (id SpanId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanId) IsValid() bool {
+	return id != SpanId{}
+}
+
+// Identifies a span across services, it's what the traceparent header carries
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	// Only sampled traces are exported, the caller decides for the whole trace
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceId.IsValid() && sc.SpanId.IsValid()
+}
+
+// A finished span, as the exporters get it
+type SpanData struct {
+	Name       string                 `json:"name"`
+	TraceId    string                 `json:"trace_id"`
+	SpanId     string                 `json:"span_id"`
+	ParentId   string                 `json:"parent_id,omitempty"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	DurationMs float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type Span struct {
+	mu         sync.Mutex
+	name       string
+	context    SpanContext
+	parentId   SpanId
+	start      time.Time
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (span *Span) SpanContext() SpanContext {
+	return span.context
+}
+
+// Key value pairs that describe the span, like the route or the sql statement
+func (span *Span) SetAttributes(keyvals ...interface{}) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if key, ok := keyvals[i].(string); ok {
+			span.attributes[key] = keyvals[i+1]
+		}
+	}
+}
+
+// Mark the span as failed, nil errors are ignored
+func (span *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.err = err
+}
+
+// Export the span if it's sampled. Only the first call counts
+func (span *Span) End() {
+	end := time.Now()
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+	data := SpanData{
+		Name:       span.name,
+		TraceId:    span.context.TraceId.String(),
+		SpanId:     span.context.SpanId.String(),
+		Start:      span.start,
+		End:        end,
+		DurationMs: float64(end.Sub(span.start).Microseconds()) / 1000,
+		Attributes: span.attributes,
+	}
+	if span.parentId.IsValid() {
+		data.ParentId = span.parentId.String()
+	}
+	if span.err != nil {
+		data.Error = span.err.Error()
+	}
+	span.mu.Unlock()
+	if span.context.Sampled {
+		GetExporter().ExportSpan(data)
+	}
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// The span of the context, nil outside of a trace
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Continue a trace started by another service, the next span started with the context is its child
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start a child of the span of the context, or a new trace when there isn't one. End must be called once the work
+// is done
+func Start(ctx context.Context, name string, keyvals ...interface{}) (context.Context, *Span) {
+	span := &Span{name: name, start: time.Now(), attributes: make(map[string]interface{})}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.TraceId, span.context.Sampled, span.parentId = parent.context.TraceId, parent.context.Sampled, parent.context.SpanId
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		span.context.TraceId, span.context.Sampled, span.parentId = remote.TraceId, remote.Sampled, remote.SpanId
+	} else {
+		rand.Read(span.context.TraceId[:])
+		span.context.Sampled = true
+	}
+	rand.Read(span.context.SpanId[:])
+	span.SetAttributes(keyvals...)
+	return ContextWithSpan(ctx, span), span
+}
+
+// Receives every finished span that's sampled. It's called by the goroutine that ends the span, so it must be safe
+// for concurrent use and return quickly
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+var exporter atomic.Value
+
+type exporterHolder struct {
+	exporter Exporter
+}
+
+func init() {
+	exporter.Store(exporterHolder{NoopExporter{}})
+}
+
+func GetExporter() Exporter {
+	return exporter.Load().(exporterHolder).exporter
+}
+
+// Replace the exporter of every span, like the logger the exporter is set once the configuration is loaded
+func SetExporter(newExporter Exporter) {
+	exporter.Store(exporterHolder{newExporter})
+}
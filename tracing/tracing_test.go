@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func useMemoryExporter(t *testing.T) *MemoryExporter {
+	previous := GetExporter()
+	exporter := NewMemoryExporter()
+	SetExporter(exporter)
+	t.Cleanup(func() { SetExporter(previous) })
+	return exporter
+}
+
+func TestChildrenShareTheTraceOfTheirParent(t *testing.T) {
+	exporter := useMemoryExporter(t)
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child", "db.statement", "SELECT 1")
+	child.RecordError(errors.New("connection refused"))
+	child.End()
+	child.End()
+	parent.End()
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	childData, parentData := spans[0], spans[1]
+	if childData.TraceId != parentData.TraceId || childData.ParentId != parentData.SpanId || parentData.ParentId != "" {
+		t.Errorf("expected child to be a child of parent, got %+v and %+v", childData, parentData)
+	}
+	if childData.Error != "connection refused" || childData.Attributes["db.statement"] != "SELECT 1" {
+		t.Errorf("expected the error and attributes of the child, got %+v", childData)
+	}
+}
+
+func TestTraceparentIsExtractedAndInjected(t *testing.T) {
+	exporter := useMemoryExporter(t)
+	header := http.Header{}
+	header.Set(TRACEPARENT_HEADER, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	remote, ok := Extract(header)
+	if !ok || !remote.Sampled {
+		t.Fatalf("expected a sampled span context, got %+v", remote)
+	}
+	ctx, span := Start(ContextWithRemoteSpanContext(context.Background(), remote), "server")
+	outgoing := http.Header{}
+	Inject(ctx, outgoing)
+	span.End()
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext().SpanId.String() + "-01"
+	if outgoing.Get(TRACEPARENT_HEADER) != expected {
+		t.Errorf("expected the traceparent %s, got %s", expected, outgoing.Get(TRACEPARENT_HEADER))
+	}
+	if spans := exporter.Spans(); len(spans) != 1 || spans[0].ParentId != "00f067aa0ba902b7" {
+		t.Errorf("expected the span to continue the remote trace, got %+v", spans)
+	}
+}
+
+func TestInvalidTraceparentsAreIgnored(t *testing.T) {
+	for _, traceparent := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		header := http.Header{}
+		header.Set(TRACEPARENT_HEADER, traceparent)
+		if sc, ok := Extract(header); ok {
+			t.Errorf("expected %q to be invalid, got %+v", traceparent, sc)
+		}
+	}
+}
+
+func TestUnsampledTracesAreNotExported(t *testing.T) {
+	exporter := useMemoryExporter(t)
+	header := http.Header{}
+	header.Set(TRACEPARENT_HEADER, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	remote, _ := Extract(header)
+	_, span := Start(ContextWithRemoteSpanContext(context.Background(), remote), "server")
+	span.End()
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Errorf("expected no spans, got %+v", spans)
+	}
+}
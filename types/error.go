@@ -3,4 +3,6 @@ package types
 type ApiError struct {
 	Message string             `json:"message"`
 	Errors  *map[string]string `json:"errors,omitempty"`
+	// Id of the request, to find its log lines when the error is reported
+	RequestId string `json:"request_id,omitempty"`
 }
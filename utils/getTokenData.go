@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -32,7 +31,8 @@ func GetTokenFromAuthHeader(r *http.Request) (string, error) {
 	return token[1], nil
 }
 
-func GetDataFromToken(r *http.Request, data string) (interface{}, error) {
+// Read the data claim of the token in the Authorization header, verified with the secret the token was signed with
+func GetDataFromToken(r *http.Request, secret string, data string) (interface{}, error) {
 	VALID_TOKEN_KEYS := []string{"userId", "isStaff"}
 	if !Contains(VALID_TOKEN_KEYS, data) {
 		return nil, errors.New(fmt.Sprintf("JWT Token doesn't contain the %s claim", data))
@@ -44,7 +44,7 @@ func GetDataFromToken(r *http.Request, data string) (interface{}, error) {
 	// User id is obtained from JWT Token
 	claims := jwt.MapClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
+		return []byte(secret), nil
 	})
 	if err != nil || !token.Valid {
 		return nil, err
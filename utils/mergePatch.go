@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// MergePatch applies a JSON merge patch (RFC 7396) to a JSON document. Members of the patch replace the ones in
+// the document, null members are removed from it and nested objects are merged recursively
+func MergePatch(document []byte, patch []byte) ([]byte, error) {
+	var documentValue, patchValue interface{}
+	if err := json.Unmarshal(document, &documentValue); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+	if _, ok := patchValue.(map[string]interface{}); !ok {
+		return nil, errors.New("The merge patch must be a JSON object")
+	}
+	return json.Marshal(mergePatch(documentValue, patchValue))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	// Any value that isn't an object replaces the target completely
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
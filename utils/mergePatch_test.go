@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	const document = `{"name": "Café Madrid", "rating": 4.5, "location": [20.67, -103.35], "hours": {"opens": "08:00", "closes": "20:00"}}`
+	tests := []struct {
+		name     string
+		patch    string
+		expected string
+	}{
+		{"untouched fields keep their values", `{"rating": 5}`, `{"name": "Café Madrid", "rating": 5, "location": [20.67, -103.35], "hours": {"opens": "08:00", "closes": "20:00"}}`},
+		{"null removes a field", `{"rating": null, "missing": null}`, `{"name": "Café Madrid", "location": [20.67, -103.35], "hours": {"opens": "08:00", "closes": "20:00"}}`},
+		{"nested objects merge", `{"hours": {"closes": "22:00", "opens": null, "weekday": 1}}`, `{"name": "Café Madrid", "rating": 4.5, "location": [20.67, -103.35], "hours": {"closes": "22:00", "weekday": 1}}`},
+		{"arrays are replaced", `{"location": [20.7]}`, `{"name": "Café Madrid", "rating": 4.5, "location": [20.7], "hours": {"opens": "08:00", "closes": "20:00"}}`},
+		{"objects replace other values", `{"name": {"es": "Café Madrid"}, "hours": "24/7"}`, `{"name": {"es": "Café Madrid"}, "rating": 4.5, "location": [20.67, -103.35], "hours": "24/7"}`},
+		{"empty patch", `{}`, document},
+	}
+	for _, test := range tests {
+		merged, err := MergePatch([]byte(document), []byte(test.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var got, expected interface{}
+		if err = json.Unmarshal(merged, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal([]byte(test.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, merged)
+		}
+	}
+}
+
+func TestMergePatchRejectsInvalidPatches(t *testing.T) {
+	for _, patch := range []string{`[{"rating": 5}]`, `"rating"`, `null`, `{"rating": }`, ``} {
+		if _, err := MergePatch([]byte(`{"rating": 4.5}`), []byte(patch)); err == nil {
+			t.Errorf("expected an error for the patch %q", patch)
+		}
+	}
+}
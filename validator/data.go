@@ -1,11 +1,14 @@
 package validator
 
 import (
+	"fmt"
 	"net/mail"
 	"regexp"
+	"time"
 
 	"github.com/EduardoZepeda/go-coffee-api/database"
 	"github.com/EduardoZepeda/go-coffee-api/models"
+	"github.com/EduardoZepeda/go-coffee-api/schedule"
 )
 
 func ValidateCoffeeShop(v *Validator, coffeeShop *models.CoffeeShop) {
@@ -39,4 +42,76 @@ func ValidateCoffeeBag(v *Validator, coffeeBag *models.CoffeeBag) {
 	v.Validate(speciesExists, "Species", "That's not a valid species for a coffee bean. Valid values are: Ar, Ro, Lb and Ex.")
 	_, originExists := database.STATE_CHOICES[coffeeBag.Origin]
 	v.Validate(originExists, "Origin", "That's not a valid origin in México for coffee beans. Valid values are numbers from 01 to 32.")
+	// Roast and process are optional, since they're unknown for many of the existing coffee bags
+	_, roastExists := database.ROAST_LEVELS[coffeeBag.Roast]
+	v.Validate(coffeeBag.Roast == "" || roastExists, "Roast", "That's not a valid roast level. Valid values are: Li, Me, MD and Da.")
+	_, processExists := database.COFFEE_PROCESSES[coffeeBag.Process]
+	v.Validate(coffeeBag.Process == "" || processExists, "Process", "That's not a valid process. Valid values are: Wa, Na, Ho and An.")
+	v.Validate(coffeeBag.Altitude == nil || (*coffeeBag.Altitude >= 0 && *coffeeBag.Altitude <= 5000), "Altitude", "Altitude must be an integer between 0 and 5000 meters")
+	v.Validate(len(coffeeBag.Variety) <= 100, "Variety", "Variety can't be greater than 100 chars")
+	v.Validate(len(coffeeBag.TastingNotes) <= 10, "TastingNotes", "A coffee bag can't have more than 10 tasting notes")
+	for _, note := range coffeeBag.TastingNotes {
+		v.Validate(len(note) > 0 && len(note) <= 50, "TastingNotes", "Tasting notes must be between 1 and 50 chars")
+	}
+	v.Validate(coffeeBag.Weight == nil || (*coffeeBag.Weight > 0 && *coffeeBag.Weight <= 10000), "Weight", "Weight must be an integer between 1 and 10000 grams")
+	v.Validate(coffeeBag.Price == nil || (*coffeeBag.Price >= 0 && *coffeeBag.Price < 1000000), "Price", "Price must be a number between 0 and 999999.99 MXN")
+}
+
+func ValidateCoffeeShopClusters(v *Validator, clustersRequest *models.CoffeeShopClustersRequest) {
+	v.Validate(clustersRequest.MinLongitude >= -180 && clustersRequest.MaxLongitude <= 180, "Bbox", "Longitudes must be between -180 and 180")
+	v.Validate(clustersRequest.MinLatitude >= -90 && clustersRequest.MaxLatitude <= 90, "Bbox", "Latitudes must be between -90 and 90")
+	v.Validate(clustersRequest.MinLongitude < clustersRequest.MaxLongitude && clustersRequest.MinLatitude < clustersRequest.MaxLatitude, "Bbox", "Minimum coordinates must be lower than maximum coordinates")
+	v.Validate(clustersRequest.Zoom <= 22, "Zoom", "Zoom must be an integer between 0 and 22")
+}
+
+func isValidTimeOfDay(value string) bool {
+	_, err := time.Parse(schedule.TIME_LAYOUT, value)
+	return err == nil
+}
+
+func ValidateOpeningHours(v *Validator, openingHours *models.OpeningHours) {
+	for i, interval := range openingHours.Weekly {
+		key := fmt.Sprintf("Weekly[%d]", i)
+		v.Validate(interval.Weekday >= 0 && interval.Weekday <= 6, key, "Weekday must be an integer between 0 (Sunday) and 6 (Saturday)")
+		v.Validate(isValidTimeOfDay(interval.Opens) && isValidTimeOfDay(interval.Closes), key, "Opens and closes must be times in the format HH:MM, for example: 08:30")
+		v.Validate(interval.Opens != interval.Closes, key, "Opens and closes can't be the same time")
+	}
+	for i, special := range openingHours.Special {
+		key := fmt.Sprintf("Special[%d]", i)
+		_, dateError := time.Parse(schedule.DATE_LAYOUT, special.Date)
+		v.Validate(dateError == nil, key, "Date must be in the format YYYY-MM-DD")
+		v.Validate(len(special.Description) <= 100, key, "Description can't be greater than 100 chars")
+		if special.Closed {
+			v.Validate(special.Opens == "" && special.Closes == "", key, "A closed day can't have opening or closing times")
+			continue
+		}
+		v.Validate(isValidTimeOfDay(special.Opens) && isValidTimeOfDay(special.Closes), key, "Opens and closes must be times in the format HH:MM, for example: 08:30")
+		v.Validate(special.Opens != special.Closes, key, "Opens and closes can't be the same time")
+	}
+}
+
+func ValidateCoffeeBagsList(v *Validator, coffeeBagsList *models.CoffeeBagsList) {
+	_, speciesExists := database.COFFEE_SPECIES[coffeeBagsList.Species]
+	v.Validate(coffeeBagsList.Species == "" || speciesExists, "species", "That's not a valid species for a coffee bean. Valid values are: Ar, Ro, Lb and Ex.")
+	_, originExists := database.STATE_CHOICES[coffeeBagsList.Origin]
+	v.Validate(coffeeBagsList.Origin == "" || originExists, "origin", "That's not a valid origin in México for coffee beans. Valid values are numbers from 01 to 32.")
+	_, roastExists := database.ROAST_LEVELS[coffeeBagsList.Roast]
+	v.Validate(coffeeBagsList.Roast == "" || roastExists, "roast", "That's not a valid roast level. Valid values are: Li, Me, MD and Da.")
+	_, processExists := database.COFFEE_PROCESSES[coffeeBagsList.Process]
+	v.Validate(coffeeBagsList.Process == "" || processExists, "process", "That's not a valid process. Valid values are: Wa, Na, Ho and An.")
+	_, sortExists := database.COFFEE_BAG_SORTING[coffeeBagsList.Sort]
+	v.Validate(coffeeBagsList.Sort == "" || sortExists, "sort", "Valid values are: id, brand, price and altitude. Prefix them with a minus sign for descending order, e.g. -price.")
+	v.Validate(len(coffeeBagsList.Brand) <= 200 && len(coffeeBagsList.Search) <= 200, "search", "Search terms can't be greater than 200 chars")
+}
+
+func ValidateCoffeeBagAvailability(v *Validator, availability *models.CoffeeBagAvailability) {
+	v.Validate(availability.Price == nil || (*availability.Price >= 0 && *availability.Price < 1000000), "Price", "Price must be a number between 0 and 999999.99 MXN")
+	v.Validate(availability.Size == nil || (*availability.Size > 0 && *availability.Size <= 10000), "Size", "Size must be an integer between 1 and 10000 grams")
+	_, stockStatusExists := database.STOCK_STATUSES[availability.StockStatus]
+	v.Validate(availability.StockStatus == "" || stockStatusExists, "StockStatus", "That's not a valid stock status. Valid values are: IS (in stock), LS (low stock) and OS (out of stock).")
+	if availability.RoastDate != "" {
+		roastDate, err := time.Parse(schedule.DATE_LAYOUT, availability.RoastDate)
+		v.Validate(err == nil, "RoastDate", "Roast date must be in the format YYYY-MM-DD")
+		v.Validate(err != nil || !roastDate.After(time.Now()), "RoastDate", "Roast date can't be in the future")
+	}
 }
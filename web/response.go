@@ -3,11 +3,6 @@ package web
 import (
 	"encoding/json"
 	"net/http"
-	"net/url"
-	"os"
-
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 )
 
 func Respond(w http.ResponseWriter, data interface{}, statusCode int) error {
@@ -24,23 +19,3 @@ func Respond(w http.ResponseWriter, data interface{}, statusCode int) error {
 
 	return nil
 }
-
-func ConnectToDB() (*sqlx.DB, error) {
-	q := make(url.Values)
-	q.Set("sslmode", "require")
-	q.Set("timezone", "utc")
-
-	u := url.URL{
-		Scheme:   "postgres",
-		User:     url.UserPassword(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD")),
-		Host:     os.Getenv("DB_HOST"),
-		Path:     os.Getenv("DB_PATH"),
-		RawQuery: q.Encode(),
-	}
-
-	db, err := sqlx.Connect("postgres", u.String())
-	if err != nil {
-		return nil, err
-	}
-	return db, nil
-}
@@ -1,36 +1,84 @@
 package ws
 
-import "github.com/gorilla/websocket"
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Time allowed to write a message before the connection is considered dead
+const WRITE_TIMEOUT = 5 * time.Second
+
+// Messages waiting to be written to a client, sending more blocks until the client catches up
+const OUTBOUND_BUFFER = 16
 
 type Client struct {
 	hub      *Hub
 	id       string
 	socket   *websocket.Conn
 	outbound chan []byte
+	// Closed by Close, the close frame is written by the Write goroutine so there's only one writer
+	done         chan struct{}
+	closeOnce    sync.Once
+	closeMessage []byte
 }
 
 func NewClient(hub *Hub, socket *websocket.Conn) *Client {
 	return &Client{
 		hub:      hub,
 		socket:   socket,
-		outbound: make(chan []byte),
+		outbound: make(chan []byte, OUTBOUND_BUFFER),
+		done:     make(chan struct{}),
+	}
+}
+
+// Queue a message for the client. It returns false when the client is already closed
+func (c *Client) Send(message []byte) bool {
+	select {
+	case c.outbound <- message:
+		return true
+	case <-c.done:
+		return false
 	}
 }
 
+// Write the queued messages until the client is closed, then send the close frame and close the connection.
+// It's the only goroutine writing to the socket
 func (c *Client) Write() {
+	defer c.socket.Close()
 	for {
 		select {
-		case message, ok := <-c.outbound:
-			if !ok {
-				c.socket.WriteMessage(websocket.CloseMessage, []byte{})
+		case message := <-c.outbound:
+			c.socket.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+			if err := c.socket.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.Close(nil)
+				c.hub.unregisterClient(c)
 				return
 			}
-			c.socket.WriteMessage(websocket.TextMessage, message)
+		case <-c.done:
+			c.socket.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+			c.socket.WriteMessage(websocket.CloseMessage, c.closeMessage)
+			return
+		}
+	}
+}
+
+// Read until the connection fails or the client closes it. The messages of the clients are ignored, but reading
+// is needed to answer their pings and notice when they leave
+func (c *Client) Read() {
+	for {
+		if _, _, err := c.socket.ReadMessage(); err != nil {
+			c.hub.unregisterClient(c)
+			return
 		}
 	}
 }
 
-func (c Client) Close() {
-	c.socket.Close()
-	close(c.outbound)
+// Stop the client with the given close frame. It can be called more than once, only the first call counts
+func (c *Client) Close(closeMessage []byte) {
+	c.closeOnce.Do(func() {
+		c.closeMessage = closeMessage
+		close(c.done)
+	})
 }
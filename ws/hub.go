@@ -2,10 +2,10 @@ package ws
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"sync"
 
+	"github.com/EduardoZepeda/go-coffee-api/logging"
 	"github.com/gorilla/websocket"
 )
 
@@ -23,6 +23,8 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	mutex      *sync.Mutex
+	done       chan struct{}
+	closeOnce  sync.Once
 }
 
 func NewHub() *Hub {
@@ -31,6 +33,7 @@ func NewHub() *Hub {
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		mutex:      &sync.Mutex{},
+		done:       make(chan struct{}),
 	}
 }
 
@@ -41,54 +44,106 @@ func (hub *Hub) Run() {
 			hub.onConnect(client)
 		case client := <-hub.unregister:
 			hub.onDisconnect(client)
+		case <-hub.done:
+			return
 		}
 	}
 }
 
+// Number of connected clients
+func (hub *Hub) Clients() int {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return len(hub.clients)
+}
+
+// Hand the client to the hub, unless the hub is closed
+func (hub *Hub) registerClient(client *Client) bool {
+	select {
+	case hub.register <- client:
+		return true
+	case <-hub.done:
+		return false
+	}
+}
+
+func (hub *Hub) unregisterClient(client *Client) {
+	select {
+	case hub.unregister <- client:
+	case <-hub.done:
+	}
+}
+
 func (hub *Hub) onConnect(client *Client) {
-	log.Println("Client connected", client.socket.RemoteAddr())
+	logging.Default().Debug("websocket client connected", "remote_address", client.socket.RemoteAddr().String())
 	hub.mutex.Lock()
 	defer hub.mutex.Unlock()
+	// Close may have run between the registration and now
+	select {
+	case <-hub.done:
+		client.Close(goingAway())
+		return
+	default:
+	}
 	client.id = client.socket.RemoteAddr().String()
 	hub.clients = append(hub.clients, client)
 }
 
 func (hub *Hub) onDisconnect(client *Client) {
-	log.Println("Client disconnected", client.socket.RemoteAddr())
-
-	client.Close()
+	logging.Default().Debug("websocket client disconnected", "remote_address", client.socket.RemoteAddr().String())
+	client.Close(websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 	hub.mutex.Lock()
 	defer hub.mutex.Unlock()
-
-	i := -1
-	for j, c := range hub.clients {
-		if c.id == client.id {
-			i = j
-			break
+	// Both the reader and the writer of a client unregister it when they fail
+	for i, c := range hub.clients {
+		if c == client {
+			copy(hub.clients[i:], hub.clients[i+1:])
+			hub.clients[len(hub.clients)-1] = nil
+			hub.clients = hub.clients[:len(hub.clients)-1]
+			return
 		}
 	}
-	copy(hub.clients[i:], hub.clients[i+1:])
-	hub.clients[len(hub.clients)-1] = nil
-	hub.clients = hub.clients[:len(hub.clients)-1]
+}
 
+func goingAway() []byte {
+	return websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+}
+
+// Tell every client that the server is going away, disconnect them and stop the hub. The close frames are written
+// by the Write goroutine of each client, never concurrently with their messages
+func (hub *Hub) Close() {
+	hub.closeOnce.Do(func() {
+		close(hub.done)
+		hub.mutex.Lock()
+		defer hub.mutex.Unlock()
+		for _, client := range hub.clients {
+			client.Close(goingAway())
+		}
+		hub.clients = nil
+	})
 }
 
 func (hub *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	wsconn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Warn("websocket upgrade failed", "error", err)
 		http.Error(w, "Error upgrading connection", http.StatusInternalServerError)
 		return
 	}
 	client := NewClient(hub, wsconn)
-	hub.register <- client
+	go client.Write()
+	if !hub.registerClient(client) {
+		client.Close(goingAway())
+		return
+	}
+	go client.Read()
 	info := Message{user: 1, content: "hola"}
 	data, err := json.Marshal(info)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "Error receiving message", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("encoding the websocket message failed", "error", err)
+		client.Close(websocket.FormatCloseMessage(websocket.CloseInternalServerErr, ""))
+		hub.unregisterClient(client)
 		return
 	}
-	client.outbound <- data
-	go client.Write()
+	client.Send(data)
 }
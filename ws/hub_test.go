@@ -0,0 +1,120 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func startHub(t *testing.T) (*Hub, string) {
+	t.Helper()
+	hub := NewHub()
+	go hub.Run()
+	server := httptest.NewServer(http.HandlerFunc(hub.HandleWebSocket))
+	t.Cleanup(func() {
+		hub.Close()
+		server.Close()
+	})
+	return hub, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// Wait until the hub has the expected number of clients, it registers them in its own goroutine
+func waitForClients(t *testing.T, hub *Hub, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Clients() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d clients, got %d", expected, hub.Clients())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Read until the connection is closed, skipping the messages sent before
+func readClose(conn *websocket.Conn, code int) error {
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, code) {
+			return fmt.Errorf("expected the close code %d, got %v", code, err)
+		}
+		return nil
+	}
+}
+
+func TestHubSendsTheGreeting(t *testing.T) {
+	hub, url := startHub(t)
+	conn := dial(t, url)
+	if _, message, err := conn.ReadMessage(); err != nil || string(message) != "{}" {
+		t.Fatalf("expected the greeting, got %q and %v", message, err)
+	}
+	waitForClients(t, hub, 1)
+	// Clients that leave are removed from the hub
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if err := readClose(conn, websocket.CloseNormalClosure); err != nil {
+		t.Fatal(err)
+	}
+	waitForClients(t, hub, 0)
+}
+
+func TestHubCloseDisconnectsEveryClient(t *testing.T) {
+	hub, url := startHub(t)
+	conns := []*websocket.Conn{dial(t, url), dial(t, url), dial(t, url)}
+	waitForClients(t, hub, len(conns))
+	hub.Close()
+	for _, conn := range conns {
+		if err := readClose(conn, websocket.CloseGoingAway); err != nil {
+			t.Error(err)
+		}
+	}
+	if hub.Clients() != 0 {
+		t.Errorf("expected the hub to forget its clients, got %d", hub.Clients())
+	}
+	// Closing twice is harmless, the server calls it on shutdown
+	hub.Close()
+}
+
+func TestHubClosedBeforeConnecting(t *testing.T) {
+	hub, url := startHub(t)
+	hub.Close()
+	connected := make(chan struct{})
+	go func() {
+		defer close(connected)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := readClose(conn, websocket.CloseGoingAway); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler must not wait for a closed hub")
+	}
+	if hub.Clients() != 0 {
+		t.Errorf("expected no clients after the hub is closed, got %d", hub.Clients())
+	}
+}